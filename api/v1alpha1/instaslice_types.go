@@ -44,6 +44,10 @@ type AllocationRequest struct {
 	// podRef is a reference to the gated Pod requesting the allocation
 	// +optional
 	PodRef corev1.ObjectReference `json:"podRef"`
+
+	// containerName is the name of the container of the Pod the slice is allocated to
+	// +optional
+	ContainerName string `json:"containerName,omitempty"`
 }
 
 type AllocationStatus struct {
@@ -97,6 +101,15 @@ type DiscoveredGPU struct {
 	// gpuMemory represents the memory capacity of the GPU
 	// +required
 	GPUMemory resource.Quantity `json:"gpuMemory"`
+
+	// conditions represent the health of the GPU, a GPU with the Healthy condition set to False
+	// raised a critical XID and doesn't get new slices
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	// +patchStrategy=merge
+	// +patchMergeKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
 }
 
 type DiscoveredNodeResources struct {
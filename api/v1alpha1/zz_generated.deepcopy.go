@@ -85,6 +85,13 @@ func (in *AllocationStatus) DeepCopy() *AllocationStatus {
 func (in *DiscoveredGPU) DeepCopyInto(out *DiscoveredGPU) {
 	*out = *in
 	out.GPUMemory = in.GPUMemory.DeepCopy()
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiscoveredGPU.
@@ -144,6 +144,14 @@ func main() {
 
 	config := config.ConfigFromEnvironment()
 	setupLog.Info("using config", "config", config.ToString())
+	if _, err := controller.GetAllocationPolicy(config.AllocationPolicy); err != nil {
+		setupLog.Error(err, "invalid default allocation policy")
+		os.Exit(1)
+	}
+	if err := controller.ValidateDefragMode(config.DefragMode); err != nil {
+		setupLog.Error(err, "invalid defragmentation mode")
+		os.Exit(1)
+	}
 	runningOnOpenShift := utils.RunningOnOpenshift(context.Background(), mgr.GetClient())
 	if runningOnOpenShift {
 		setupLog.Info("Running on OpenShift")
@@ -171,6 +179,8 @@ func main() {
 		Config:             config,
 		RunningOnOpenShift: runningOnOpenShift,
 		ResourceCache:      tracker.Cache(),
+		Recorder:           mgr.GetEventRecorderFor("instaslice-controller"),
+		APIReader:          mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Instaslice")
 		os.Exit(1)
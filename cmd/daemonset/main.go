@@ -101,6 +101,14 @@ func main() {
 
 	config := config.ConfigFromEnvironment()
 	setupLog.Info("using config", "config", config.ToString())
+	if err := daemonset.ValidateDriftPolicy(config.DriftPolicy); err != nil {
+		setupLog.Error(err, "invalid drift policy")
+		os.Exit(1)
+	}
+	if _, err := daemonset.ParseCriticalXIDs(config.CriticalXIDs); err != nil {
+		setupLog.Error(err, "invalid critical XIDs")
+		os.Exit(1)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
@@ -0,0 +1,288 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// AllocationPolicy decides where a slice is placed and builds the allocation details
+type AllocationPolicy interface {
+	// selectPlacement picks one of the free placements found in the cluster for the profile,
+	// the boolean is false when none of them is acceptable.
+	selectPlacement(profileName string, candidates []placementCandidate) (placementCandidate, bool)
+	SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName, allocationStatus inferencev1alpha1.AllocationStatus,
+		discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32, namespace string, podName string, gpuUuid string, resourceIndetifier types.UID) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult)
+}
+
+// Names of the allocation policies that can be selected in the config, with the
+// AllocationPolicyLabel on a namespace or the AllocationPolicyAnnotation on a pod
+const (
+	FirstFitPolicyName    = "first-fit"
+	LeftToRightPolicyName = "left-to-right"
+	RightToLeftPolicyName = "right-to-left"
+	SpreadPolicyName      = "spread"
+	BestFitPolicyName     = "best-fit"
+)
+
+// allocationPolicies is the registry of the named allocation policies
+var allocationPolicies = map[string]AllocationPolicy{
+	FirstFitPolicyName:    &FirstFitPolicy{},
+	LeftToRightPolicyName: &LeftToRightPolicy{},
+	RightToLeftPolicyName: &RightToLeftPolicy{},
+	SpreadPolicyName:      &SpreadPolicy{},
+	BestFitPolicyName:     &BestFitPolicy{},
+}
+
+// AllocationPolicyNames returns the sorted names of the registered allocation policies
+func AllocationPolicyNames() []string {
+	names := make([]string, 0, len(allocationPolicies))
+	for name := range allocationPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetAllocationPolicy returns the registered allocation policy with the given name
+func GetAllocationPolicy(name string) (AllocationPolicy, error) {
+	policy, ok := allocationPolicies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown allocation policy %q, valid policies are %v", name, AllocationPolicyNames())
+	}
+	return policy, nil
+}
+
+// requestedAllocationPolicy returns the policy name requested by the pod annotation or,
+// when the pod has none, by the label of its namespace. The namespace may be nil.
+func requestedAllocationPolicy(pod *v1.Pod, namespace *v1.Namespace) (string, bool) {
+	names := requestedAllocationPolicies(pod, namespace)
+	if len(names) == 0 {
+		return "", false
+	}
+	return names[0], true
+}
+
+// requestedAllocationPolicies returns the policy names requested for the pod, the pod
+// annotation first and then the namespace label.
+func requestedAllocationPolicies(pod *v1.Pod, namespace *v1.Namespace) []string {
+	var names []string
+	if name, ok := pod.Annotations[AllocationPolicyAnnotation]; ok {
+		names = append(names, name)
+	}
+	if namespace != nil {
+		if name, ok := namespace.Labels[AllocationPolicyLabel]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// getNamespace returns the namespace with the given name, nil when it can't be found
+func getNamespace(ctx context.Context, c client.Client, name string) (*v1.Namespace, error) {
+	namespace := &v1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, namespace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return namespace, nil
+}
+
+// allocationPolicyForPod selects the allocation policy of the pod, in order of precedence
+// from the pod annotation, the namespace label and the cluster default. Invalid names are
+// rejected by the webhook, if one still shows up it is skipped.
+func (r *InstasliceReconciler) allocationPolicyForPod(ctx context.Context, pod *v1.Pod) (AllocationPolicy, error) {
+	log := logr.FromContext(ctx)
+
+	namespace, err := getNamespace(ctx, r.Client, pod.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range requestedAllocationPolicies(pod, namespace) {
+		policy, err := GetAllocationPolicy(name)
+		if err == nil {
+			return policy, nil
+		}
+		log.Error(err, "ignoring the allocation policy requested for the pod", "pod", pod.Name, "namespace", pod.Namespace)
+	}
+	if r.Config != nil && r.Config.AllocationPolicy != "" {
+		policy, err := GetAllocationPolicy(r.Config.AllocationPolicy)
+		if err == nil {
+			return policy, nil
+		}
+		log.Error(err, "ignoring the default allocation policy")
+	}
+	return &FirstFitPolicy{}, nil
+}
+
+// placementCandidate is a free placement for a profile on a GPU of a node.
+type placementCandidate struct {
+	instaslice *inferencev1alpha1.Instaslice
+	gpuUUID    string
+	placement  inferencev1alpha1.Placement
+	// slots is the slot map of the GPU before the placement is made
+	slots slotMap
+	// nodeUsed is the number of slots in use on all GPUs of the node
+	nodeUsed int32
+}
+
+// allocationDetails builds the allocation details the same way for every policy, the
+// policies embed it and only differ in where they place the slices
+type allocationDetails struct{}
+
+// first fit policy takes the first free placement in node, GPU and discovered placement order
+type FirstFitPolicy struct{ allocationDetails }
+
+// left to right policy fills the first GPU with a free placement starting from the lowest slot index
+type LeftToRightPolicy struct{ allocationDetails }
+
+// right to left policy fills the first GPU with a free placement starting from the highest slot index
+type RightToLeftPolicy struct{ allocationDetails }
+
+// spread policy balances slices across nodes and GPUs for failure isolation
+type SpreadPolicy struct{ allocationDetails }
+
+// best fit policy minimizes MIG fragmentation, it picks the placement that
+// leaves the most placements of larger profiles possible
+type BestFitPolicy struct{ allocationDetails }
+
+func (p *FirstFitPolicy) selectPlacement(_ string, candidates []placementCandidate) (placementCandidate, bool) {
+	if len(candidates) == 0 {
+		return placementCandidate{}, false
+	}
+	return candidates[0], true
+}
+
+func (p *LeftToRightPolicy) selectPlacement(_ string, candidates []placementCandidate) (placementCandidate, bool) {
+	return selectOnFirstGPU(candidates, func(a, b int32) bool { return a < b })
+}
+
+func (p *RightToLeftPolicy) selectPlacement(_ string, candidates []placementCandidate) (placementCandidate, bool) {
+	return selectOnFirstGPU(candidates, func(a, b int32) bool { return a > b })
+}
+
+// selectOnFirstGPU picks, on the GPU of the first candidate, the placement whose start
+// index comes first according to less.
+func selectOnFirstGPU(candidates []placementCandidate, less func(a, b int32) bool) (placementCandidate, bool) {
+	if len(candidates) == 0 {
+		return placementCandidate{}, false
+	}
+	best := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if candidate.instaslice.Name != best.instaslice.Name || candidate.gpuUUID != best.gpuUUID {
+			continue
+		}
+		if less(candidate.placement.Start, best.placement.Start) {
+			best = candidate
+		}
+	}
+	return best, true
+}
+
+// selectPlacement picks a placement on the least used node and, on that node, on the
+// least used GPU, so that a node or GPU failure affects as few slices as possible.
+func (p *SpreadPolicy) selectPlacement(_ string, candidates []placementCandidate) (placementCandidate, bool) {
+	var best placementCandidate
+	found := false
+	for _, candidate := range candidates {
+		if !found || candidate.nodeUsed < best.nodeUsed ||
+			(candidate.nodeUsed == best.nodeUsed && candidate.slots.used() < best.slots.used()) {
+			best, found = candidate, true
+		}
+	}
+	return best, found
+}
+
+// selectPlacement scores every candidate by the number of larger-profile placements
+// it removes from its GPU and picks the one that removes the fewest. Placing on a
+// GPU only changes what is possible on that GPU, so this is the candidate that
+// leaves the most larger-profile placements possible in the cluster. Ties go to
+// the most used GPU so that empty GPUs are kept for large profiles.
+func (p *BestFitPolicy) selectPlacement(profileName string, candidates []placementCandidate) (placementCandidate, bool) {
+	var best placementCandidate
+	found := false
+	var bestLoss, bestUsed int32
+	for _, candidate := range candidates {
+		loss := largerPlacementsLost(candidate, profileName)
+		used := candidate.slots.used()
+		if !found || loss < bestLoss || (loss == bestLoss && used > bestUsed) {
+			best, bestLoss, bestUsed, found = candidate, loss, used, true
+		}
+	}
+	return best, found
+}
+
+// largerPlacementsLost returns how many free placements of profiles larger than
+// the requested one disappear from the GPU when the candidate placement is made.
+func largerPlacementsLost(candidate placementCandidate, profileName string) int32 {
+	migPlacement := candidate.instaslice.Status.NodeResources.MigPlacement
+	after := make(slotMap, len(candidate.slots))
+	copy(after, candidate.slots)
+	after.occupy(candidate.placement)
+
+	var lost int32
+	for name, mig := range migPlacement {
+		if name == profileName {
+			continue
+		}
+		for _, placement := range mig.Placements {
+			if placement.Size <= candidate.placement.Size {
+				continue
+			}
+			if candidate.slots.isFree(placement) && !after.isFree(placement) {
+				lost++
+			}
+		}
+	}
+	return lost
+}
+
+// SetAllocationDetails builds the allocation request and result of a slice placed by the policy
+func (allocationDetails) SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName,
+	allocationStatus inferencev1alpha1.AllocationStatus, discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32,
+	namespace string, podName string, gpuUuid string, resourceIdentifier types.UID) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult) {
+	return &inferencev1alpha1.AllocationRequest{
+		Profile: profileName,
+		PodRef: v1.ObjectReference{
+			Kind:      "Pod",
+			Namespace: namespace,
+			Name:      podName,
+			UID:       podUUID,
+		},
+	}, &inferencev1alpha1.AllocationResult{
+		MigPlacement: inferencev1alpha1.Placement{
+			Size:  size,
+			Start: newStart,
+		},
+		GPUUUID:                     gpuUuid,
+		Nodename:                    nodename,
+		AllocationStatus:            allocationStatus,
+		ConfigMapResourceIdentifier: resourceIdentifier,
+		Conditions:                  []metav1.Condition{},
+	}
+}
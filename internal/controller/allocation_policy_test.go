@@ -0,0 +1,202 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+)
+
+func newTestInstaslice(name string, gpuUUIDs ...string) *inferencev1alpha1.Instaslice {
+	instaslice := &inferencev1alpha1.Instaslice{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: InstaSliceOperatorNamespace},
+		Status: inferencev1alpha1.InstasliceStatus{
+			NodeResources: inferencev1alpha1.DiscoveredNodeResources{MigPlacement: a100MigPlacement()},
+		},
+	}
+	for _, uuid := range gpuUUIDs {
+		instaslice.Status.NodeResources.NodeGPUs = append(instaslice.Status.NodeResources.NodeGPUs, inferencev1alpha1.DiscoveredGPU{GPUUUID: uuid})
+	}
+	return instaslice
+}
+
+// candidatesFor enumerates every free placement of the profile, the same way the
+// reconciler does, on GPUs whose slot maps are given.
+func candidatesFor(instaslice *inferencev1alpha1.Instaslice, profileName string, gpuSlots map[string]slotMap) []placementCandidate {
+	var candidates []placementCandidate
+	for _, gpuUUID := range sortGPUs(instaslice) {
+		slots := gpuSlots[gpuUUID]
+		for _, placement := range instaslice.Status.NodeResources.MigPlacement[profileName].Placements {
+			if slots.isFree(placement) {
+				candidates = append(candidates, placementCandidate{instaslice: instaslice, gpuUUID: gpuUUID, placement: placement, slots: slots})
+			}
+		}
+	}
+	return candidates
+}
+
+func TestBestFitPolicyPrefersPartiallyUsedGPU(t *testing.T) {
+	instaslice := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	used := newSlotMap(instaslice.Status.NodeResources.MigPlacement)
+	used.occupy(inferencev1alpha1.Placement{Start: 0, Size: 1})
+	gpuSlots := map[string]slotMap{
+		"gpu-a": newSlotMap(instaslice.Status.NodeResources.MigPlacement),
+		"gpu-b": used,
+	}
+
+	candidate, ok := (&BestFitPolicy{}).selectPlacement("1g.5gb", candidatesFor(instaslice, "1g.5gb", gpuSlots))
+	assert.True(t, ok)
+	assert.Equal(t, "gpu-b", candidate.gpuUUID, "the empty GPU must be kept for a 7g profile")
+	assert.Equal(t, int32(1), candidate.placement.Start, "slot 1 doesn't remove any larger placement")
+}
+
+func TestBestFitPolicyKeepsLargerPlacementsOnEmptyGPU(t *testing.T) {
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	gpuSlots := map[string]slotMap{"gpu-a": newSlotMap(instaslice.Status.NodeResources.MigPlacement)}
+
+	candidate, ok := (&BestFitPolicy{}).selectPlacement("1g.5gb", candidatesFor(instaslice, "1g.5gb", gpuSlots))
+	assert.True(t, ok)
+	// slot 6 is outside every 2g.10gb and 4g.20gb placement
+	assert.Equal(t, int32(6), candidate.placement.Start)
+
+	candidate, ok = (&BestFitPolicy{}).selectPlacement("2g.10gb", candidatesFor(instaslice, "2g.10gb", gpuSlots))
+	assert.True(t, ok)
+	// 2g.10gb at 4 keeps the 4g.20gb placement at 0
+	assert.Equal(t, int32(4), candidate.placement.Start)
+}
+
+func TestBestFitPolicyNoCandidates(t *testing.T) {
+	_, ok := (&BestFitPolicy{}).selectPlacement("7g.40gb", nil)
+	assert.False(t, ok)
+}
+
+func TestFirstFitPolicyTakesFirstCandidate(t *testing.T) {
+	instaslice := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	gpuSlots := map[string]slotMap{
+		"gpu-a": newSlotMap(instaslice.Status.NodeResources.MigPlacement),
+		"gpu-b": newSlotMap(instaslice.Status.NodeResources.MigPlacement),
+	}
+
+	candidate, ok := (&FirstFitPolicy{}).selectPlacement("2g.10gb", candidatesFor(instaslice, "2g.10gb", gpuSlots))
+	assert.True(t, ok)
+	assert.Equal(t, "gpu-a", candidate.gpuUUID)
+	assert.Equal(t, int32(0), candidate.placement.Start)
+
+	_, ok = (&FirstFitPolicy{}).selectPlacement("2g.10gb", nil)
+	assert.False(t, ok)
+}
+
+func TestDirectionalPoliciesFillFirstGPU(t *testing.T) {
+	instaslice := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	used := newSlotMap(instaslice.Status.NodeResources.MigPlacement)
+	used.occupy(inferencev1alpha1.Placement{Start: 0, Size: 1})
+	gpuSlots := map[string]slotMap{
+		"gpu-a": used,
+		"gpu-b": newSlotMap(instaslice.Status.NodeResources.MigPlacement),
+	}
+	candidates := candidatesFor(instaslice, "1g.5gb", gpuSlots)
+
+	candidate, ok := (&LeftToRightPolicy{}).selectPlacement("1g.5gb", candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "gpu-a", candidate.gpuUUID)
+	assert.Equal(t, int32(1), candidate.placement.Start)
+
+	candidate, ok = (&RightToLeftPolicy{}).selectPlacement("1g.5gb", candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "gpu-a", candidate.gpuUUID)
+	assert.Equal(t, int32(6), candidate.placement.Start)
+
+	_, ok = (&RightToLeftPolicy{}).selectPlacement("1g.5gb", nil)
+	assert.False(t, ok)
+}
+
+func TestSpreadPolicyBalancesNodesAndGPUs(t *testing.T) {
+	node1 := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	node2 := newTestInstaslice("node-2", "gpu-c", "gpu-d")
+	used := newSlotMap(node1.Status.NodeResources.MigPlacement)
+	used.occupy(inferencev1alpha1.Placement{Start: 0, Size: 2})
+	partial := newSlotMap(node1.Status.NodeResources.MigPlacement)
+	partial.occupy(inferencev1alpha1.Placement{Start: 0, Size: 1})
+
+	var candidates []placementCandidate
+	for _, c := range candidatesFor(node1, "1g.5gb", map[string]slotMap{"gpu-a": used, "gpu-b": newSlotMap(node1.Status.NodeResources.MigPlacement)}) {
+		c.nodeUsed = 2
+		candidates = append(candidates, c)
+	}
+	for _, c := range candidatesFor(node2, "1g.5gb", map[string]slotMap{"gpu-c": partial, "gpu-d": newSlotMap(node2.Status.NodeResources.MigPlacement)}) {
+		c.nodeUsed = 1
+		candidates = append(candidates, c)
+	}
+
+	candidate, ok := (&SpreadPolicy{}).selectPlacement("1g.5gb", candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "node-2", candidate.instaslice.Name, "node-2 has fewer slices")
+	assert.Equal(t, "gpu-d", candidate.gpuUUID, "gpu-d is empty")
+	assert.Equal(t, int32(0), candidate.placement.Start)
+}
+
+func TestAllocationPolicyForPod(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	inference := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "inference", Labels: map[string]string{AllocationPolicyLabel: SpreadPolicyName}}}
+	r := &InstasliceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(inference).Build(),
+		Config: &config.Config{AllocationPolicy: BestFitPolicyName},
+	}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		annotations map[string]string
+		expected    AllocationPolicy
+	}{
+		{"cluster default", "default", nil, &BestFitPolicy{}},
+		{"namespace label", "inference", nil, &SpreadPolicy{}},
+		{"pod annotation", "inference", map[string]string{AllocationPolicyAnnotation: RightToLeftPolicyName}, &RightToLeftPolicy{}},
+		{"invalid pod annotation falls back to the namespace", "inference", map[string]string{AllocationPolicyAnnotation: "tightest"}, &SpreadPolicy{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: tt.namespace, Annotations: tt.annotations}}
+			policy, err := r.allocationPolicyForPod(context.TODO(), pod)
+			assert.NoError(t, err)
+			assert.IsType(t, tt.expected, policy)
+		})
+	}
+
+	policy, err := (&InstasliceReconciler{Client: r.Client}).allocationPolicyForPod(context.TODO(), &v1.Pod{})
+	assert.NoError(t, err)
+	assert.IsType(t, &FirstFitPolicy{}, policy, "first fit without a config")
+}
+
+func TestGetAllocationPolicy(t *testing.T) {
+	for _, name := range AllocationPolicyNames() {
+		policy, err := GetAllocationPolicy(name)
+		assert.NoError(t, err)
+		assert.NotNil(t, policy)
+	}
+	_, err := GetAllocationPolicy("tightest")
+	assert.Error(t, err)
+}
@@ -17,9 +17,15 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilcache "k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
@@ -29,69 +35,273 @@ import (
 // takes time to propagate and often causes controller to assign same slice
 // to multiple pods.
 
+// The cache is rebuilt from the Instaslice objects on the next placement once invalidated:
+// when leadership is acquired, when a node goes down or comes back and when the node resources of an
+// Instaslice change underneath it. It is also checked against the Instaslice objects
+// periodically, divergences are counted by a metric and the cache is rebuilt.
+
+// Kinds of the divergences between the cache and the Instaslice objects
+const (
+	cacheDivergenceMissing    = "missing"
+	cacheDivergenceStale      = "stale"
+	cacheDivergenceMismatched = "mismatched"
+)
+
+// rebuildAllocationCache rebuilds the cache from the Instaslice objects once it was
+// invalidated. The objects are listed without holding allocationMu, they are listed again
+// while holding it when the cache changed in the meantime. The caller doesn't hold
+// allocationMu.
 func (r *InstasliceReconciler) rebuildAllocationCache(ctx context.Context) error {
-	// Only rebuild if the cache is empty (indicating a controller restart)
-	if r.isCacheInitialized {
+	r.allocationMu.Lock()
+	initialized, version := r.isCacheInitialized, r.cacheVersion
+	r.allocationMu.Unlock()
+	// Only rebuild if the cache was invalidated
+	if initialized {
 		return nil
 	}
 
-	// Fetch all Instaslice objects in the cluster
 	// TODO: cache is rebuilt on node failure we should
 	// avoid instaslice objects that are related to failed
 	// nodes in the cluster.
-	// Fetch all Instaslice objects using the lister
+	instaslices, err := r.listAllocationInstaslices(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.allocationMu.Lock()
+	defer r.allocationMu.Unlock()
+	if r.isCacheInitialized {
+		return nil
+	}
+	if r.cacheVersion != version {
+		// allocations were made or released while listing, the objects listed may miss them
+		if instaslices, err = r.listAllocationInstaslices(ctx); err != nil {
+			return err
+		}
+	}
+	r.allocationCache = cachedAllocations(instaslices.Items)
+	// the allocations being stored by other reconciles are not listed yet
+	for podUid, allocResult := range r.reserving {
+		r.allocationCache[podUid] = allocResult
+	}
+
+	r.isCacheInitialized = true
+	r.cacheSuspects = nil
+	return nil
+}
+
+// listAllocationInstaslices lists the Instaslice objects the cache is rebuilt from
+func (r *InstasliceReconciler) listAllocationInstaslices(ctx context.Context) (*inferencev1alpha1.InstasliceList, error) {
 	instaslices := &inferencev1alpha1.InstasliceList{}
 	// Use cached informer to list Instaslice objects
 	if err := r.Client.List(ctx, instaslices, client.InNamespace(InstaSliceOperatorNamespace)); err != nil {
 		log.FromContext(ctx).Error(err, "Error listing Instaslice objects from cache")
-		return err
+		return nil, err
 	}
+	return instaslices, nil
+}
 
-	r.allocationCache = make(map[types.UID]inferencev1alpha1.AllocationResult)
-
-	for _, instaslice := range instaslices.Items {
+// cachedAllocations returns the allocations of the Instaslice objects that hold slots
+func cachedAllocations(instaslices []inferencev1alpha1.Instaslice) map[types.UID]inferencev1alpha1.AllocationResult {
+	allocations := make(map[types.UID]inferencev1alpha1.AllocationResult)
+	for _, instaslice := range instaslices {
 		for podUid, allocResult := range instaslice.Status.PodAllocationResults {
 			if allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
 				continue
 			}
-			r.allocationCache[podUid] = allocResult
+			// the slots of recycled allocations are held by the allocation they were handed over to
+			if allocationRecycled(allocResult) {
+				continue
+			}
+			allocations[podUid] = allocResult
 		}
 	}
+	return allocations
+}
 
-	r.isCacheInitialized = true
-	return nil
+// invalidateAllocationCache makes the next placement rebuild the cache
+func (r *InstasliceReconciler) invalidateAllocationCache() {
+	r.allocationMu.Lock()
+	defer r.allocationMu.Unlock()
+	r.isCacheInitialized = false
+	r.cacheVersion++
 }
 
-func (r *InstasliceReconciler) updateCacheWithNewAllocation(podUid types.UID, allocResult inferencev1alpha1.AllocationResult) {
+func (r *InstasliceReconciler) cacheCheckInterval() time.Duration {
+	if r.Config != nil && r.Config.CacheCheckInterval > 0 {
+		return r.Config.CacheCheckInterval
+	}
+	return config.DefaultCacheCheckInterval
+}
 
-	r.allocationCache[podUid] = allocResult
+// runAllocationCacheCheck rebuilds the cache, the runnable is started once leadership is
+// acquired so that nothing placed before is trusted, then checks it until the context is done
+func (r *InstasliceReconciler) runAllocationCacheCheck(ctx context.Context) error {
+	r.invalidateAllocationCache()
+	if err := r.rebuildAllocationCache(ctx); err != nil {
+		log.FromContext(ctx).Error(err, "failed to rebuild the allocation cache on leader election")
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.checkAllocationCache(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "failed to check the allocation cache")
+		}
+	}, r.cacheCheckInterval())
+	return nil
 }
 
-// clean allocations that do not exists in spec
-// TODO fix scalability issue, loops over all instaslice objects in the cluster
-func (r *InstasliceReconciler) CleanupOrphanedAllocations(ctx context.Context, instasliceList *inferencev1alpha1.InstasliceList) {
-	var keysToDelete []types.UID
+// checkAllocationCache compares the cache with the allocations of the Instaslice objects. The
+// objects listed can lag behind the allocations just stored, so an allocation diverges when
+// it is found diverging by two checks in a row. Divergences are counted by kind and the cache
+// is rebuilt.
+func (r *InstasliceReconciler) checkAllocationCache(ctx context.Context) error {
+	instaslices := &inferencev1alpha1.InstasliceList{}
+	if err := r.Client.List(ctx, instaslices, client.InNamespace(InstaSliceOperatorNamespace)); err != nil {
+		return err
+	}
+	stored := make(map[types.UID]bool)
+	for _, instaslice := range instaslices.Items {
+		for key := range instaslice.Status.PodAllocationResults {
+			stored[key] = true
+		}
+	}
+	expected := cachedAllocations(instaslices.Items)
 
-	for uuid := range r.allocationCache {
-		found := false
-		for _, instaslice := range instasliceList.Items {
-			// Fetch latest Instaslice state before updating metrics
-			updatedInstaslice, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
-			if err != nil {
-				log.FromContext(ctx).Error(err, "Failed to get latest Instaslice object", "instaslice", instaslice.Name)
+	r.allocationMu.Lock()
+	if !r.isCacheInitialized {
+		r.allocationMu.Unlock()
+		return nil
+	}
+	suspects := make(map[types.UID]string)
+	for key, allocResult := range expected {
+		cached, ok := r.allocationCache[key]
+		switch {
+		case !ok:
+			suspects[key] = cacheDivergenceMissing
+		case cached.Nodename != allocResult.Nodename || cached.GPUUUID != allocResult.GPUUUID || cached.MigPlacement != allocResult.MigPlacement:
+			suspects[key] = cacheDivergenceMismatched
+		}
+	}
+	for key := range r.allocationCache {
+		if _, reserving := r.reserving[key]; !reserving && !stored[key] {
+			suspects[key] = cacheDivergenceStale
+		}
+	}
+	diverged := false
+	for key, kind := range suspects {
+		if r.cacheSuspects[key] != kind {
+			continue
+		}
+		instasliceMetrics.cacheDivergences.WithLabelValues(kind).Inc()
+		log.FromContext(ctx).Info("allocation cache diverged from the Instaslice objects", "key", key, "kind", kind)
+		diverged = true
+	}
+	r.cacheSuspects = suspects
+	r.allocationMu.Unlock()
+	if !diverged {
+		return nil
+	}
+	r.invalidateAllocationCache()
+	return r.rebuildAllocationCache(ctx)
+}
+
+// instasliceEventHandler invalidates the cache when an Instaslice changes underneath it: other
+// GPUs or placements were discovered on its node, or it was deleted. Allocations are kept in
+// the cache as they are made and released, the health of the GPUs doesn't change them.
+func (r *InstasliceReconciler) instasliceEventHandler() utilcache.ResourceEventHandlerFuncs {
+	return utilcache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldInstaslice, okOld := oldObj.(*inferencev1alpha1.Instaslice)
+			newInstaslice, okNew := newObj.(*inferencev1alpha1.Instaslice)
+			if !okOld || !okNew || !gpusRediscovered(&oldInstaslice.Status.NodeResources, &newInstaslice.Status.NodeResources) {
 				return
 			}
-			if _, exists := updatedInstaslice.Spec.PodAllocationRequests[uuid]; exists {
-				found = true
-				break
+			r.invalidateAllocationCache()
+		},
+		DeleteFunc: func(obj interface{}) {
+			r.invalidateAllocationCache()
+		},
+	}
+}
+
+// nodeEventHandler invalidates the cache when the Ready condition of a node changes, the
+// allocations of a node going down or coming back are read again from the Instaslice objects
+func (r *InstasliceReconciler) nodeEventHandler() utilcache.ResourceEventHandlerFuncs {
+	return utilcache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, okOld := oldObj.(*v1.Node)
+			newNode, okNew := newObj.(*v1.Node)
+			if !okOld || !okNew || nodeReady(oldNode) == nodeReady(newNode) {
+				return
 			}
+			r.invalidateAllocationCache()
+		},
+	}
+}
+
+// nodeReady reports whether the Ready condition of the node is true
+func nodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
 		}
-		if !found {
-			keysToDelete = append(keysToDelete, uuid)
+	}
+	return false
+}
+
+// gpusRediscovered reports whether the node resources hold other GPUs or MIG placements
+func gpusRediscovered(oldResources, newResources *inferencev1alpha1.DiscoveredNodeResources) bool {
+	if len(oldResources.NodeGPUs) != len(newResources.NodeGPUs) {
+		return true
+	}
+	for i := range oldResources.NodeGPUs {
+		if oldResources.NodeGPUs[i].GPUUUID != newResources.NodeGPUs[i].GPUUUID {
+			return true
+		}
+	}
+	return !equality.Semantic.DeepEqual(oldResources.MigPlacement, newResources.MigPlacement)
+}
+
+func (r *InstasliceReconciler) updateCacheWithNewAllocation(podUid types.UID, allocResult inferencev1alpha1.AllocationResult) {
+
+	r.allocationCache[podUid] = allocResult
+	r.cacheVersion++
+}
+
+// forgetCachedAllocation removes the allocation from the cache, the caller holds allocationMu
+func (r *InstasliceReconciler) forgetCachedAllocation(key types.UID) {
+	delete(r.allocationCache, key)
+	r.cacheVersion++
+}
+
+// CleanupOrphanedAllocations removes from the cache the allocations whose request is gone
+// from the Instaslice objects. The objects are read without holding allocationMu, nothing is
+// removed when the cache changed in the meantime. The caller doesn't hold allocationMu.
+func (r *InstasliceReconciler) CleanupOrphanedAllocations(ctx context.Context, instasliceList *inferencev1alpha1.InstasliceList) {
+	r.allocationMu.Lock()
+	version := r.cacheVersion
+	r.allocationMu.Unlock()
+	// Fetch latest Instaslice state once per object
+	keys := make(map[types.UID]bool)
+	for _, instaslice := range instasliceList.Items {
+		updatedInstaslice, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Failed to get latest Instaslice object", "instaslice", instaslice.Name)
+			return
+		}
+		for key := range updatedInstaslice.Spec.PodAllocationRequests {
+			keys[key] = true
 		}
 	}
 
-	for _, uuid := range keysToDelete {
-		delete(r.allocationCache, uuid)
+	r.allocationMu.Lock()
+	defer r.allocationMu.Unlock()
+	if r.cacheVersion != version {
+		// the requests read may miss the allocations just stored
+		return
+	}
+	for uuid := range r.allocationCache {
+		if _, ok := r.reserving[uuid]; !ok && !keys[uuid] {
+			delete(r.allocationCache, uuid)
+		}
 	}
 }
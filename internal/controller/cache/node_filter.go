@@ -0,0 +1,115 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/klog/v2"
+)
+
+// nodeNameField is the only field supported by the matchFields of node selector terms
+const nodeNameField = "metadata.name"
+
+// Schedulable reports whether the pod can be scheduled to the node as far as its nodeSelector,
+// its required node affinity and the NoSchedule and NoExecute taints of the node are concerned.
+func (c *ResourceCache) Schedulable(nodeName string, pod *v1.Pod) bool {
+	c.RLock()
+	ni, ok := c.nodes[nodeName]
+	c.RUnlock()
+	if !ok {
+		klog.Infof("Schedulable: node %q not found in cache", nodeName)
+		return false
+	}
+
+	if !labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(ni.Labels)) {
+		klog.V(2).Infof("Schedulable: node %s doesn't match the nodeSelector of pod %s/%s", nodeName, pod.Namespace, pod.Name)
+		return false
+	}
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil &&
+			!nodeSelectorMatches(required, nodeName, ni.Labels) {
+			klog.V(2).Infof("Schedulable: node %s doesn't match the required node affinity of pod %s/%s", nodeName, pod.Namespace, pod.Name)
+			return false
+		}
+	}
+	for i := range ni.Taints {
+		taint := &ni.Taints[i]
+		if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+			continue
+		}
+		if !toleratesTaint(pod.Spec.Tolerations, taint) {
+			klog.V(2).Infof("Schedulable: pod %s/%s doesn't tolerate taint %s of node %s", pod.Namespace, pod.Name, taint.ToString(), nodeName)
+			return false
+		}
+	}
+	return true
+}
+
+// nodeSelectorMatches reports whether one of the terms of the node selector matches the node,
+// a term without requirements matches no node.
+func nodeSelectorMatches(nodeSelector *v1.NodeSelector, nodeName string, nodeLabels map[string]string) bool {
+	for _, term := range nodeSelector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if requirementsMatch(term.MatchExpressions, nodeLabels) &&
+			requirementsMatch(term.MatchFields, map[string]string{nodeNameField: nodeName}) {
+			return true
+		}
+	}
+	return false
+}
+
+// requirementsMatch reports whether all the requirements match the given labels or fields
+func requirementsMatch(requirements []v1.NodeSelectorRequirement, set map[string]string) bool {
+	for _, requirement := range requirements {
+		var op selection.Operator
+		switch requirement.Operator {
+		case v1.NodeSelectorOpIn:
+			op = selection.In
+		case v1.NodeSelectorOpNotIn:
+			op = selection.NotIn
+		case v1.NodeSelectorOpExists:
+			op = selection.Exists
+		case v1.NodeSelectorOpDoesNotExist:
+			op = selection.DoesNotExist
+		case v1.NodeSelectorOpGt:
+			op = selection.GreaterThan
+		case v1.NodeSelectorOpLt:
+			op = selection.LessThan
+		default:
+			return false
+		}
+		r, err := labels.NewRequirement(requirement.Key, op, requirement.Values)
+		if err != nil || !r.Matches(labels.Set(set)) {
+			return false
+		}
+	}
+	return true
+}
+
+// toleratesTaint reports whether one of the tolerations tolerates the taint
+func toleratesTaint(tolerations []v1.Toleration, taint *v1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSchedulable(t *testing.T) {
+	rc := NewResourceCache()
+	h := rc.ResourceEventHandlerForNode()
+
+	zoneA := n("zone-a")
+	zoneA.Labels = map[string]string{"kubernetes.io/hostname": "zone-a", "topology.kubernetes.io/zone": "a", "gpu-count": "4"}
+	h.AddFunc(zoneA)
+
+	tainted := n("tainted")
+	tainted.Labels = map[string]string{"kubernetes.io/hostname": "tainted", "topology.kubernetes.io/zone": "b", "gpu-count": "8"}
+	tainted.Spec.Taints = []v1.Taint{
+		{Key: "pool", Value: "training", Effect: v1.TaintEffectNoSchedule},
+		{Key: "spot", Effect: v1.TaintEffectPreferNoSchedule},
+	}
+	h.AddFunc(tainted)
+
+	zoneAffinity := func(op v1.NodeSelectorOperator, values ...string) *v1.Affinity {
+		return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: op, Values: values}},
+			}}},
+		}}
+	}
+	toleration := []v1.Toleration{{Key: "pool", Operator: v1.TolerationOpEqual, Value: "training", Effect: v1.TaintEffectNoSchedule}}
+
+	cases := []struct {
+		name string
+		spec v1.PodSpec
+		want map[string]bool
+	}{
+		{
+			name: "no constraints",
+			want: map[string]bool{"zone-a": true, "tainted": false},
+		},
+		{
+			name: "toleration",
+			spec: v1.PodSpec{Tolerations: toleration},
+			want: map[string]bool{"zone-a": true, "tainted": true},
+		},
+		{
+			name: "nodeSelector",
+			spec: v1.PodSpec{NodeSelector: map[string]string{"topology.kubernetes.io/zone": "b"}, Tolerations: toleration},
+			want: map[string]bool{"zone-a": false, "tainted": true},
+		},
+		{
+			name: "hostname nodeSelector",
+			spec: v1.PodSpec{NodeSelector: map[string]string{"kubernetes.io/hostname": "zone-a"}, Tolerations: toleration},
+			want: map[string]bool{"zone-a": true, "tainted": false},
+		},
+		{
+			name: "affinity In",
+			spec: v1.PodSpec{Affinity: zoneAffinity(v1.NodeSelectorOpIn, "a", "c"), Tolerations: toleration},
+			want: map[string]bool{"zone-a": true, "tainted": false},
+		},
+		{
+			name: "affinity NotIn",
+			spec: v1.PodSpec{Affinity: zoneAffinity(v1.NodeSelectorOpNotIn, "a"), Tolerations: toleration},
+			want: map[string]bool{"zone-a": false, "tainted": true},
+		},
+		{
+			name: "affinity Gt",
+			spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{Key: "gpu-count", Operator: v1.NodeSelectorOpGt, Values: []string{"6"}}},
+				}}},
+			}}, Tolerations: toleration},
+			want: map[string]bool{"zone-a": false, "tainted": true},
+		},
+		{
+			name: "affinity matchFields",
+			spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{
+					{MatchExpressions: []v1.NodeSelectorRequirement{{Key: "topology.kubernetes.io/zone", Operator: v1.NodeSelectorOpIn, Values: []string{"c"}}}},
+					{MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.name", Operator: v1.NodeSelectorOpIn, Values: []string{"tainted"}}}},
+				}},
+			}}, Tolerations: toleration},
+			want: map[string]bool{"zone-a": false, "tainted": true},
+		},
+		{
+			name: "empty affinity term",
+			spec: v1.PodSpec{Affinity: &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: []v1.NodeSelectorTerm{{}}},
+			}}},
+			want: map[string]bool{"zone-a": false, "tainted": false},
+		},
+	}
+
+	for _, tc := range cases {
+		pod := &v1.Pod{Spec: tc.spec}
+		pod.Name = tc.name
+		for node, want := range tc.want {
+			if got := rc.Schedulable(node, pod); got != want {
+				t.Errorf("%s: Schedulable(%s) = %v, want %v", tc.name, node, got, want)
+			}
+		}
+	}
+
+	if rc.Schedulable("unknown", &v1.Pod{}) {
+		t.Errorf("unknown nodes must not be schedulable")
+	}
+
+	// taints and labels follow node updates
+	untainted := tainted.DeepCopy()
+	untainted.Spec.Taints = nil
+	h.UpdateFunc(tainted, untainted)
+	if !rc.Schedulable("tainted", &v1.Pod{}) {
+		t.Errorf("the node is no longer tainted")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"sync"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/labels"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	utilcache "k8s.io/client-go/tools/cache"
@@ -39,41 +40,76 @@ type LocalResource struct {
 type LocalNodeInfo struct {
 	Requested   LocalResource
 	Allocatable LocalResource
+	// Labels and Taints of the node, to check the node selection constraints of pods
+	Labels map[string]string
+	Taints []v1.Taint
 }
 
 type ResourceCache struct {
 	sync.RWMutex
 	nodes map[string]*LocalNodeInfo
+	// freedListeners are called with the name of a node whose capacity was freed
+	freedListeners []func(nodeName string)
 }
 
 func NewResourceCache() *ResourceCache {
 	return &ResourceCache{nodes: map[string]*LocalNodeInfo{}}
 }
 
+// OnCapacityFreed registers a function called with the name of a node that may accept more
+// pods: it joined, its allocatable resources grew, its labels or taints changed, or a pod left
+// it. The function is called from the informer handlers, without the lock of the cache held.
+func (c *ResourceCache) OnCapacityFreed(fn func(nodeName string)) {
+	c.Lock()
+	defer c.Unlock()
+	c.freedListeners = append(c.freedListeners, fn)
+}
+
+func (c *ResourceCache) notifyCapacityFreed(nodeName string) {
+	c.RLock()
+	listeners := c.freedListeners
+	c.RUnlock()
+	for _, fn := range listeners {
+		fn(nodeName)
+	}
+}
+
 func (c *ResourceCache) ResourceEventHandlerForNode() utilcache.ResourceEventHandlerFuncs {
 	return utilcache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			n := obj.(*v1.Node)
 			c.Lock()
-			defer c.Unlock()
-
 			alloc := convertToLocalResource(n.Status.Allocatable)
 			c.nodes[n.Name] = &LocalNodeInfo{
 				Allocatable: alloc,
+				Labels:      n.Labels,
+				Taints:      n.Spec.Taints,
 			}
+			c.Unlock()
 			klog.V(1).Infof("Node added: %s Allocatable: CPU=%v Mem=%v Storage=%v EphemeralStorage=%v",
 				n.Name, alloc.MilliCPU, alloc.Memory, alloc.Storage, alloc.EphemeralStorage)
+			c.notifyCapacityFreed(n.Name)
 		},
 
 		UpdateFunc: func(_, newObj interface{}) {
 			n := newObj.(*v1.Node)
 			c.Lock()
-			defer c.Unlock()
-			if ni, ok := c.nodes[n.Name]; ok {
+			ni, ok := c.nodes[n.Name]
+			freed := false
+			if ok {
 				alloc := convertToLocalResource(n.Status.Allocatable)
+				freed = alloc.MilliCPU > ni.Allocatable.MilliCPU || alloc.Memory > ni.Allocatable.Memory ||
+					alloc.Storage > ni.Allocatable.Storage || alloc.EphemeralStorage > ni.Allocatable.EphemeralStorage ||
+					!equality.Semantic.DeepEqual(ni.Labels, n.Labels) || !equality.Semantic.DeepEqual(ni.Taints, n.Spec.Taints)
 				ni.Allocatable = alloc
+				ni.Labels = n.Labels
+				ni.Taints = n.Spec.Taints
 				klog.V(2).Infof("Node updated: %s", n.Name)
 			}
+			c.Unlock()
+			if freed {
+				c.notifyCapacityFreed(n.Name)
+			}
 		},
 
 		DeleteFunc: func(obj interface{}) {
@@ -177,14 +213,18 @@ func (c *ResourceCache) addPodToNode(p *v1.Pod) {
 
 func (c *ResourceCache) removePodFromNode(p *v1.Pod) {
 	c.Lock()
-	defer c.Unlock()
-	if ni, ok := c.nodes[p.Spec.NodeName]; ok {
+	ni, ok := c.nodes[p.Spec.NodeName]
+	if ok {
 		req, _ := kuResource.PodRequestsAndLimits(p)
 		ni.Requested.MilliCPU -= req.Cpu().MilliValue()
 		ni.Requested.Memory -= req.Memory().Value()
 		ni.Requested.Storage -= req.Storage().Value()
 		ni.Requested.EphemeralStorage -= req.StorageEphemeral().Value()
 	}
+	c.Unlock()
+	if ok {
+		c.notifyCapacityFreed(p.Spec.NodeName)
+	}
 }
 
 func (c *ResourceCache) Rebuild(
@@ -206,6 +246,8 @@ func (c *ResourceCache) Rebuild(
 				Storage:          alloc.Storage,
 				EphemeralStorage: alloc.EphemeralStorage,
 			},
+			Labels: n.Labels,
+			Taints: n.Spec.Taints,
 		}
 	}
 
@@ -279,6 +321,34 @@ func (c *ResourceCache) Fits(nodeName string, pod *v1.Pod) bool {
 	return fits
 }
 
+// Insufficient returns the resources the node doesn't have enough of to run the pod, nil
+// when it fits. The boolean is false when the node isn't in the cache.
+func (c *ResourceCache) Insufficient(nodeName string, pod *v1.Pod) ([]v1.ResourceName, bool) {
+	req, _ := kuResource.PodRequestsAndLimits(pod)
+
+	c.RLock()
+	ni, ok := c.nodes[nodeName]
+	c.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	var insufficient []v1.ResourceName
+	if ni.Allocatable.MilliCPU-ni.Requested.MilliCPU < req.Cpu().MilliValue() {
+		insufficient = append(insufficient, v1.ResourceCPU)
+	}
+	if ni.Allocatable.Memory-ni.Requested.Memory < req.Memory().Value() {
+		insufficient = append(insufficient, v1.ResourceMemory)
+	}
+	if ni.Allocatable.Storage-ni.Requested.Storage < req.Storage().Value() {
+		insufficient = append(insufficient, v1.ResourceStorage)
+	}
+	if ni.Allocatable.EphemeralStorage-ni.Requested.EphemeralStorage < req.StorageEphemeral().Value() {
+		insufficient = append(insufficient, v1.ResourceEphemeralStorage)
+	}
+	return insufficient, true
+}
+
 func convertToLocalResource(res v1.ResourceList) LocalResource {
 	cpuQty := res[v1.ResourceCPU]
 	memQty := res[v1.ResourceMemory]
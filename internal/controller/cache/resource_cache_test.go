@@ -378,3 +378,70 @@ func TestResourceCacheConcurrencySafety(t *testing.T) {
 
 	// If the test runs without panic or data race, it passes.
 }
+
+func TestInsufficient(t *testing.T) {
+	rc := NewResourceCache()
+	rc.ResourceEventHandlerForNode().AddFunc(n("nodeA"))
+	rc.ResourceEventHandlerForPod().AddFunc(newPod("ns", "running", "nodeA", "3000m", "2Gi", "0", "0", v1.PodRunning))
+
+	cases := []struct {
+		name string
+		pod  *v1.Pod
+		want []v1.ResourceName
+	}{
+		{"fits", newPod("ns", "small", "", "500m", "1Gi", "0", "0", v1.PodPending), nil},
+		{"cpu", newPod("ns", "cpu", "", "2000m", "1Gi", "0", "0", v1.PodPending), []v1.ResourceName{v1.ResourceCPU}},
+		{"cpu and memory", newPod("ns", "big", "", "2000m", "7Gi", "0", "0", v1.PodPending), []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory}},
+		{"ephemeral storage", newPod("ns", "scratch", "", "0", "0", "0", "60Gi", v1.PodPending), []v1.ResourceName{v1.ResourceEphemeralStorage}},
+	}
+	for _, tc := range cases {
+		got, ok := rc.Insufficient("nodeA", tc.pod)
+		if !ok {
+			t.Fatalf("%s: nodeA not found", tc.name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: Insufficient = %v, want %v", tc.name, got, tc.want)
+		}
+		if fits := rc.Fits("nodeA", tc.pod); fits != (len(tc.want) == 0) {
+			t.Errorf("%s: Fits = %v disagrees with Insufficient %v", tc.name, fits, got)
+		}
+	}
+
+	if _, ok := rc.Insufficient("unknown", &v1.Pod{}); ok {
+		t.Errorf("unknown nodes must not be found")
+	}
+}
+
+func TestOnCapacityFreed(t *testing.T) {
+	rc := NewResourceCache()
+	var freed []string
+	rc.OnCapacityFreed(func(nodeName string) { freed = append(freed, nodeName) })
+	nh := rc.ResourceEventHandlerForNode()
+	ph := rc.ResourceEventHandlerForPod()
+
+	node := n("nodeA")
+	nh.AddFunc(node)
+	p := newPod("default", "p", "nodeA", "1000m", "1Gi", "1Gi", "1Gi", v1.PodRunning)
+	ph.AddFunc(p)
+	if len(freed) != 1 || freed[0] != "nodeA" {
+		t.Fatalf("expected a notification for the added node, got %v", freed)
+	}
+
+	shrunk := node.DeepCopy()
+	shrunk.Status.Allocatable[v1.ResourceCPU] = resource.MustParse("2000m")
+	nh.UpdateFunc(node, shrunk)
+	if len(freed) != 1 {
+		t.Errorf("shrinking a node must not notify, got %v", freed)
+	}
+	nh.UpdateFunc(shrunk, node)
+	if len(freed) != 2 {
+		t.Errorf("growing a node must notify, got %v", freed)
+	}
+
+	done := p.DeepCopy()
+	done.Status.Phase = v1.PodSucceeded
+	ph.UpdateFunc(p, done)
+	if len(freed) != 3 || freed[2] != "nodeA" {
+		t.Errorf("expected a notification for the completed pod, got %v", freed)
+	}
+}
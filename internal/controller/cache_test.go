@@ -0,0 +1,118 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+func TestCheckAllocationCacheRebuildsOnDivergence(t *testing.T) {
+	instasliceMetrics.cacheDivergences.Reset()
+	cached := newPriorityPod("cached", 0, "1g.5gb", false)
+	missing := newPriorityPod("missing", 0, "1g.5gb", false)
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withRunningSlice(instaslice, cached, "gpu-a", 0)
+	withRunningSlice(instaslice, missing, "gpu-a", 1)
+	r := newTestReconciler(instaslice, cached, missing)
+	r.allocationCache[cached.UID] = instaslice.Status.PodAllocationResults[cached.UID]
+	r.allocationCache["released"] = instaslice.Status.PodAllocationResults[missing.UID]
+	r.allocationCache["reserving"] = instaslice.Status.PodAllocationResults[missing.UID]
+	r.reserving = map[types.UID]inferencev1alpha1.AllocationResult{"reserving": instaslice.Status.PodAllocationResults[missing.UID]}
+
+	// the objects listed may lag behind, the first check only suspects the divergence
+	assert.NoError(t, r.checkAllocationCache(context.TODO()))
+	assert.Contains(t, r.allocationCache, types.UID("released"))
+	assert.Equal(t, map[types.UID]string{missing.UID: cacheDivergenceMissing, "released": cacheDivergenceStale}, r.cacheSuspects)
+
+	assert.NoError(t, r.checkAllocationCache(context.TODO()))
+	assert.Equal(t, 1.0, testutil.ToFloat64(instasliceMetrics.cacheDivergences.WithLabelValues(cacheDivergenceMissing)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(instasliceMetrics.cacheDivergences.WithLabelValues(cacheDivergenceStale)))
+	assert.True(t, r.isCacheInitialized)
+	assert.Contains(t, r.allocationCache, missing.UID, "the cache is rebuilt")
+	assert.NotContains(t, r.allocationCache, types.UID("released"))
+	assert.Contains(t, r.allocationCache, types.UID("reserving"), "reservations in flight are kept")
+
+	assert.NoError(t, r.checkAllocationCache(context.TODO()))
+	assert.Empty(t, r.cacheSuspects)
+	assert.Equal(t, 0.0, testutil.ToFloat64(instasliceMetrics.cacheDivergences.WithLabelValues(cacheDivergenceMismatched)))
+}
+
+func TestInstasliceEventHandlerInvalidatesCache(t *testing.T) {
+	pod := newPriorityPod("inference", 0, "1g.5gb", false)
+	oldInstaslice := newTestInstaslice("node-1", "gpu-a")
+	r := newTestReconciler(oldInstaslice)
+	handler := r.instasliceEventHandler()
+
+	// allocations are tracked by the cache itself
+	allocated := withRunningSlice(oldInstaslice.DeepCopy(), pod, "gpu-a", 0)
+	handler.OnUpdate(oldInstaslice, allocated)
+	assert.True(t, r.isCacheInitialized)
+
+	// the health of the GPUs and the boot ID don't change the allocations
+	unhealthy := allocated.DeepCopy()
+	unhealthy.Status.NodeResources.BootID = "rebooted"
+	unhealthy.Status.NodeResources.NodeGPUs[0].Conditions = []metav1.Condition{{Type: GPUHealthyCondition, Status: metav1.ConditionFalse}}
+	handler.OnUpdate(allocated, unhealthy)
+	assert.True(t, r.isCacheInitialized)
+
+	replaced := unhealthy.DeepCopy()
+	replaced.Status.NodeResources.NodeGPUs[0].GPUUUID = "gpu-b"
+	handler.OnUpdate(unhealthy, replaced)
+	assert.False(t, r.isCacheInitialized)
+
+	r.isCacheInitialized = true
+	rediscovered := replaced.DeepCopy()
+	delete(rediscovered.Status.NodeResources.MigPlacement, "7g.40gb")
+	handler.OnUpdate(replaced, rediscovered)
+	assert.False(t, r.isCacheInitialized)
+
+	r.isCacheInitialized = true
+	handler.OnDelete(rediscovered)
+	assert.False(t, r.isCacheInitialized)
+}
+
+func TestNodeEventHandlerInvalidatesCache(t *testing.T) {
+	r := newTestReconciler()
+	handler := r.nodeEventHandler()
+	ready := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}},
+	}
+	notReady := ready.DeepCopy()
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+
+	handler.OnUpdate(ready, notReady)
+	assert.False(t, r.isCacheInitialized)
+
+	// updates that keep the readiness of the node don't touch the cache
+	r.isCacheInitialized = true
+	labeled := notReady.DeepCopy()
+	labeled.Labels = map[string]string{"zone": "a"}
+	handler.OnUpdate(notReady, labeled)
+	assert.True(t, r.isCacheInitialized)
+
+	handler.OnUpdate(labeled, ready)
+	assert.False(t, r.isCacheInitialized)
+}
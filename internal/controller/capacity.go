@@ -22,57 +22,209 @@ import (
 	"sort"
 
 	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // checks the classical resources like CPU and memory and continuous GPU index available
 // before making an allocation.
 
-// find node, gpu and gpu index to place the slice
-func (r *InstasliceReconciler) findNodeAndDeviceForASlice(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, profileName string, policy AllocationPolicy, pod *v1.Pod) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult, error) {
-	updatedInstaSliceObject, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
-	if err != nil {
-		return nil, nil, err
+// findNodeAndDeviceForPod finds the node, gpu and gpu index to place every slice requested
+// by the pod. The policy picks one of the free placements found on the nodes for the first
+// slice, the other slices are placed by the policy on the same node. When they don't fit the
+// node is skipped. It returns the instaslice object of the selected node and the allocations
+// by key.
+func (r *InstasliceReconciler) findNodeAndDeviceForPod(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, slices []sliceRequest, policy AllocationPolicy, pod *v1.Pod) (*inferencev1alpha1.Instaslice, map[types.UID]utils.Allocation, error) {
+	if len(slices) == 0 {
+		return nil, nil, fmt.Errorf("no slice requested by pod %s", pod.Name)
 	}
+	// allocations already exist in cache, reuse them
+	if instaslice, allocations, err := r.cachedPodAllocations(ctx, instaslices, slices, policy, pod); instaslice != nil || err != nil {
+		return instaslice, allocations, err
+	}
+	skippedNodes := make(map[string]bool)
+	for {
+		candidates, err := r.findPlacementCandidates(ctx, instaslices, slices[0].profile, pod, skippedNodes)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidate, ok := policy.selectPlacement(slices[0].profile, candidates)
+		if !ok {
+			return nil, nil, fmt.Errorf("failed to find allocatable node and gpu")
+		}
+		if allocations, ok := r.placeSlicesOnNode(policy, candidate, slices, pod, r.podSlotMaps(candidate.instaslice, pod)); ok {
+			return candidate.instaslice, allocations, nil
+		}
+		skippedNodes[candidate.instaslice.Name] = true
+	}
+}
+
+// cachedPodAllocations returns the allocations of the pod kept in the cache, the instaslice
+// is nil when they aren't all cached.
+func (r *InstasliceReconciler) cachedPodAllocations(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, slices []sliceRequest, policy AllocationPolicy, pod *v1.Pod) (*inferencev1alpha1.Instaslice, map[types.UID]utils.Allocation, error) {
+	cached, exists := r.allocationCache[allocationKey(pod.UID, 0, slices[0])]
+	if !exists {
+		return nil, nil, nil
+	}
+	for _, instaslice := range instaslices {
+		if instaslice.Name != string(cached.Nodename) {
+			continue
+		}
+		updatedInstaSliceObject, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
+		if err != nil {
+			return nil, nil, err
+		}
+		allocations := make(map[types.UID]utils.Allocation, len(slices))
+		for i, slice := range slices {
+			key := allocationKey(pod.UID, i, slice)
+			allocResult, exists := r.allocationCache[key]
+			if !exists {
+				return nil, nil, nil
+			}
+			allocRequest, newResult := r.setAllocationDetails(policy, updatedInstaSliceObject, slice, allocResult.GPUUUID, allocResult.MigPlacement.Start, pod)
+			allocations[key] = utils.Allocation{Request: *allocRequest, Result: *newResult}
+		}
+		return updatedInstaSliceObject, allocations, nil
+	}
+	return nil, nil, nil
+}
+
+// findPlacementCandidates returns every free placement for the profile on the GPUs of
+// the ready nodes that have enough classical resources for the pod, skipping the given nodes.
+// Candidates are ordered by node, GPU UUID and the placement order discovered on the node.
+func (r *InstasliceReconciler) findPlacementCandidates(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, profileName string, pod *v1.Pod, skippedNodes map[string]bool) ([]placementCandidate, error) {
+	var candidates []placementCandidate
+	for _, instaslice := range instaslices {
+		if skippedNodes[instaslice.Name] {
+			continue
+		}
+		updatedInstaSliceObject, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
+		if err != nil {
+			// the node is skipped, the other nodes can still hold the slices
+			logr.FromContext(ctx).Error(err, "skipping the node of the Instaslice object", "instaslice", instaslice.Name)
+			continue
+		}
+		if !r.nodeCanHoldPod(updatedInstaSliceObject, profileName, pod) {
+			continue
+		}
+		candidates = append(candidates, nodePlacementCandidates(updatedInstaSliceObject, profileName, r.podSlotMaps(updatedInstaSliceObject, pod))...)
+	}
+	return candidates, nil
+}
 
-	if r.ResourceCache.Fits(instaslice.Name, pod) {
-		// TODO: Discover GPU UUIDs for selection. (This may work for A100 and H100 for now.)
-		gpuUUIDs := sortGPUs(updatedInstaSliceObject)
-		for _, gpuuuid := range gpuUUIDs {
-			if updatedInstaSliceObject.Spec.PodAllocationRequests == nil {
-				updatedInstaSliceObject.Spec.PodAllocationRequests = make(map[types.UID]inferencev1alpha1.AllocationRequest)
+// nodeCanHoldPod reports whether slices of the profile can be placed for the pod on the node:
+// the node offers the profile, its daemonset is ready and the pod fits the node.
+func (r *InstasliceReconciler) nodeCanHoldPod(instaslice *inferencev1alpha1.Instaslice, profileName string, pod *v1.Pod) bool {
+	if _, ok := instaslice.Status.NodeResources.MigPlacement[profileName]; !ok {
+		return false
+	}
+	return instasliceReady(instaslice) && r.nodeFitsPod(instaslice.Name, pod)
+}
+
+// nodeFitsPod reports whether the pod can be scheduled to the node once ungated: the node
+// matches its nodeSelector and required node affinity, its taints are tolerated and it has
+// enough classical resources. Slices are only reserved on such nodes.
+func (r *InstasliceReconciler) nodeFitsPod(nodeName string, pod *v1.Pod) bool {
+	return r.ResourceCache.Schedulable(nodeName, pod) && r.ResourceCache.Fits(nodeName, pod)
+}
+
+// instasliceReady reports whether the daemonset of the node can create slices on its GPUs.
+// Nodes without the Ready condition, maintained by daemonsets predating it, are ready.
+func instasliceReady(instaslice *inferencev1alpha1.Instaslice) bool {
+	return !meta.IsStatusConditionFalse(instaslice.Status.Conditions, NodeReadyCondition)
+}
+
+// placeSlicesOnNode places the first slice at the candidate and the other slices on the GPUs
+// of the same node, as selected by the policy. The slots of the placed slices are marked as
+// used in the slot maps. The boolean is false when they don't all fit.
+func (r *InstasliceReconciler) placeSlicesOnNode(policy AllocationPolicy, first placementCandidate, slices []sliceRequest, pod *v1.Pod, gpuSlots map[string]slotMap) (map[types.UID]utils.Allocation, bool) {
+	instaslice := first.instaslice
+	allocations := make(map[types.UID]utils.Allocation, len(slices))
+	candidate := first
+	for i, slice := range slices {
+		if i > 0 {
+			var ok bool
+			candidate, ok = policy.selectPlacement(slice.profile, nodePlacementCandidates(instaslice, slice.profile, gpuSlots))
+			if !ok {
+				return nil, false
 			}
-			gpuAllocatedIndex := r.gpuAllocatedSlices(gpuuuid)
-			newStart := r.getStartIndexFromAllocationResults(updatedInstaSliceObject, profileName, gpuAllocatedIndex, &pod.UID, false)
-			// For example, a newStart of 9 is considered invalid.
-			notValidIndex := int32(9)
-			if newStart == notValidIndex {
-				// Move to next GPU if the index is not valid.
+		}
+		gpuSlots[candidate.gpuUUID].occupy(candidate.placement)
+		allocRequest, allocResult := r.setAllocationDetails(policy, instaslice, slice, candidate.gpuUUID, candidate.placement.Start, pod)
+		allocations[allocationKey(pod.UID, i, slice)] = utils.Allocation{Request: *allocRequest, Result: *allocResult}
+	}
+	return allocations, true
+}
+
+// nodeSlotMaps returns the slot map of every GPU of the node, ignoring the allocations
+// with the excluded keys
+func (r *InstasliceReconciler) nodeSlotMaps(instaslice *inferencev1alpha1.Instaslice, excluded map[types.UID]bool) map[string]slotMap {
+	gpuUUIDs := sortGPUs(instaslice)
+	gpuSlots := make(map[string]slotMap, len(gpuUUIDs))
+	for _, gpuuuid := range gpuUUIDs {
+		gpuSlots[gpuuuid] = r.gpuSlotMapExcluding(instaslice, gpuuuid, excluded)
+	}
+	return gpuSlots
+}
+
+// nodePlacementCandidates returns the free placements of the profile on the GPUs of the node
+func nodePlacementCandidates(instaslice *inferencev1alpha1.Instaslice, profileName string, gpuSlots map[string]slotMap) []placementCandidate {
+	mig, ok := instaslice.Status.NodeResources.MigPlacement[profileName]
+	if !ok {
+		return nil
+	}
+	gpuUUIDs := sortGPUs(instaslice)
+	var nodeUsed int32
+	for _, gpuuuid := range gpuUUIDs {
+		nodeUsed += gpuSlots[gpuuuid].used()
+	}
+	var candidates []placementCandidate
+	for _, gpuuuid := range gpuUUIDs {
+		// unhealthy GPUs raised a critical XID and don't take new slices
+		if !gpuHealthy(instaslice, gpuuuid) {
+			continue
+		}
+		slots := gpuSlots[gpuuuid]
+		for _, placement := range mig.Placements {
+			if !slots.isFree(placement) {
 				continue
 			}
-			size, discoveredGiprofile, Ciprofileid, Ciengprofileid := r.extractGpuProfile(updatedInstaSliceObject, profileName)
-			resourceIdentifier := pod.Spec.Containers[0].EnvFrom[0].ConfigMapRef.Name
-
-			allocRequest, allocResult := policy.SetAllocationDetails(
-				profileName,
-				newStart,
-				size,
-				pod.GetUID(),
-				types.NodeName(updatedInstaSliceObject.GetName()),
-				inferencev1alpha1.AllocationStatus{AllocationStatusController: inferencev1alpha1.AllocationStatusCreating},
-				discoveredGiprofile,
-				Ciprofileid,
-				Ciengprofileid,
-				pod.GetNamespace(),
-				pod.GetName(),
-				gpuuuid,
-				types.UID(resourceIdentifier),
-			)
-			return allocRequest, allocResult, nil
-		}
-	}
-	return nil, nil, fmt.Errorf("failed to find allocatable node and gpu")
+			candidates = append(candidates, placementCandidate{
+				instaslice: instaslice,
+				gpuUUID:    gpuuuid,
+				placement:  placement,
+				slots:      slots,
+				nodeUsed:   nodeUsed,
+			})
+		}
+	}
+	return candidates
+}
+
+// setAllocationDetails fills in the profile details discovered on the node and asks the
+// policy for the allocation request and result of the slice.
+func (r *InstasliceReconciler) setAllocationDetails(policy AllocationPolicy, instaslice *inferencev1alpha1.Instaslice, slice sliceRequest, gpuUUID string, newStart int32, pod *v1.Pod) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult) {
+	size, discoveredGiprofile, Ciprofileid, Ciengprofileid := r.extractGpuProfile(instaslice, slice.profile)
+	allocRequest, allocResult := policy.SetAllocationDetails(
+		slice.profile,
+		newStart,
+		size,
+		pod.GetUID(),
+		types.NodeName(instaslice.GetName()),
+		inferencev1alpha1.AllocationStatus{AllocationStatusController: inferencev1alpha1.AllocationStatusCreating},
+		discoveredGiprofile,
+		Ciprofileid,
+		Ciengprofileid,
+		pod.GetNamespace(),
+		pod.GetName(),
+		gpuUUID,
+		types.UID(slice.configMapName),
+	)
+	allocRequest.ContainerName = slice.containerName
+	return allocRequest, allocResult
 }
 
 // sortGPUs returns the sorted gpu IDs stored in the instaslice object
@@ -85,100 +237,68 @@ func sortGPUs(updatedInstaSliceObject *inferencev1alpha1.Instaslice) []string {
 	return gpuUUIDs
 }
 
-// gpuAllocatedSlices stores already allocated slices in indexes
-func (r *InstasliceReconciler) gpuAllocatedSlices(gpuUUID string) [8]int32 {
-	//TODO: generalize, A100 and H100 have 8 indexes for 3g and 7g and 7 for rest, so go with 8 and we are bounded by
-	var gpuAllocatedIndex [8]int32
-	// clean slate init
-	for i := range gpuAllocatedIndex {
-		gpuAllocatedIndex[i] = 0
-	}
+// gpuSlotMap returns the slot map of a GPU with the slots of existing allocations marked as used.
+// The map is sized from the placements discovered on the node hosting the GPU.
+func (r *InstasliceReconciler) gpuSlotMap(instaslice *inferencev1alpha1.Instaslice, gpuUUID string) slotMap {
+	return r.gpuSlotMapExcluding(instaslice, gpuUUID, nil)
+}
+
+// gpuSlotMapExcluding returns the slot map of a GPU with the slots of existing allocations, of
+// the placements nominated for preemptors and of the placements held for moved pods marked as
+// used, except for the excluded keys. Held placements are keyed by the UID of their controller.
+func (r *InstasliceReconciler) gpuSlotMapExcluding(instaslice *inferencev1alpha1.Instaslice, gpuUUID string, excluded map[types.UID]bool) slotMap {
+	slots := newSlotMap(instaslice.Status.NodeResources.MigPlacement)
 	// deleted allocations can be reused
 	// ungated allocations are already counted in prepared
-
-	for _, allocResult := range r.allocationCache {
+	for key, allocResult := range r.allocationCache {
+		if excluded[key] {
+			continue
+		}
 		if allocResult.GPUUUID == gpuUUID && allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
-			for i := 0; i < int(allocResult.MigPlacement.Size); i++ {
-				gpuAllocatedIndex[int(allocResult.MigPlacement.Start)+i] = 1
+			slots.occupy(allocResult.MigPlacement)
+		}
+	}
+	for _, nomination := range r.nominations {
+		for key, allocation := range nomination.allocations {
+			if !excluded[key] && allocation.Result.GPUUUID == gpuUUID {
+				slots.occupy(allocation.Result.MigPlacement)
+			}
+		}
+		for owner, placements := range nomination.held {
+			if excluded[owner] {
+				continue
+			}
+			for _, placement := range placements {
+				if placement.gpuUUID == gpuUUID {
+					slots.occupy(placement.placement)
+				}
 			}
 		}
 	}
-	return gpuAllocatedIndex
+	return slots
 }
 
-// getStartIndexFromPreparedState finds the correct GPU and index where a slice could be placed.
-func (r *InstasliceReconciler) getStartIndexFromAllocationResults(instaslice *inferencev1alpha1.Instaslice, profileName string, gpuAllocatedIndex [8]int32, podUid *types.UID, simulate bool) int32 {
+// getStartIndexFromAllocationResults finds the start index on the GPU where a slice of the profile could be placed.
+// The boolean is false when the profile has no free placement on the GPU.
+func (r *InstasliceReconciler) getStartIndexFromAllocationResults(instaslice *inferencev1alpha1.Instaslice, profileName string, slots slotMap, podUid *types.UID, simulate bool) (int32, bool) {
 	// if actual allocation, check if allocation already exists
 	if !simulate {
 		allocResult, exists := r.allocationCache[*podUid]
 		// allocation already exists in cache
 		if exists {
-			return allocResult.MigPlacement.Start
+			return allocResult.MigPlacement.Start, true
 		}
 	}
-	// Check if all indices are allocated
-	allAllocated := true
-	for _, allocated := range gpuAllocatedIndex {
-		if allocated != 1 {
-			allAllocated = false
-			break
-		}
+	if slots.full() {
+		return 0, false
 	}
-	if allAllocated {
-		// invalid index
-		return int32(9)
+	mig, ok := instaslice.Status.NodeResources.MigPlacement[profileName]
+	if !ok {
+		return 0, false
 	}
-	var neededContinousSlot int32
-	var possiblePlacements []int32
-	for profile, placement := range instaslice.Status.NodeResources.MigPlacement {
-		if profile == profileName {
-			neededContinousSlot = placement.Placements[0].Size
-			for _, placement := range placement.Placements {
-				possiblePlacements = append(possiblePlacements, placement.Start)
-			}
-			break
-		}
-	}
-	//TODO: generalize for other hardware models like A30, no slices can be placed on 9th index
-	//if we return 9 then assume no valid index is found.
-	var newStart = int32(9)
-	for _, value := range possiblePlacements {
-		if gpuAllocatedIndex[value] == 0 {
-			if neededContinousSlot == 1 {
-				newStart = value
-				break
-			}
-			if neededContinousSlot == 2 {
-				if value+neededContinousSlot <= int32(len(gpuAllocatedIndex)) {
-					if gpuAllocatedIndex[value] == 0 && gpuAllocatedIndex[value+1] == 0 {
-						newStart = value
-						break
-					}
-				}
-
-			}
-			if neededContinousSlot == 4 {
-				if value+neededContinousSlot <= int32(len(gpuAllocatedIndex)) {
-					if gpuAllocatedIndex[value] == 0 && gpuAllocatedIndex[value+1] == 0 && gpuAllocatedIndex[value+2] == 0 && gpuAllocatedIndex[value+3] == 0 {
-						newStart = value
-						break
-					}
-				}
-			}
-
-			if neededContinousSlot == 8 {
-				//special case
-				if value+neededContinousSlot <= int32(len(gpuAllocatedIndex)) {
-					if gpuAllocatedIndex[value] == 0 && gpuAllocatedIndex[value+1] == 0 &&
-						gpuAllocatedIndex[value+2] == 0 && gpuAllocatedIndex[value+3] == 0 &&
-						gpuAllocatedIndex[value+4] == 0 && gpuAllocatedIndex[value+5] == 0 &&
-						gpuAllocatedIndex[value+6] == 0 && gpuAllocatedIndex[value+7] == 0 {
-						newStart = value
-					}
-				}
-			}
-		}
-
+	placement, ok := slots.firstFit(mig.Placements)
+	if !ok {
+		return 0, false
 	}
-	return newStart
+	return placement.Start, true
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -11,8 +13,25 @@ const (
 	DefaultWebhookMode           = true
 	DefaultAutoLabelManagedNodes = false
 	// TODO fix this image
-	DefaultDaemonsetImage    = "quay.io/amalvank/instaslicev2-daemonset:latest"
-	DefaultManifestConfigDir = "/config"
+	DefaultDaemonsetImage          = "quay.io/amalvank/instaslicev2-daemonset:latest"
+	DefaultManifestConfigDir       = "/config"
+	DefaultAllocationPolicy        = "first-fit"
+	DefaultPodGroupTimeout         = 5 * time.Minute
+	DefaultPreemptionEnable        = false
+	DefaultDefragMode              = "disabled"
+	DefaultMaxConcurrentReconciles = 1
+	DefaultAllocationTimeout       = 5 * time.Minute
+	DefaultAllocationRetries       = 2
+	DefaultOrphanSweepInterval     = time.Minute
+	DefaultCacheCheckInterval      = 5 * time.Minute
+	DefaultSliceRecyclingEnable    = false
+	DefaultWaitQueueResyncInterval = time.Minute
+	DefaultDriftCheckInterval      = time.Minute
+	DefaultDriftPolicy             = "report"
+	DefaultCriticalXIDs            = "48,63,64,74,79,94,95"
+	DefaultGPURecoveryPeriod       = 10 * time.Minute
+	DefaultEvictOnUnhealthyGPU     = false
+	DefaultEnableMigGPUs           = ""
 )
 
 type Config struct {
@@ -30,15 +49,94 @@ type Config struct {
 
 	// AutoLabelManagedNodes automatically labels mig capable nodes with "instaslice.redhat.com/managed "at daemonset startup
 	AutoLabelManagedNodes bool `json:"auto_label_managed_nodes"`
+
+	// AllocationPolicy the cluster wide default allocation policy, namespaces and pods can override it
+	AllocationPolicy string `json:"allocation_policy"`
+
+	// PodGroupTimeout how long the slices reserved for a pod group are kept before they are
+	// released when the group can't be completed
+	PodGroupTimeout time.Duration `json:"pod_group_timeout"`
+
+	// PreemptionEnable evict running pods of lower priority when a gated pod doesn't fit
+	PreemptionEnable bool `json:"preemption_enable"`
+
+	// DefragMode whether pods that declare they can be restarted are moved to open a placement
+	// for a gated pod that doesn't fit: disabled, dry-run (the plan is only logged) or enabled
+	DefragMode string `json:"defrag_mode"`
+
+	// MaxConcurrentReconciles the number of pods reconciled concurrently by the controller
+	MaxConcurrentReconciles int `json:"max_concurrent_reconciles"`
+
+	// AllocationTimeout how long an allocation can stay in creating or deleting before the
+	// watchdog retries it on another GPU or marks it failed
+	AllocationTimeout time.Duration `json:"allocation_timeout"`
+
+	// AllocationRetries how many times the slices of a pod stuck in creating are placed again
+	// before their allocation is marked failed
+	AllocationRetries int `json:"allocation_retries"`
+
+	// OrphanSweepInterval how often the allocations are checked for pods that no longer exist
+	OrphanSweepInterval time.Duration `json:"orphan_sweep_interval"`
+
+	// CacheCheckInterval how often the allocation cache is checked against the Instaslice objects
+	CacheCheckInterval time.Duration `json:"cache_check_interval"`
+
+	// SliceRecyclingEnable hands the slices of completed pods over to waiting pods of the same
+	// profile instead of deleting and creating them again
+	SliceRecyclingEnable bool `json:"slice_recycling_enable"`
+
+	// WaitQueueResyncInterval how long a pod that doesn't fit waits for a wakeup before it is
+	// placed again anyway
+	WaitQueueResyncInterval time.Duration `json:"wait_queue_resync_interval"`
+
+	// DriftCheckInterval how often the daemonset compares the MIG slices of its GPUs with the
+	// allocations of its node
+	DriftCheckInterval time.Duration `json:"drift_check_interval"`
+
+	// DriftPolicy what the daemonset does with the slices no allocation accounts for: report
+	// them or destroy them
+	DriftPolicy string `json:"drift_policy"`
+
+	// CriticalXIDs the comma separated XIDs that mark the GPU raising them unhealthy, no slice
+	// is placed on an unhealthy GPU
+	CriticalXIDs string `json:"critical_xids"`
+
+	// GPURecoveryPeriod how long an unhealthy GPU must go without a critical XID before it is
+	// marked healthy again
+	GPURecoveryPeriod time.Duration `json:"gpu_recovery_period"`
+
+	// EvictOnUnhealthyGPU evict the pods using the slices of a GPU marked unhealthy
+	EvictOnUnhealthyGPU bool `json:"evict_on_unhealthy_gpu"`
+
+	// EnableMigGPUs the GPUs the daemonset enables MIG mode on when it is disabled: "all" or
+	// comma separated GPU UUIDs, MIG mode is left as it is by default
+	EnableMigGPUs string `json:"enable_mig_gpus"`
 }
 
 func NewConfig() *Config {
 	return &Config{
-		EmulatorModeEnable:    DefaultEmulatorMode,
-		WebhookEnable:         DefaultWebhookMode,
-		DaemonsetImage:        DefaultDaemonsetImage,
-		ManifestConfigDir:     DefaultManifestConfigDir,
-		AutoLabelManagedNodes: DefaultAutoLabelManagedNodes,
+		EmulatorModeEnable:      DefaultEmulatorMode,
+		WebhookEnable:           DefaultWebhookMode,
+		DaemonsetImage:          DefaultDaemonsetImage,
+		ManifestConfigDir:       DefaultManifestConfigDir,
+		AutoLabelManagedNodes:   DefaultAutoLabelManagedNodes,
+		AllocationPolicy:        DefaultAllocationPolicy,
+		PodGroupTimeout:         DefaultPodGroupTimeout,
+		PreemptionEnable:        DefaultPreemptionEnable,
+		DefragMode:              DefaultDefragMode,
+		MaxConcurrentReconciles: DefaultMaxConcurrentReconciles,
+		AllocationTimeout:       DefaultAllocationTimeout,
+		AllocationRetries:       DefaultAllocationRetries,
+		OrphanSweepInterval:     DefaultOrphanSweepInterval,
+		CacheCheckInterval:      DefaultCacheCheckInterval,
+		SliceRecyclingEnable:    DefaultSliceRecyclingEnable,
+		WaitQueueResyncInterval: DefaultWaitQueueResyncInterval,
+		DriftCheckInterval:      DefaultDriftCheckInterval,
+		DriftPolicy:             DefaultDriftPolicy,
+		CriticalXIDs:            DefaultCriticalXIDs,
+		GPURecoveryPeriod:       DefaultGPURecoveryPeriod,
+		EvictOnUnhealthyGPU:     DefaultEvictOnUnhealthyGPU,
+		EnableMigGPUs:           DefaultEnableMigGPUs,
 	}
 }
 
@@ -70,5 +168,91 @@ func ConfigFromEnvironment() *Config {
 		config.AutoLabelManagedNodes = strings.EqualFold(autoLabel, "true")
 	}
 
+	if allocationPolicy, ok := os.LookupEnv("ALLOCATION_POLICY"); ok && allocationPolicy != "" {
+		config.AllocationPolicy = allocationPolicy
+	}
+
+	if podGroupTimeout, ok := os.LookupEnv("POD_GROUP_TIMEOUT"); ok {
+		if timeout, err := time.ParseDuration(podGroupTimeout); err == nil && timeout > 0 {
+			config.PodGroupTimeout = timeout
+		}
+	}
+
+	if preemptionEnable, ok := os.LookupEnv("PREEMPTION_ENABLE"); ok {
+		config.PreemptionEnable = strings.EqualFold(preemptionEnable, "true")
+	}
+
+	if defragMode, ok := os.LookupEnv("DEFRAG_MODE"); ok && defragMode != "" {
+		config.DefragMode = defragMode
+	}
+
+	if maxConcurrentReconciles, ok := os.LookupEnv("MAX_CONCURRENT_RECONCILES"); ok {
+		if workers, err := strconv.Atoi(maxConcurrentReconciles); err == nil && workers > 0 {
+			config.MaxConcurrentReconciles = workers
+		}
+	}
+
+	if allocationTimeout, ok := os.LookupEnv("ALLOCATION_TIMEOUT"); ok {
+		if timeout, err := time.ParseDuration(allocationTimeout); err == nil && timeout > 0 {
+			config.AllocationTimeout = timeout
+		}
+	}
+
+	if allocationRetries, ok := os.LookupEnv("ALLOCATION_RETRIES"); ok {
+		if retries, err := strconv.Atoi(allocationRetries); err == nil && retries >= 0 {
+			config.AllocationRetries = retries
+		}
+	}
+
+	if orphanSweepInterval, ok := os.LookupEnv("ORPHAN_SWEEP_INTERVAL"); ok {
+		if interval, err := time.ParseDuration(orphanSweepInterval); err == nil && interval > 0 {
+			config.OrphanSweepInterval = interval
+		}
+	}
+
+	if cacheCheckInterval, ok := os.LookupEnv("CACHE_CHECK_INTERVAL"); ok {
+		if interval, err := time.ParseDuration(cacheCheckInterval); err == nil && interval > 0 {
+			config.CacheCheckInterval = interval
+		}
+	}
+
+	if sliceRecyclingEnable, ok := os.LookupEnv("SLICE_RECYCLING_ENABLE"); ok {
+		config.SliceRecyclingEnable = strings.EqualFold(sliceRecyclingEnable, "true")
+	}
+
+	if waitQueueResyncInterval, ok := os.LookupEnv("WAIT_QUEUE_RESYNC_INTERVAL"); ok {
+		if interval, err := time.ParseDuration(waitQueueResyncInterval); err == nil && interval > 0 {
+			config.WaitQueueResyncInterval = interval
+		}
+	}
+
+	if driftCheckInterval, ok := os.LookupEnv("DRIFT_CHECK_INTERVAL"); ok {
+		if interval, err := time.ParseDuration(driftCheckInterval); err == nil && interval > 0 {
+			config.DriftCheckInterval = interval
+		}
+	}
+
+	if driftPolicy, ok := os.LookupEnv("DRIFT_POLICY"); ok && driftPolicy != "" {
+		config.DriftPolicy = driftPolicy
+	}
+
+	if criticalXIDs, ok := os.LookupEnv("CRITICAL_XIDS"); ok && criticalXIDs != "" {
+		config.CriticalXIDs = criticalXIDs
+	}
+
+	if gpuRecoveryPeriod, ok := os.LookupEnv("GPU_RECOVERY_PERIOD"); ok {
+		if period, err := time.ParseDuration(gpuRecoveryPeriod); err == nil && period > 0 {
+			config.GPURecoveryPeriod = period
+		}
+	}
+
+	if evictOnUnhealthyGPU, ok := os.LookupEnv("EVICT_ON_UNHEALTHY_GPU"); ok {
+		config.EvictOnUnhealthyGPU = strings.EqualFold(evictOnUnhealthyGPU, "true")
+	}
+
+	if enableMigGPUs, ok := os.LookupEnv("ENABLE_MIG_GPUS"); ok {
+		config.EnableMigGPUs = strings.TrimSpace(enableMigGPUs)
+	}
+
 	return config
 }
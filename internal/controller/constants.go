@@ -19,29 +19,56 @@ package controller
 import "time"
 
 const (
-	OrgInstaslicePrefix              = "instaslice.redhat.com/"
-	ManagedLabel                     = OrgInstaslicePrefix + "managed"
-	PodLabelInstasliceMutated        = OrgInstaslicePrefix + "mutated"
-	GateName                         = OrgInstaslicePrefix + "accelerator"
-	FinalizerName                    = GateName
-	QuotaResourceName                = OrgInstaslicePrefix + "accelerator-memory-quota"
-	GPUMemoryLabelName               = "nvidia.com/gpu.memory"
-	GPUCountLabelName                = "nvidia.com/gpu.count"
-	EmulatorModeFalse                = "false"
-	EmulatorModeTrue                 = "true"
-	InstasliceManagedTrue            = "true"
-	InstaslicePodMutatedTrue         = "true"
-	MigCapableTrue                   = "true"
-	AttributeMediaExtensions         = "me"
-	InstaSliceOperatorNamespace      = "instaslice-system"
-	NvidiaMIGPrefix                  = "nvidia.com/mig-"
-	NodeLabel                        = "kubernetes.io/hostname"
-	multipleContainersUnsupportedErr = "multiple containers per pod not supported"
-	noContainerInsidePodErr          = "no containers present inside the pod"
-	InstasliceDaemonsetName          = "instaslice-operator-controller-daemonset"
-	daemonSetImageName               = "quay.io/amalvank/instaslicev2-daemonset:latest"
-	daemonSetName                    = "daemonset"
-	serviceAccountName               = "instaslice-operator-controller-manager"
+	OrgInstaslicePrefix         = "instaslice.redhat.com/"
+	ManagedLabel                = OrgInstaslicePrefix + "managed"
+	PodLabelInstasliceMutated   = OrgInstaslicePrefix + "mutated"
+	GateName                    = OrgInstaslicePrefix + "accelerator"
+	FinalizerName               = GateName
+	QuotaResourceName           = OrgInstaslicePrefix + "accelerator-memory-quota"
+	GPUMemoryLabelName          = "nvidia.com/gpu.memory"
+	GPUCountLabelName           = "nvidia.com/gpu.count"
+	EmulatorModeFalse           = "false"
+	EmulatorModeTrue            = "true"
+	InstasliceManagedTrue       = "true"
+	InstaslicePodMutatedTrue    = "true"
+	MigCapableTrue              = "true"
+	AttributeMediaExtensions    = "me"
+	InstaSliceOperatorNamespace = "instaslice-system"
+	NvidiaMIGPrefix             = "nvidia.com/mig-"
+	NodeLabel                   = "kubernetes.io/hostname"
+	AllocationPolicyLabel       = OrgInstaslicePrefix + "allocation-policy"
+	AllocationPolicyAnnotation  = AllocationPolicyLabel
+	PodGroupLabel               = OrgInstaslicePrefix + "pod-group"
+	PodGroupMinMemberAnnotation = OrgInstaslicePrefix + "pod-group-min-member"
+	PodGroupReservedCondition   = "PodGroupReserved"
+	PreemptedCondition          = "Preempted"
+	ProgressingCondition        = "Progressing"
+	FailedCondition             = "Failed"
+	RecycledCondition           = "Recycled"
+	AdoptedCondition            = "Adopted"
+	PodSlicesReadyCondition     = OrgInstaslicePrefix + "SlicesReady"
+	NodeReadyCondition          = "Ready"
+	NodeDiscoveredCondition     = "Discovered"
+	NodeDriverHealthyCondition  = "DriverHealthy"
+	NodeSlicesInSyncCondition   = "SlicesInSync"
+	GPUHealthyCondition         = "Healthy"
+	NodeMigModeEnabledCondition = "MigModeEnabled"
+	MigModeAllGPUs              = "all"
+	RestartableAnnotation       = OrgInstaslicePrefix + "restartable"
+	TeardownDelayLabel          = OrgInstaslicePrefix + "teardown-delay"
+	TeardownDelayAnnotation     = TeardownDelayLabel
+	DefragModeDisabled          = "disabled"
+	DefragModeDryRun            = "dry-run"
+	DefragModeEnabled           = "enabled"
+	DriftPolicyReport           = "report"
+	DriftPolicyDestroy          = "destroy"
+	noContainerInsidePodErr     = "no containers present inside the pod"
+	InstasliceDaemonsetName     = "instaslice-operator-controller-daemonset"
+	daemonSetImageName          = "quay.io/amalvank/instaslicev2-daemonset:latest"
+	daemonSetName               = "daemonset"
+	serviceAccountName          = "instaslice-operator-controller-manager"
+	podResourcesVolumeName      = "pod-resources"
+	kubeletPodResourcesDir      = "/var/lib/kubelet/pod-resources"
 
 	Requeue1sDelay  = 1 * time.Second
 	Requeue2sDelay  = 2 * time.Second
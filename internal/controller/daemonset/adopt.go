@@ -0,0 +1,178 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The GPUs of a node can hold MIG slices before the node is managed: slices created by hand,
+// or by the MIG manager for the pods of the NVIDIA device plugin. The slots of these slices
+// look free to the allocator and the creation of the slices placed on them fails. When the
+// daemonset starts, each slice no allocation accounts for is adopted: it is recorded as an
+// allocation holding its placement, in use by the pod the kubelet assigned its MIG device to,
+// or reserved when no pod uses it. Adopted slices are never deleted by the operator, their
+// allocations are released by the drift check once the slices are gone.
+
+const (
+	// reasonAdoptedInUse is the reason of the Adopted condition of slices used by a pod
+	reasonAdoptedInUse = "InUse"
+	// reasonAdoptedUnused is the reason of the Adopted condition of slices no pod uses
+	reasonAdoptedUnused = "Unused"
+)
+
+// sliceAdopted reports whether the allocation was adopted for a slice that existed before
+func sliceAdopted(allocResult inferencev1alpha1.AllocationResult) bool {
+	return meta.IsStatusConditionTrue(allocResult.Conditions, controller.AdoptedCondition)
+}
+
+// adoptedKey returns the key the allocation of the adopted slice is stored under
+func adoptedKey(slice gpuSlice) types.UID {
+	return types.UID(fmt.Sprintf("adopted-%s-%d", slice.gpuUUID, slice.placement.Start))
+}
+
+// sliceProfile returns the discovered profile of the GPU instance profile of the slice
+func sliceProfile(instaslice *inferencev1alpha1.Instaslice, slice gpuSlice) (string, bool) {
+	var profiles []string
+	for profile, mig := range instaslice.Status.NodeResources.MigPlacement {
+		if uint32(mig.GIProfileID) == slice.profileID {
+			profiles = append(profiles, profile)
+		}
+	}
+	if len(profiles) == 0 {
+		return "", false
+	}
+	sort.Strings(profiles)
+	return profiles[0], true
+}
+
+// adoptExistingSlices records an allocation for each slice of the GPUs of the node that no
+// allocation accounts for. The slices are adopted as reserved when the pods using them can't
+// be listed.
+func (r *InstaSliceDaemonsetReconciler) adoptExistingSlices(ctx context.Context) error {
+	log := logr.FromContext(ctx)
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		return err
+	}
+	var unowned []gpuSlice
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == "" {
+			continue
+		}
+		slices, err := r.listSlices(&instaslice, gpu.GPUUUID)
+		if err != nil {
+			return err
+		}
+		for _, slice := range slices {
+			if _, ok := sliceOwner(&instaslice, r.NodeName, slice); !ok {
+				unowned = append(unowned, slice)
+			}
+		}
+	}
+	if len(unowned) == 0 {
+		return nil
+	}
+	users, err := r.migDeviceUsers(ctx)
+	if err != nil {
+		log.Error(err, "unable to find the pods using the existing slices, adopting them as reserved", "nodeName", r.NodeName)
+	}
+	for _, slice := range unowned {
+		profile, ok := sliceProfile(&instaslice, slice)
+		if !ok {
+			log.Info("skipping the adoption of a slice of an unknown profile", "slice", slice.String(), "giProfileID", slice.profileID)
+			continue
+		}
+		key := adoptedKey(slice)
+		allocation := adoptedAllocation(r.NodeName, slice, profile, users)
+		err := utils.ReserveInstasliceAllocations(ctx, r.Client, r.NodeName, map[types.UID]utils.Allocation{key: allocation})
+		if errors.Is(err, utils.ErrPlacementTaken) {
+			// the drift check reports the slice as owned by no allocation
+			log.Info("unable to adopt a slice overlapping an allocation", "slice", slice.String(), "error", err.Error())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to adopt slice %s: %v", slice, err)
+		}
+		log.Info("adopted an existing slice", "slice", slice.String(), "profile", profile, "migUUID", slice.migUUID, "podRef", allocation.Request.PodRef)
+	}
+	return nil
+}
+
+// adoptedAllocation returns the allocation of the adopted slice, created and ungated. It
+// references the pod using the MIG device of the slice, if any.
+func adoptedAllocation(nodeName string, slice gpuSlice, profile string, users map[string]migDeviceUser) utils.Allocation {
+	request := inferencev1alpha1.AllocationRequest{Profile: profile}
+	condition := metav1.Condition{
+		Type:    controller.AdoptedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonAdoptedUnused,
+		Message: fmt.Sprintf("Slice %s existed before the node was managed, no pod uses it.", slice),
+	}
+	if user, ok := users[slice.migUUID]; ok && slice.migUUID != "" {
+		request.PodRef = v1.ObjectReference{Kind: "Pod", Namespace: user.namespace, Name: user.pod}
+		request.ContainerName = user.container
+		condition.Reason = reasonAdoptedInUse
+		condition.Message = fmt.Sprintf("Slice %s existed before the node was managed, it is used by pod %s.", slice, user)
+	}
+	result := inferencev1alpha1.AllocationResult{
+		MigPlacement: slice.placement,
+		GPUUUID:      slice.gpuUUID,
+		Nodename:     types.NodeName(nodeName),
+		AllocationStatus: inferencev1alpha1.AllocationStatus{
+			AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+			AllocationStatusController: inferencev1alpha1.AllocationStatusUngated,
+		},
+	}
+	meta.SetStatusCondition(&result.Conditions, condition)
+	return utils.Allocation{Request: request, Result: result}
+}
+
+// releaseAdoptedAllocations deletes the adopted allocations, their slices are gone
+func (r *InstaSliceDaemonsetReconciler) releaseAdoptedAllocations(ctx context.Context, keys []types.UID) error {
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		return err
+	}
+	original := instaslice.DeepCopy()
+	for _, key := range keys {
+		allocResult, ok := instaslice.Status.PodAllocationResults[key]
+		if !ok || !sliceAdopted(allocResult) {
+			continue
+		}
+		allocResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusDeleted
+		instaslice.Status.PodAllocationResults[key] = allocResult
+	}
+	if err := r.Status().Patch(ctx, &instaslice, client.MergeFrom(original)); err != nil {
+		return err
+	}
+	// the deleted allocations are removed, no pod of the controller holds them
+	return utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, r.NodeName, "", nil, nil)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+)
+
+// fakePodResources lists the devices of the pods like the kubelet
+type fakePodResources struct {
+	pods []*podresourcesapi.PodResources
+	err  error
+}
+
+func (f *fakePodResources) List(_ context.Context, _ *podresourcesapi.ListPodResourcesRequest, _ ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: f.pods}, nil
+}
+
+// podUsing returns the resources of a pod whose container uses the devices
+func podUsing(name, container, resourceName string, deviceIDs ...string) *podresourcesapi.PodResources {
+	return &podresourcesapi.PodResources{
+		Name:      name,
+		Namespace: "default",
+		Containers: []*podresourcesapi.ContainerResources{{
+			Name:    container,
+			Devices: []*podresourcesapi.ContainerDevices{{ResourceName: resourceName, DeviceIds: deviceIDs}},
+		}},
+	}
+}
+
+// getInstaslice returns the Instaslice of the node
+func getInstaslice(t *testing.T, r *InstaSliceDaemonsetReconciler) *inferencev1alpha1.Instaslice {
+	var instaslice inferencev1alpha1.Instaslice
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: fakeNodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice))
+	return &instaslice
+}
+
+func TestAdoptExistingSlices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	// the slice of an allocation is not adopted
+	instaslice := withAllocation(readyInstaslice(t, backend), "pod-uid", "GPU-a", 4, inferencev1alpha1.AllocationStatusUngated)
+	allocResult := instaslice.Status.PodAllocationResults["pod-uid"]
+	allocResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+	instaslice.Status.PodAllocationResults["pod-uid"] = allocResult
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_1_SLICE, 4, true)
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_2_SLICE, 0, true)
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_1_SLICE, 6, false)
+	r := newFakeGPUReconciler(backend, instaslice)
+	r.PodResources = &fakePodResources{pods: []*podresourcesapi.PodResources{
+		podUsing("vllm", "server", "nvidia.com/mig-2g.10gb", "MIG-GPU-a-2-0"),
+		podUsing("pod-uid", "main", "nvidia.com/mig-1g.5gb", "MIG-GPU-a-1-0"),
+	}}
+	ctx := context.Background()
+
+	assert.NoError(t, r.adoptExistingSlices(ctx))
+	adopted := getInstaslice(t, r)
+	assert.Len(t, adopted.Status.PodAllocationResults, 3)
+	inUse, ok := adopted.Status.PodAllocationResults["adopted-GPU-a-0"]
+	if assert.True(t, ok) {
+		assert.Equal(t, inferencev1alpha1.Placement{Start: 0, Size: 2}, inUse.MigPlacement)
+		assert.Equal(t, inferencev1alpha1.AllocationStatusCreated, inUse.AllocationStatus.AllocationStatusDaemonset)
+		assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, inUse.AllocationStatus.AllocationStatusController)
+		condition := meta.FindStatusCondition(inUse.Conditions, controller.AdoptedCondition)
+		if assert.NotNil(t, condition) {
+			assert.Equal(t, reasonAdoptedInUse, condition.Reason)
+			assert.Contains(t, condition.Message, "default/vllm")
+		}
+		request := adopted.Spec.PodAllocationRequests["adopted-GPU-a-0"]
+		assert.Equal(t, "2g.10gb", request.Profile)
+		assert.Equal(t, "vllm", request.PodRef.Name)
+		assert.Equal(t, "server", request.ContainerName)
+	}
+	unused, ok := adopted.Status.PodAllocationResults["adopted-GPU-a-6"]
+	if assert.True(t, ok) {
+		assert.True(t, meta.IsStatusConditionTrue(unused.Conditions, controller.AdoptedCondition))
+		assert.Equal(t, reasonAdoptedUnused, meta.FindStatusCondition(unused.Conditions, controller.AdoptedCondition).Reason)
+		assert.Equal(t, "1g.5gb", adopted.Spec.PodAllocationRequests["adopted-GPU-a-6"].Profile)
+	}
+	drift, err := r.detectDrift(adopted)
+	assert.NoError(t, err)
+	assert.Empty(t, drift.unowned, "the adopted slices are owned")
+	assert.Empty(t, drift.missing)
+
+	// the slices are adopted once
+	assert.NoError(t, r.adoptExistingSlices(ctx))
+	assert.Len(t, getInstaslice(t, r).Status.PodAllocationResults, 3)
+}
+
+func TestAdoptExistingSlicesWithoutPodResources(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_7_SLICE, 0, true)
+	r := newFakeGPUReconciler(backend, readyInstaslice(t, backend))
+	r.PodResources = &fakePodResources{err: errors.New("kubelet socket not mounted")}
+
+	assert.NoError(t, r.adoptExistingSlices(context.Background()))
+	adopted := getInstaslice(t, r).Status.PodAllocationResults["adopted-GPU-a-0"]
+	condition := meta.FindStatusCondition(adopted.Conditions, controller.AdoptedCondition)
+	if assert.NotNil(t, condition, "the slice is adopted as reserved") {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, reasonAdoptedUnused, condition.Reason)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"fmt"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Reasons of the conditions the daemonset maintains on the Instaslice of its node
+const (
+	reasonGPUsAccessible    = "GPUsAccessible"
+	reasonDriverInitialized = "DriverInitialized"
+	reasonDriverEmulated    = "DriverEmulated"
+	reasonDriverError       = "DriverError"
+	reasonGPUsDiscovered    = "GPUsDiscovered"
+	reasonDiscoveryFailed   = "DiscoveryFailed"
+	reasonDiscoveryPending  = "DiscoveryPending"
+	reasonBootIDMismatch    = "BootIDMismatch"
+	reasonSlicesInSync      = "SlicesInSync"
+	reasonSlicesDrifted     = "SlicesDrifted"
+)
+
+// driverCondition returns the DriverHealthy condition, the GPU backend is initialized when it
+// isn't yet
+func (r *InstaSliceDaemonsetReconciler) driverCondition() metav1.Condition {
+	condition := metav1.Condition{
+		Type:    controller.NodeDriverHealthyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonDriverInitialized,
+		Message: "NVML is initialized.",
+	}
+	if r.Config.EmulatorModeEnable {
+		condition.Reason, condition.Message = reasonDriverEmulated, "The GPUs are emulated."
+	} else if err := r.gpu().Init(); err != nil {
+		condition.Status, condition.Reason, condition.Message = metav1.ConditionFalse, reasonDriverError, err.Error()
+	}
+	return condition
+}
+
+// discoveredCondition returns the Discovered condition for the outcome of the discovery of
+// the GPUs of the node
+func discoveredCondition(instaslice *inferencev1alpha1.Instaslice, err error) metav1.Condition {
+	if err != nil {
+		return metav1.Condition{
+			Type:    controller.NodeDiscoveredCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  reasonDiscoveryFailed,
+			Message: err.Error(),
+		}
+	}
+	gpus := 0
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID != "" {
+			gpus++
+		}
+	}
+	return metav1.Condition{
+		Type:    controller.NodeDiscoveredCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonGPUsDiscovered,
+		Message: fmt.Sprintf("Discovered %d MIG enabled GPUs.", gpus),
+	}
+}
+
+// setNodeConditions sets the conditions in the status and derives the Ready condition from
+// the DriverHealthy and Discovered conditions and from the boot ID the slices were last synced
+// with. The boot ID of the node is empty when it isn't known, only a synced one is required.
+func setNodeConditions(status *inferencev1alpha1.InstasliceStatus, nodeBootID string, conditions ...metav1.Condition) {
+	for _, condition := range conditions {
+		meta.SetStatusCondition(&status.Conditions, condition)
+	}
+	ready := metav1.Condition{
+		Type:    controller.NodeReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonGPUsAccessible,
+		Message: "All discovered GPUs are accessible and the driver is healthy.",
+	}
+	driver := meta.FindStatusCondition(status.Conditions, controller.NodeDriverHealthyCondition)
+	discovered := meta.FindStatusCondition(status.Conditions, controller.NodeDiscoveredCondition)
+	bootID := status.NodeResources.BootID
+	switch {
+	case driver == nil || driver.Status != metav1.ConditionTrue:
+		ready.Status, ready.Reason = metav1.ConditionFalse, reasonDriverError
+		ready.Message = "Could not communicate with the GPU driver on the node."
+	case discovered == nil:
+		ready.Status, ready.Reason = metav1.ConditionFalse, reasonDiscoveryPending
+		ready.Message = "The GPUs of the node are not discovered yet."
+	case discovered.Status != metav1.ConditionTrue:
+		ready.Status, ready.Reason = metav1.ConditionFalse, reasonDiscoveryFailed
+		ready.Message = "The discovery of the GPUs of the node failed."
+	case bootID == "" || (nodeBootID != "" && bootID != nodeBootID):
+		ready.Status, ready.Reason = metav1.ConditionFalse, reasonBootIDMismatch
+		ready.Message = "The slices are not synced with the current boot of the node yet."
+	}
+	meta.SetStatusCondition(&status.Conditions, ready)
+}
+
+// updateNodeConditions sets the conditions and the Ready condition derived from them on the
+// Instaslice of the node, its status is patched only when they changed
+func (r *InstaSliceDaemonsetReconciler) updateNodeConditions(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, nodeBootID string, conditions ...metav1.Condition) error {
+	original := instaslice.DeepCopy()
+	setNodeConditions(&instaslice.Status, nodeBootID, conditions...)
+	if equality.Semantic.DeepEqual(original.Status.Conditions, instaslice.Status.Conditions) {
+		return nil
+	}
+	return r.Status().Patch(ctx, instaslice, client.MergeFrom(original))
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+)
+
+func TestSetNodeConditions(t *testing.T) {
+	healthy := metav1.Condition{Type: controller.NodeDriverHealthyCondition, Status: metav1.ConditionTrue, Reason: reasonDriverInitialized}
+	driverError := metav1.Condition{Type: controller.NodeDriverHealthyCondition, Status: metav1.ConditionFalse, Reason: reasonDriverError}
+	discovered := discoveredCondition(&inferencev1alpha1.Instaslice{}, nil)
+	failed := discoveredCondition(nil, errors.New("unable to detect mig mode"))
+
+	tests := []struct {
+		name       string
+		bootID     string
+		nodeBootID string
+		conditions []metav1.Condition
+		reason     string
+	}{
+		{"ready", "boot-1", "boot-1", []metav1.Condition{healthy, discovered}, reasonGPUsAccessible},
+		{"unknown node boot ID", "boot-1", "", []metav1.Condition{healthy, discovered}, reasonGPUsAccessible},
+		{"driver error", "boot-1", "boot-1", []metav1.Condition{driverError, discovered}, reasonDriverError},
+		{"not discovered", "boot-1", "boot-1", []metav1.Condition{healthy}, reasonDiscoveryPending},
+		{"discovery failed", "boot-1", "boot-1", []metav1.Condition{healthy, failed}, reasonDiscoveryFailed},
+		{"rebooted", "boot-1", "boot-2", []metav1.Condition{healthy, discovered}, reasonBootIDMismatch},
+		{"boot ID not synced", "", "boot-1", []metav1.Condition{healthy, discovered}, reasonBootIDMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := inferencev1alpha1.InstasliceStatus{
+				NodeResources: inferencev1alpha1.DiscoveredNodeResources{BootID: tt.bootID},
+			}
+			setNodeConditions(&status, tt.nodeBootID, tt.conditions...)
+			ready := meta.FindStatusCondition(status.Conditions, controller.NodeReadyCondition)
+			if assert.NotNil(t, ready) {
+				assert.Equal(t, tt.reason, ready.Reason)
+				assert.Equal(t, tt.reason == reasonGPUsAccessible, ready.Status == metav1.ConditionTrue)
+			}
+		})
+	}
+}
+
+func TestReconcileSyncsNodeConditions(t *testing.T) {
+	s := scheme.Scheme
+	_ = v1.AddToScheme(s)
+	_ = inferencev1alpha1.AddToScheme(s)
+	const nodeName = "test-node"
+
+	instaslice := &inferencev1alpha1.Instaslice{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName, Namespace: controller.InstaSliceOperatorNamespace},
+		Status: inferencev1alpha1.InstasliceStatus{
+			NodeResources: inferencev1alpha1.DiscoveredNodeResources{BootID: "boot-1"},
+			Conditions:    []metav1.Condition{discoveredCondition(&inferencev1alpha1.Instaslice{}, nil)},
+		},
+	}
+	instaslice.Status.Conditions[0].LastTransitionTime = metav1.Now()
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{BootID: "boot-2"}},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&inferencev1alpha1.Instaslice{}).WithObjects(instaslice, node).Build()
+	reconciler := &InstaSliceDaemonsetReconciler{
+		Client:   fakeClient,
+		NodeName: nodeName,
+		Config:   &config.Config{EmulatorModeEnable: true},
+	}
+	ctx := context.Background()
+
+	_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: nodeName, Namespace: controller.InstaSliceOperatorNamespace}})
+	assert.NoError(t, err)
+
+	var latest inferencev1alpha1.Instaslice
+	assert.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(instaslice), &latest))
+	assert.Equal(t, "boot-2", latest.Status.NodeResources.BootID)
+	assert.True(t, meta.IsStatusConditionTrue(latest.Status.Conditions, controller.NodeDriverHealthyCondition))
+	assert.True(t, meta.IsStatusConditionTrue(latest.Status.Conditions, controller.NodeDiscoveredCondition))
+	ready := meta.FindStatusCondition(latest.Status.Conditions, controller.NodeReadyCondition)
+	if assert.NotNil(t, ready) {
+		assert.Equal(t, metav1.ConditionTrue, ready.Status, "the node is ready once synced with its boot ID")
+		assert.Equal(t, reasonGPUsAccessible, ready.Reason)
+	}
+}
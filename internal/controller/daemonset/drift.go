@@ -0,0 +1,402 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The MIG slices of the GPUs can drift from the allocations of the node: a slice created or
+// destroyed by hand with nvidia-smi, a compute instance destroyed externally or a creation
+// that half-succeeded. The slices are compared with the allocations every drift check
+// interval. The missing slices of created allocations are created again, the slices no
+// allocation accounts for are destroyed or only reported depending on the drift policy, and
+// the drift found is reported by the SlicesInSync condition of the Instaslice.
+
+// DriftPolicies are the supported values of the drift policy
+var DriftPolicies = []string{controller.DriftPolicyReport, controller.DriftPolicyDestroy}
+
+// ValidateDriftPolicy returns an error when the drift policy isn't supported
+func ValidateDriftPolicy(policy string) error {
+	for _, known := range DriftPolicies {
+		if policy == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown drift policy %q, supported policies: %s", policy, strings.Join(DriftPolicies, ", "))
+}
+
+// gpuSlice is a GPU instance of a GPU of the node
+type gpuSlice struct {
+	gpuUUID   string
+	giID      uint32
+	profileID uint32
+	placement inferencev1alpha1.Placement
+	// migUUID is the MIG device of its compute instance, empty when it has none
+	migUUID string
+	ciID    uint32
+}
+
+func (s gpuSlice) String() string {
+	return fmt.Sprintf("%s@%d+%d", s.gpuUUID, s.placement.Start, s.placement.Size)
+}
+
+// sliceDrift is the drift between the slices of the GPUs and the allocations of the node
+type sliceDrift struct {
+	// missing are the created allocations without a slice
+	missing []types.UID
+	// released are the adopted allocations whose slice is gone
+	released []types.UID
+	// unowned are the slices no allocation accounts for
+	unowned []gpuSlice
+	// live are the MIG devices of the GPUs
+	live map[string]bool
+}
+
+func (r *InstaSliceDaemonsetReconciler) driftCheckInterval() time.Duration {
+	if r.Config != nil && r.Config.DriftCheckInterval > 0 {
+		return r.Config.DriftCheckInterval
+	}
+	return config.DefaultDriftCheckInterval
+}
+
+func (r *InstaSliceDaemonsetReconciler) driftPolicy() string {
+	if r.Config != nil && r.Config.DriftPolicy != "" {
+		return r.Config.DriftPolicy
+	}
+	return config.DefaultDriftPolicy
+}
+
+// checkDrift compares the slices of the GPUs with the allocations of the node, repairs the
+// drift and reports it. The node is skipped until it is ready, the slices of a rebooted node
+// are created again by Reconcile.
+func (r *InstaSliceDaemonsetReconciler) checkDrift(ctx context.Context) {
+	log := logr.FromContext(ctx)
+	r.slicesMu.Lock()
+	defer r.slicesMu.Unlock()
+
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get the Instaslice of the node for the drift check", "nodeName", r.NodeName)
+		}
+		return
+	}
+	if !meta.IsStatusConditionTrue(instaslice.Status.Conditions, controller.NodeReadyCondition) {
+		return
+	}
+	drift, err := r.detectDrift(&instaslice)
+	if err != nil {
+		log.Error(err, "unable to compare the slices with the allocations", "nodeName", r.NodeName)
+		return
+	}
+	findings := r.repairDrift(ctx, &instaslice, drift)
+	if err := r.updateNodeConditions(ctx, &instaslice, "", driftCondition(findings)); err != nil {
+		log.Error(err, "unable to report the drift of the slices", "nodeName", r.NodeName)
+	}
+}
+
+// detectDrift lists the slices of the GPUs of the node and compares them with its allocations
+func (r *InstaSliceDaemonsetReconciler) detectDrift(instaslice *inferencev1alpha1.Instaslice) (sliceDrift, error) {
+	drift := sliceDrift{live: make(map[string]bool)}
+	owned := make(map[types.UID]bool)
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == "" {
+			continue
+		}
+		slices, err := r.listSlices(instaslice, gpu.GPUUUID)
+		if err != nil {
+			return sliceDrift{}, err
+		}
+		for _, slice := range slices {
+			if slice.migUUID != "" {
+				drift.live[slice.migUUID] = true
+			}
+			podUID, ok := sliceOwner(instaslice, r.NodeName, slice)
+			if !ok {
+				drift.unowned = append(drift.unowned, slice)
+				continue
+			}
+			// the compute instance of a slice that half-succeeded is still missing, adopted
+			// slices are kept as they were found
+			if slice.migUUID != "" || sliceAdopted(instaslice.Status.PodAllocationResults[podUID]) {
+				owned[podUID] = true
+			}
+		}
+	}
+	for podUID, allocResult := range instaslice.Status.PodAllocationResults {
+		if allocResult.Nodename != types.NodeName(r.NodeName) || owned[podUID] {
+			continue
+		}
+		if allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusCreated ||
+			allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting {
+			continue
+		}
+		// the slices of adopted allocations weren't created by the daemonset
+		if sliceAdopted(allocResult) {
+			drift.released = append(drift.released, podUID)
+			continue
+		}
+		drift.missing = append(drift.missing, podUID)
+	}
+	sort.Slice(drift.missing, func(i, j int) bool { return drift.missing[i] < drift.missing[j] })
+	sort.Slice(drift.released, func(i, j int) bool { return drift.released[i] < drift.released[j] })
+	return drift, nil
+}
+
+// liveMigDevices returns the MIG devices of the GPUs of the node
+func (r *InstaSliceDaemonsetReconciler) liveMigDevices(instaslice *inferencev1alpha1.Instaslice) (map[string]bool, error) {
+	live := make(map[string]bool)
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == "" {
+			continue
+		}
+		slices, err := r.listSlices(instaslice, gpu.GPUUUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, slice := range slices {
+			if slice.migUUID != "" {
+				live[slice.migUUID] = true
+			}
+		}
+	}
+	return live, nil
+}
+
+// listSlices returns the GPU instances of the GPU, with the MIG devices of their compute
+// instances. The GPU instances without a compute instance are listed for the discovered
+// profiles.
+func (r *InstaSliceDaemonsetReconciler) listSlices(instaslice *inferencev1alpha1.Instaslice, gpuUUID string) ([]gpuSlice, error) {
+	device, ret := r.gpu().DeviceGetHandleByUUID(gpuUUID)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("unable to get device handle of GPU %s: %v", gpuUUID, ret)
+	}
+	migInfos, err := populateMigDeviceInfos(device)
+	if err != nil {
+		return nil, fmt.Errorf("unable to walk the MIG devices of GPU %s: %v", gpuUUID, err)
+	}
+	var slices []gpuSlice
+	seen := make(map[uint32]bool)
+	for migUUID, migInfo := range migInfos {
+		seen[migInfo.giInfo.Id] = true
+		slices = append(slices, gpuSlice{
+			gpuUUID:   gpuUUID,
+			giID:      migInfo.giInfo.Id,
+			profileID: migInfo.giInfo.ProfileId,
+			placement: inferencev1alpha1.Placement{Start: migInfo.start, Size: migInfo.size},
+			migUUID:   migUUID,
+			ciID:      migInfo.ciInfo.Id,
+		})
+	}
+	profileIDs := make(map[int32]bool)
+	for _, mig := range instaslice.Status.NodeResources.MigPlacement {
+		profileIDs[mig.GIProfileID] = true
+	}
+	for profileID := range profileIDs {
+		profileInfo, ret := device.GetGpuInstanceProfileInfo(int(profileID))
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("unable to get GPU instance profile %d of GPU %s: %v", profileID, gpuUUID, ret)
+		}
+		gpuInstances, ret := device.GetGpuInstances(&profileInfo)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("unable to list the GPU instances of GPU %s: %v", gpuUUID, ret)
+		}
+		for _, gi := range gpuInstances {
+			giInfo, ret := gi.GetInfo()
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("unable to get GPU instance info of GPU %s: %v", gpuUUID, ret)
+			}
+			if seen[giInfo.Id] {
+				continue
+			}
+			seen[giInfo.Id] = true
+			slices = append(slices, gpuSlice{
+				gpuUUID:   gpuUUID,
+				giID:      giInfo.Id,
+				profileID: giInfo.ProfileId,
+				placement: inferencev1alpha1.Placement{Start: int32(giInfo.Placement.Start), Size: int32(giInfo.Placement.Size)},
+			})
+		}
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i].placement.Start < slices[j].placement.Start })
+	return slices, nil
+}
+
+// sliceOwner returns the allocation of the node the slice was created for: an allocation not
+// deleted yet of the same profile at the same placement
+func sliceOwner(instaslice *inferencev1alpha1.Instaslice, nodeName string, slice gpuSlice) (types.UID, bool) {
+	for podUID, allocResult := range instaslice.Status.PodAllocationResults {
+		if allocResult.Nodename != types.NodeName(nodeName) || allocResult.GPUUUID != slice.gpuUUID || allocResult.MigPlacement != slice.placement {
+			continue
+		}
+		if allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+			continue
+		}
+		if request, ok := instaslice.Spec.PodAllocationRequests[podUID]; ok {
+			if mig, ok := instaslice.Status.NodeResources.MigPlacement[request.Profile]; ok && uint32(mig.GIProfileID) != slice.profileID {
+				continue
+			}
+		}
+		return podUID, true
+	}
+	return "", false
+}
+
+// repairDrift creates the missing slices again, releases the adopted allocations whose slice is
+// gone and destroys the unowned slices when the drift policy says so, it returns the drift
+// found and what was done about it
+func (r *InstaSliceDaemonsetReconciler) repairDrift(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, drift sliceDrift) []string {
+	log := logr.FromContext(ctx)
+	var findings []string
+	if len(drift.released) > 0 {
+		if err := r.releaseAdoptedAllocations(ctx, drift.released); err != nil {
+			log.Error(err, "unable to release the adopted allocations whose slice is gone", "nodeName", r.NodeName)
+		} else {
+			log.Info("released the adopted allocations whose slice is gone", "keys", drift.released)
+		}
+	}
+	for _, podUID := range drift.missing {
+		allocResult := instaslice.Status.PodAllocationResults[podUID]
+		finding := fmt.Sprintf("slice of allocation %s missing on %s@%d+%d", podUID, allocResult.GPUUUID, allocResult.MigPlacement.Start, allocResult.MigPlacement.Size)
+		if err := r.recreateSlice(ctx, instaslice, podUID, drift.live); err != nil {
+			log.Error(err, "unable to create the missing slice again", "podUID", podUID, "gpuUUID", allocResult.GPUUUID)
+			findings = append(findings, finding+", not created again: "+err.Error())
+			continue
+		}
+		log.Info("created the missing slice again", "podUID", podUID, "gpuUUID", allocResult.GPUUUID, "placement", allocResult.MigPlacement)
+		findings = append(findings, finding+", created again")
+	}
+	for _, slice := range drift.unowned {
+		finding := fmt.Sprintf("slice %s owned by no allocation", slice)
+		if r.driftPolicy() != controller.DriftPolicyDestroy {
+			log.Info("found a slice owned by no allocation", "slice", slice.String(), "migUUID", slice.migUUID)
+			findings = append(findings, finding+", kept")
+			continue
+		}
+		if err := r.destroySlice(slice); err != nil {
+			log.Error(err, "unable to destroy the slice owned by no allocation", "slice", slice.String())
+			findings = append(findings, finding+", not destroyed: "+err.Error())
+			continue
+		}
+		log.Info("destroyed the slice owned by no allocation", "slice", slice.String(), "migUUID", slice.migUUID)
+		findings = append(findings, finding+", destroyed")
+	}
+	return findings
+}
+
+// recreateSlice creates the missing slice of the allocation again, the MIG device of the lost
+// slice is replaced in the configmap of the container. The containers already running keep
+// the lost device until they restart.
+func (r *InstaSliceDaemonsetReconciler) recreateSlice(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, podUID types.UID, live map[string]bool) error {
+	migUUID, found, err := r.createSlice(ctx, instaslice, podUID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no MIG device found at the placement after creating the slice")
+	}
+	podRef := instaslice.Spec.PodAllocationRequests[podUID].PodRef
+	allocResult := instaslice.Status.PodAllocationResults[podUID]
+	return r.replaceLostMigDevices(ctx, podRef.Namespace, string(allocResult.ConfigMapResourceIdentifier), live, migUUID)
+}
+
+// replaceLostMigDevices removes the MIG devices that are not live from the configmap and adds
+// the new one
+func (r *InstaSliceDaemonsetReconciler) replaceLostMigDevices(ctx context.Context, namespace, name string, live map[string]bool, migUUID string) error {
+	var configMap v1.ConfigMap
+	if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return r.addMigDeviceToConfigMap(ctx, migUUID, namespace, name)
+		}
+		return err
+	}
+	var devices []string
+	for _, device := range configMapMigDevices(&configMap) {
+		if live[device] && device != migUUID {
+			devices = append(devices, device)
+		}
+	}
+	devices = append(devices, migUUID)
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data["NVIDIA_VISIBLE_DEVICES"] = strings.Join(devices, ",")
+	configMap.Data["CUDA_VISIBLE_DEVICES"] = strings.Join(devices, ",")
+	return r.Update(ctx, &configMap)
+}
+
+// destroySlice destroys the compute instance of the slice, if any, and its GPU instance
+func (r *InstaSliceDaemonsetReconciler) destroySlice(slice gpuSlice) error {
+	device, ret := r.gpu().DeviceGetHandleByUUID(slice.gpuUUID)
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to get device handle: %v", ret)
+	}
+	gi, ret := device.GetGpuInstanceById(int(slice.giID))
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to find GI: %v", ret)
+	}
+	if slice.migUUID != "" {
+		ci, ret := gi.GetComputeInstanceById(int(slice.ciID))
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("unable to find CI: %v", ret)
+		}
+		if ret := ci.Destroy(); ret != nvml.SUCCESS {
+			return fmt.Errorf("unable to destroy CI: %v", ret)
+		}
+	}
+	if ret := gi.Destroy(); ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to destroy GI: %v", ret)
+	}
+	return nil
+}
+
+// driftCondition returns the SlicesInSync condition for the drift found by a check
+func driftCondition(findings []string) metav1.Condition {
+	if len(findings) == 0 {
+		return metav1.Condition{
+			Type:    controller.NodeSlicesInSyncCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonSlicesInSync,
+			Message: "The MIG slices of the GPUs match the allocations of the node.",
+		}
+	}
+	return metav1.Condition{
+		Type:    controller.NodeSlicesInSyncCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  reasonSlicesDrifted,
+		Message: fmt.Sprintf("Found %d drifted slices: %s.", len(findings), strings.Join(findings, "; ")),
+	}
+}
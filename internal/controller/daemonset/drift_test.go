@@ -0,0 +1,185 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+)
+
+// readyInstaslice returns the Instaslice of the node discovered on the backend and ready
+func readyInstaslice(t *testing.T, backend *fakeGPUBackend) *inferencev1alpha1.Instaslice {
+	r := newFakeGPUReconciler(backend)
+	instaslice := discoveredInstaslice(t, r)
+	setNodeConditions(&instaslice.Status, "boot-1", r.driverCondition())
+	return instaslice
+}
+
+// createFakeSlice creates a slice on the fake GPU, with a compute instance when asked to
+func createFakeSlice(t *testing.T, backend *fakeGPUBackend, gpuUUID string, profile int, start uint32, withCI bool) {
+	device, _ := backend.DeviceGetHandleByUUID(gpuUUID)
+	info, _ := device.GetGpuInstanceProfileInfo(profile)
+	gi, ret := device.CreateGpuInstanceWithPlacement(&info, &nvml.GpuInstancePlacement{Start: start, Size: fakeA100Profiles[profile].size})
+	assert.Equal(t, nvml.SUCCESS, ret)
+	if withCI {
+		ciInfo, _ := gi.GetComputeInstanceProfileInfo(profile, nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED)
+		_, ret = gi.CreateComputeInstance(&ciInfo)
+		assert.Equal(t, nvml.SUCCESS, ret)
+	}
+}
+
+// slicesInSync returns the SlicesInSync condition of the Instaslice
+func slicesInSync(t *testing.T, r *InstaSliceDaemonsetReconciler) *metav1.Condition {
+	var instaslice inferencev1alpha1.Instaslice
+	assert.NoError(t, r.Get(context.Background(), types.NamespacedName{Name: fakeNodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice))
+	return meta.FindStatusCondition(instaslice.Status.Conditions, controller.NodeSlicesInSyncCondition)
+}
+
+func TestValidateDriftPolicy(t *testing.T) {
+	for _, policy := range DriftPolicies {
+		assert.NoError(t, ValidateDriftPolicy(policy))
+	}
+	assert.Error(t, ValidateDriftPolicy("ignore"))
+}
+
+func TestCheckDriftRecreatesMissingSlices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	instaslice := withAllocation(readyInstaslice(t, backend), "pod-uid", "GPU-a", 5, inferencev1alpha1.AllocationStatusUngated)
+	allocResult := instaslice.Status.PodAllocationResults["pod-uid"]
+	allocResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+	instaslice.Status.PodAllocationResults["pod-uid"] = allocResult
+	// the compute instance of the other slice was destroyed externally
+	instaslice = withAllocation(instaslice, "half-uid", "GPU-a", 0, inferencev1alpha1.AllocationStatusUngated)
+	halfResult := instaslice.Status.PodAllocationResults["half-uid"]
+	halfResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+	instaslice.Status.PodAllocationResults["half-uid"] = halfResult
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_1_SLICE, 0, false)
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-uid-cm", Namespace: "default"},
+		Data:       map[string]string{"NVIDIA_VISIBLE_DEVICES": "MIG-lost", "CUDA_VISIBLE_DEVICES": "MIG-lost"},
+	}
+	r := newFakeGPUReconciler(backend, instaslice, configMap)
+	ctx := context.Background()
+
+	r.checkDrift(ctx)
+	slices := backend.slices("GPU-a")
+	assert.Contains(t, slices, uint32(5))
+	assert.Contains(t, slices, uint32(0))
+	assert.NoError(t, r.Get(ctx, client.ObjectKeyFromObject(configMap), configMap))
+	assert.NotContains(t, configMap.Data["NVIDIA_VISIBLE_DEVICES"], "MIG-lost")
+	assert.Contains(t, configMap.Data["NVIDIA_VISIBLE_DEVICES"], "MIG-GPU-a")
+	condition := slicesInSync(t, r)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, reasonSlicesDrifted, condition.Reason)
+		assert.Contains(t, condition.Message, "Found 2 drifted slices")
+	}
+
+	r.checkDrift(ctx)
+	condition = slicesInSync(t, r)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status, "the slices are created again")
+	}
+}
+
+func TestCheckDriftUnownedSlices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	// the slice of an allocation being created is owned
+	instaslice := withAllocation(readyInstaslice(t, backend), "creating-uid", "GPU-a", 4, inferencev1alpha1.AllocationStatusCreating)
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_1_SLICE, 4, true)
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_2_SLICE, 0, true)
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_1_SLICE, 6, false)
+	r := newFakeGPUReconciler(backend, instaslice)
+	ctx := context.Background()
+
+	r.Config.DriftPolicy = controller.DriftPolicyReport
+	r.checkDrift(ctx)
+	assert.Len(t, backend.slices("GPU-a"), 3, "the unowned slices are only reported")
+	condition := slicesInSync(t, r)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Contains(t, condition.Message, "slice GPU-a@0+2 owned by no allocation, kept")
+		assert.Contains(t, condition.Message, "slice GPU-a@6+1 owned by no allocation, kept")
+		assert.NotContains(t, condition.Message, "GPU-a@4+1")
+	}
+
+	r.Config.DriftPolicy = controller.DriftPolicyDestroy
+	r.checkDrift(ctx)
+	assert.Equal(t, map[uint32]nvml.GpuInstancePlacement{4: {Start: 4, Size: 1}}, backend.slices("GPU-a"))
+
+	r.checkDrift(ctx)
+	condition = slicesInSync(t, r)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	}
+}
+
+func TestCheckDriftSkipsNodeNotReady(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	instaslice := readyInstaslice(t, backend)
+	instaslice.Status.NodeResources.BootID = ""
+	setNodeConditions(&instaslice.Status, "boot-2")
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_7_SLICE, 0, true)
+	r := newFakeGPUReconciler(backend, instaslice)
+	r.Config.DriftPolicy = controller.DriftPolicyDestroy
+
+	r.checkDrift(context.Background())
+	assert.Len(t, backend.slices("GPU-a"), 1)
+	assert.Nil(t, slicesInSync(t, r))
+}
+
+func TestCheckDriftReleasesAdoptedSlices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	createFakeSlice(t, backend, "GPU-a", nvml.GPU_INSTANCE_PROFILE_3_SLICE, 4, true)
+	r := newFakeGPUReconciler(backend, readyInstaslice(t, backend))
+	r.PodResources = &fakePodResources{}
+	ctx := context.Background()
+	assert.NoError(t, r.adoptExistingSlices(ctx))
+	assert.Contains(t, getInstaslice(t, r).Status.PodAllocationResults, types.UID("adopted-GPU-a-4"))
+
+	r.checkDrift(ctx)
+	assert.Len(t, backend.slices("GPU-a"), 1, "adopted slices are kept")
+	assert.Contains(t, getInstaslice(t, r).Status.PodAllocationResults, types.UID("adopted-GPU-a-4"))
+
+	// the slice is destroyed by its owner
+	drift, err := r.detectDrift(getInstaslice(t, r))
+	assert.NoError(t, err)
+	assert.Empty(t, drift.unowned)
+	slices, err := r.listSlices(getInstaslice(t, r), "GPU-a")
+	if assert.NoError(t, err) && assert.Len(t, slices, 1) {
+		assert.NoError(t, r.destroySlice(slices[0]))
+	}
+	r.checkDrift(ctx)
+	instaslice := getInstaslice(t, r)
+	assert.NotContains(t, instaslice.Status.PodAllocationResults, types.UID("adopted-GPU-a-4"), "the allocation of the slice is released")
+	assert.NotContains(t, instaslice.Spec.PodAllocationRequests, types.UID("adopted-GPU-a-4"))
+	condition := slicesInSync(t, r)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	}
+}
@@ -0,0 +1,532 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// fakeGIProfile is a GPU instance profile of the fake GPUs
+type fakeGIProfile struct {
+	sliceCount   uint32
+	memorySizeMB uint64
+	// size is the number of memory slots of a GPU instance of the profile
+	size   uint32
+	starts []uint32
+}
+
+// fakeA100Profiles are the GPU instance profiles of an A100-40GB, the other profiles are not
+// supported
+var fakeA100Profiles = map[int]fakeGIProfile{
+	nvml.GPU_INSTANCE_PROFILE_1_SLICE: {sliceCount: 1, memorySizeMB: 4864, size: 1, starts: []uint32{0, 1, 2, 3, 4, 5, 6}},
+	nvml.GPU_INSTANCE_PROFILE_2_SLICE: {sliceCount: 2, memorySizeMB: 9856, size: 2, starts: []uint32{0, 2, 4}},
+	nvml.GPU_INSTANCE_PROFILE_3_SLICE: {sliceCount: 3, memorySizeMB: 19968, size: 4, starts: []uint32{0, 4}},
+	nvml.GPU_INSTANCE_PROFILE_4_SLICE: {sliceCount: 4, memorySizeMB: 19968, size: 4, starts: []uint32{0}},
+	nvml.GPU_INSTANCE_PROFILE_7_SLICE: {sliceCount: 7, memorySizeMB: 40192, size: 8, starts: []uint32{0}},
+}
+
+// fakeCISliceCounts are the slice counts of the compute instance profiles
+var fakeCISliceCounts = map[int]uint32{
+	nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 1,
+	nvml.COMPUTE_INSTANCE_PROFILE_2_SLICE: 2,
+	nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE: 3,
+	nvml.COMPUTE_INSTANCE_PROFILE_4_SLICE: 4,
+	nvml.COMPUTE_INSTANCE_PROFILE_7_SLICE: 7,
+}
+
+const (
+	fakeA100MemoryBytes = 40960 * 1024 * 1024
+	fakeMaxMigDevices   = 7
+)
+
+// fakeGPUBackend is an in-memory GPUBackend of A100-40GB GPUs. It enforces the placement rules
+// of MIG: a GPU instance is created at one of the starts of its profile on free memory slots,
+// a compute instance is created per GPU instance and a GPU instance is destroyed once its
+// compute instance is. The calls to NVML can be failed by method name and XID events can be
+// raised on the GPUs.
+type fakeGPUBackend struct {
+	mu        sync.Mutex
+	gpus      []*fakeGPU
+	initErr   error
+	eventSets []*fakeEventSet
+	// failures are the return codes of the failed methods, by method name
+	failures map[string]nvml.Return
+}
+
+// newFakeGPUBackend returns a backend of MIG enabled GPUs with the given UUIDs
+func newFakeGPUBackend(uuids ...string) *fakeGPUBackend {
+	b := &fakeGPUBackend{failures: make(map[string]nvml.Return)}
+	for _, uuid := range uuids {
+		b.gpus = append(b.gpus, &fakeGPU{
+			backend:        b,
+			uuid:           uuid,
+			migMode:        nvml.DEVICE_MIG_ENABLE,
+			pendingMigMode: nvml.DEVICE_MIG_ENABLE,
+			instances:      make(map[uint32]*fakeGpuInstance),
+		})
+	}
+	return b
+}
+
+// fail makes the method return the code until it is failed with nvml.SUCCESS
+func (b *fakeGPUBackend) fail(method string, ret nvml.Return) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ret == nvml.SUCCESS {
+		delete(b.failures, method)
+		return
+	}
+	b.failures[method] = ret
+}
+
+// failure returns the code the method fails with, the lock is held by the caller
+func (b *fakeGPUBackend) failure(method string) (nvml.Return, bool) {
+	ret, ok := b.failures[method]
+	return ret, ok
+}
+
+// gpu returns the fake GPU with the UUID
+func (b *fakeGPUBackend) gpu(uuid string) *fakeGPU {
+	for _, gpu := range b.gpus {
+		if gpu.uuid == uuid {
+			return gpu
+		}
+	}
+	return nil
+}
+
+func (b *fakeGPUBackend) Init() error {
+	return b.initErr
+}
+
+func (b *fakeGPUBackend) DeviceGetCount() (int, nvml.Return) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ret, ok := b.failure("DeviceGetCount"); ok {
+		return 0, ret
+	}
+	return len(b.gpus), nvml.SUCCESS
+}
+
+func (b *fakeGPUBackend) DeviceGetHandleByIndex(index int) (nvml.Device, nvml.Return) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ret, ok := b.failure("DeviceGetHandleByIndex"); ok {
+		return nil, ret
+	}
+	if index < 0 || index >= len(b.gpus) {
+		return nil, nvml.ERROR_INVALID_ARGUMENT
+	}
+	return b.gpus[index], nvml.SUCCESS
+}
+
+func (b *fakeGPUBackend) DeviceGetHandleByUUID(uuid string) (nvml.Device, nvml.Return) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ret, ok := b.failure("DeviceGetHandleByUUID"); ok {
+		return nil, ret
+	}
+	if gpu := b.gpu(uuid); gpu != nil {
+		return gpu, nvml.SUCCESS
+	}
+	return nil, nvml.ERROR_NOT_FOUND
+}
+
+func (b *fakeGPUBackend) EventSetCreate() (nvml.EventSet, nvml.Return) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ret, ok := b.failure("EventSetCreate"); ok {
+		return nil, ret
+	}
+	set := &fakeEventSet{backend: b, registered: make(map[string]uint64)}
+	b.eventSets = append(b.eventSets, set)
+	return set, nvml.SUCCESS
+}
+
+// injectXID raises the XID on the GPU, the event is queued on the sets the XID events of the
+// GPU are registered with
+func (b *fakeGPUBackend) injectXID(uuid string, xid uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, set := range b.eventSets {
+		if set.registered[uuid]&nvml.EventTypeXidCriticalError != 0 {
+			set.events = append(set.events, nvml.EventData{Device: b.gpu(uuid), EventType: nvml.EventTypeXidCriticalError, EventData: xid})
+		}
+	}
+}
+
+// slices returns the placements of the GPU instances of the GPU, by start
+func (b *fakeGPUBackend) slices(uuid string) map[uint32]nvml.GpuInstancePlacement {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	placements := make(map[uint32]nvml.GpuInstancePlacement)
+	for _, gi := range b.gpu(uuid).instances {
+		placements[gi.placement.Start] = gi.placement
+	}
+	return placements
+}
+
+// disableMig disables MIG mode on the GPU, a change of MIG mode is activated right away unless
+// the GPU requires a reset
+func (b *fakeGPUBackend) disableMig(uuid string, resetRequired bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gpu := b.gpu(uuid)
+	gpu.migMode, gpu.pendingMigMode, gpu.resetRequired = nvml.DEVICE_MIG_DISABLE, nvml.DEVICE_MIG_DISABLE, resetRequired
+}
+
+// reset resets the GPU, its pending MIG mode is activated
+func (b *fakeGPUBackend) reset(uuid string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gpu := b.gpu(uuid)
+	gpu.migMode = gpu.pendingMigMode
+}
+
+// fakeGPU is a physical GPU, the methods the daemonset doesn't use panic
+type fakeGPU struct {
+	nvml.Device
+	backend        *fakeGPUBackend
+	uuid           string
+	migMode        int
+	pendingMigMode int
+	resetRequired  bool
+	// processes are the compute processes running on the GPU
+	processes []nvml.ProcessInfo
+	instances map[uint32]*fakeGpuInstance
+	nextID    uint32
+}
+
+func (d *fakeGPU) GetUUID() (string, nvml.Return) {
+	return d.uuid, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetName() (string, nvml.Return) {
+	return "NVIDIA A100-PCIE-40GB", nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetMemoryInfo() (nvml.Memory, nvml.Return) {
+	return nvml.Memory{Total: fakeA100MemoryBytes, Free: fakeA100MemoryBytes}, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetMigMode() (int, int, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("GetMigMode"); ok {
+		return 0, 0, ret
+	}
+	return d.migMode, d.pendingMigMode, nvml.SUCCESS
+}
+
+func (d *fakeGPU) SetMigMode(mode int) (nvml.Return, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("SetMigMode"); ok {
+		return nvml.ERROR_UNKNOWN, ret
+	}
+	if len(d.processes) > 0 {
+		return nvml.ERROR_UNKNOWN, nvml.ERROR_IN_USE
+	}
+	d.pendingMigMode = mode
+	if d.resetRequired {
+		return nvml.ERROR_RESET_REQUIRED, nvml.SUCCESS
+	}
+	d.migMode = mode
+	return nvml.SUCCESS, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetComputeRunningProcesses() ([]nvml.ProcessInfo, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	return append([]nvml.ProcessInfo(nil), d.processes...), nvml.SUCCESS
+}
+
+func (d *fakeGPU) RegisterEvents(eventTypes uint64, set nvml.EventSet) nvml.Return {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("RegisterEvents"); ok {
+		return ret
+	}
+	fakeSet, ok := set.(*fakeEventSet)
+	if !ok {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	fakeSet.registered[d.uuid] |= eventTypes
+	return nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetGpuInstanceProfileInfo(profile int) (nvml.GpuInstanceProfileInfo, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("GetGpuInstanceProfileInfo"); ok {
+		return nvml.GpuInstanceProfileInfo{}, ret
+	}
+	if d.migMode != nvml.DEVICE_MIG_ENABLE {
+		return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+	if profile < 0 || profile >= nvml.GPU_INSTANCE_PROFILE_COUNT {
+		return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_INVALID_ARGUMENT
+	}
+	giProfile, ok := fakeA100Profiles[profile]
+	if !ok {
+		return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+	return nvml.GpuInstanceProfileInfo{
+		Id:            uint32(profile),
+		SliceCount:    giProfile.sliceCount,
+		InstanceCount: uint32(len(giProfile.starts)),
+		MemorySizeMB:  giProfile.memorySizeMB,
+	}, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetGpuInstancePossiblePlacements(info *nvml.GpuInstanceProfileInfo) ([]nvml.GpuInstancePlacement, nvml.Return) {
+	giProfile, ok := fakeA100Profiles[int(info.Id)]
+	if !ok {
+		return nil, nvml.ERROR_NOT_SUPPORTED
+	}
+	placements := make([]nvml.GpuInstancePlacement, 0, len(giProfile.starts))
+	for _, start := range giProfile.starts {
+		placements = append(placements, nvml.GpuInstancePlacement{Start: start, Size: giProfile.size})
+	}
+	return placements, nvml.SUCCESS
+}
+
+func (d *fakeGPU) CreateGpuInstanceWithPlacement(info *nvml.GpuInstanceProfileInfo, placement *nvml.GpuInstancePlacement) (nvml.GpuInstance, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("CreateGpuInstanceWithPlacement"); ok {
+		return nil, ret
+	}
+	if d.migMode != nvml.DEVICE_MIG_ENABLE {
+		return nil, nvml.ERROR_NOT_SUPPORTED
+	}
+	giProfile, ok := fakeA100Profiles[int(info.Id)]
+	if !ok {
+		return nil, nvml.ERROR_NOT_SUPPORTED
+	}
+	valid := false
+	for _, start := range giProfile.starts {
+		valid = valid || (start == placement.Start && giProfile.size == placement.Size)
+	}
+	if !valid {
+		return nil, nvml.ERROR_INVALID_ARGUMENT
+	}
+	for _, gi := range d.instances {
+		if placement.Start < gi.placement.Start+gi.placement.Size && gi.placement.Start < placement.Start+placement.Size {
+			return nil, nvml.ERROR_INSUFFICIENT_RESOURCES
+		}
+	}
+	d.nextID++
+	gi := &fakeGpuInstance{gpu: d, id: d.nextID, profileID: info.Id, placement: *placement}
+	d.instances[gi.id] = gi
+	return gi, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetGpuInstances(info *nvml.GpuInstanceProfileInfo) ([]nvml.GpuInstance, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if ret, ok := d.backend.failure("GetGpuInstances"); ok {
+		return nil, ret
+	}
+	var instances []nvml.GpuInstance
+	for _, gi := range d.sortedInstances() {
+		if gi.profileID == info.Id {
+			instances = append(instances, gi)
+		}
+	}
+	return instances, nvml.SUCCESS
+}
+
+func (d *fakeGPU) GetGpuInstanceById(id int) (nvml.GpuInstance, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	if gi, ok := d.instances[uint32(id)]; ok {
+		return gi, nvml.SUCCESS
+	}
+	return nil, nvml.ERROR_NOT_FOUND
+}
+
+func (d *fakeGPU) GetMaxMigDeviceCount() (int, nvml.Return) {
+	return fakeMaxMigDevices, nvml.SUCCESS
+}
+
+// GetMigDeviceHandleByIndex returns the MIG devices of the compute instances, by GPU instance ID
+func (d *fakeGPU) GetMigDeviceHandleByIndex(index int) (nvml.Device, nvml.Return) {
+	d.backend.mu.Lock()
+	defer d.backend.mu.Unlock()
+	var migDevices []nvml.Device
+	for _, gi := range d.sortedInstances() {
+		if gi.ci != nil {
+			migDevices = append(migDevices, &fakeMigDevice{gi: gi, ciID: gi.ci.id})
+		}
+	}
+	if index < 0 || index >= fakeMaxMigDevices {
+		return nil, nvml.ERROR_INVALID_ARGUMENT
+	}
+	if index >= len(migDevices) {
+		return nil, nvml.ERROR_NOT_FOUND
+	}
+	return migDevices[index], nvml.SUCCESS
+}
+
+// sortedInstances returns the GPU instances by ID, the lock is held by the caller
+func (d *fakeGPU) sortedInstances() []*fakeGpuInstance {
+	instances := make([]*fakeGpuInstance, 0, len(d.instances))
+	for _, gi := range d.instances {
+		instances = append(instances, gi)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].id < instances[j].id })
+	return instances
+}
+
+// fakeGpuInstance is a GPU instance holding at most one compute instance
+type fakeGpuInstance struct {
+	nvml.GpuInstance
+	gpu       *fakeGPU
+	id        uint32
+	profileID uint32
+	placement nvml.GpuInstancePlacement
+	ci        *fakeComputeInstance
+}
+
+func (gi *fakeGpuInstance) GetInfo() (nvml.GpuInstanceInfo, nvml.Return) {
+	return nvml.GpuInstanceInfo{Device: gi.gpu, Id: gi.id, ProfileId: gi.profileID, Placement: gi.placement}, nvml.SUCCESS
+}
+
+func (gi *fakeGpuInstance) GetComputeInstanceProfileInfo(profile int, engProfile int) (nvml.ComputeInstanceProfileInfo, nvml.Return) {
+	sliceCount, ok := fakeCISliceCounts[profile]
+	if !ok || engProfile != nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED {
+		return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+	if sliceCount > fakeA100Profiles[int(gi.profileID)].sliceCount {
+		return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+	}
+	return nvml.ComputeInstanceProfileInfo{Id: uint32(profile), SliceCount: sliceCount, InstanceCount: 1}, nvml.SUCCESS
+}
+
+func (gi *fakeGpuInstance) CreateComputeInstance(info *nvml.ComputeInstanceProfileInfo) (nvml.ComputeInstance, nvml.Return) {
+	gi.gpu.backend.mu.Lock()
+	defer gi.gpu.backend.mu.Unlock()
+	if ret, ok := gi.gpu.backend.failure("CreateComputeInstance"); ok {
+		return nil, ret
+	}
+	if gi.ci != nil {
+		return nil, nvml.ERROR_INSUFFICIENT_RESOURCES
+	}
+	gi.ci = &fakeComputeInstance{gi: gi, id: 0, profileID: info.Id}
+	return gi.ci, nvml.SUCCESS
+}
+
+func (gi *fakeGpuInstance) GetComputeInstanceById(id int) (nvml.ComputeInstance, nvml.Return) {
+	gi.gpu.backend.mu.Lock()
+	defer gi.gpu.backend.mu.Unlock()
+	if gi.ci == nil || gi.ci.id != uint32(id) {
+		return nil, nvml.ERROR_NOT_FOUND
+	}
+	return gi.ci, nvml.SUCCESS
+}
+
+func (gi *fakeGpuInstance) Destroy() nvml.Return {
+	gi.gpu.backend.mu.Lock()
+	defer gi.gpu.backend.mu.Unlock()
+	if ret, ok := gi.gpu.backend.failure("GpuInstance.Destroy"); ok {
+		return ret
+	}
+	if gi.ci != nil {
+		return nvml.ERROR_IN_USE
+	}
+	if _, ok := gi.gpu.instances[gi.id]; !ok {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	delete(gi.gpu.instances, gi.id)
+	return nvml.SUCCESS
+}
+
+// fakeComputeInstance is the compute instance of a GPU instance
+type fakeComputeInstance struct {
+	nvml.ComputeInstance
+	gi        *fakeGpuInstance
+	id        uint32
+	profileID uint32
+}
+
+func (ci *fakeComputeInstance) GetInfo() (nvml.ComputeInstanceInfo, nvml.Return) {
+	return nvml.ComputeInstanceInfo{Device: ci.gi.gpu, GpuInstance: ci.gi, Id: ci.id, ProfileId: ci.profileID}, nvml.SUCCESS
+}
+
+func (ci *fakeComputeInstance) Destroy() nvml.Return {
+	ci.gi.gpu.backend.mu.Lock()
+	defer ci.gi.gpu.backend.mu.Unlock()
+	if ret, ok := ci.gi.gpu.backend.failure("ComputeInstance.Destroy"); ok {
+		return ret
+	}
+	if ci.gi.ci != ci {
+		return nvml.ERROR_INVALID_ARGUMENT
+	}
+	ci.gi.ci = nil
+	return nvml.SUCCESS
+}
+
+// fakeMigDevice is the MIG device of a compute instance
+type fakeMigDevice struct {
+	nvml.Device
+	gi   *fakeGpuInstance
+	ciID uint32
+}
+
+func (m *fakeMigDevice) GetUUID() (string, nvml.Return) {
+	return fmt.Sprintf("MIG-%s-%d-%d", m.gi.gpu.uuid, m.gi.id, m.ciID), nvml.SUCCESS
+}
+
+func (m *fakeMigDevice) GetGpuInstanceId() (int, nvml.Return) {
+	return int(m.gi.id), nvml.SUCCESS
+}
+
+func (m *fakeMigDevice) GetComputeInstanceId() (int, nvml.Return) {
+	return int(m.ciID), nvml.SUCCESS
+}
+
+// fakeEventSet queues the events raised on the GPUs registered with it, waiting for an event
+// doesn't block
+type fakeEventSet struct {
+	backend *fakeGPUBackend
+	// registered are the event types registered, by GPU UUID
+	registered map[string]uint64
+	events     []nvml.EventData
+}
+
+func (s *fakeEventSet) Wait(_ uint32) (nvml.EventData, nvml.Return) {
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	if ret, ok := s.backend.failure("EventSet.Wait"); ok {
+		return nvml.EventData{}, ret
+	}
+	if len(s.events) == 0 {
+		return nvml.EventData{}, nvml.ERROR_TIMEOUT
+	}
+	data := s.events[0]
+	s.events = s.events[1:]
+	return data, nvml.SUCCESS
+}
+
+func (s *fakeEventSet) Free() nvml.Return {
+	return nvml.SUCCESS
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// GPUBackend is the part of NVML the daemonset uses to discover the GPUs of the node and to
+// create and destroy their MIG slices. The devices, GPU instances and compute instances it
+// returns are the NVML ones, so that the backend can be replaced by an in-memory fake in tests.
+type GPUBackend interface {
+	// Init initializes the backend, a failed initialization is attempted again by the next call
+	Init() error
+	DeviceGetCount() (int, nvml.Return)
+	DeviceGetHandleByIndex(index int) (nvml.Device, nvml.Return)
+	DeviceGetHandleByUUID(uuid string) (nvml.Device, nvml.Return)
+	// EventSetCreate creates a set the events of the devices are registered with
+	EventSetCreate() (nvml.EventSet, nvml.Return)
+}
+
+// nvmlBackend is the GPUBackend of the GPUs of the node, NVML is initialized once per process
+type nvmlBackend struct {
+	mu          sync.Mutex
+	initialized bool
+}
+
+var defaultGPUBackend = &nvmlBackend{}
+
+func (b *nvmlBackend) Init() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.initialized {
+		return nil
+	}
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to initialize NVML: %v", ret)
+	}
+	b.initialized = true
+	return nil
+}
+
+func (b *nvmlBackend) DeviceGetCount() (int, nvml.Return) {
+	return nvml.DeviceGetCount()
+}
+
+func (b *nvmlBackend) DeviceGetHandleByIndex(index int) (nvml.Device, nvml.Return) {
+	return nvml.DeviceGetHandleByIndex(index)
+}
+
+func (b *nvmlBackend) DeviceGetHandleByUUID(uuid string) (nvml.Device, nvml.Return) {
+	return nvml.DeviceGetHandleByUUID(uuid)
+}
+
+func (b *nvmlBackend) EventSetCreate() (nvml.EventSet, nvml.Return) {
+	return nvml.EventSetCreate()
+}
+
+// gpu returns the GPU backend of the reconciler, NVML when none is set
+func (r *InstaSliceDaemonsetReconciler) gpu() GPUBackend {
+	if r.GPU != nil {
+		return r.GPU
+	}
+	return defaultGPUBackend
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+)
+
+const fakeNodeName = "gpu-node"
+
+// newFakeGPUReconciler returns a reconciler of the node backed by the fake GPUs
+func newFakeGPUReconciler(backend *fakeGPUBackend, objects ...client.Object) *InstaSliceDaemonsetReconciler {
+	s := scheme.Scheme
+	_ = v1.AddToScheme(s)
+	_ = inferencev1alpha1.AddToScheme(s)
+	return &InstaSliceDaemonsetReconciler{
+		Client:   fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&inferencev1alpha1.Instaslice{}).WithObjects(objects...).Build(),
+		NodeName: fakeNodeName,
+		Config:   &config.Config{},
+		GPU:      backend,
+	}
+}
+
+// discoveredInstaslice returns the Instaslice of the node with the GPUs discovered on the backend
+func discoveredInstaslice(t *testing.T, r *InstaSliceDaemonsetReconciler) *inferencev1alpha1.Instaslice {
+	instaslice := &inferencev1alpha1.Instaslice{
+		ObjectMeta: metav1.ObjectMeta{Name: fakeNodeName, Namespace: controller.InstaSliceOperatorNamespace},
+	}
+	instaslice, _, _, err := r.discoverAvailableProfilesOnGpus(instaslice)
+	assert.NoError(t, err)
+	instaslice.Status.NodeResources.BootID = "boot-1"
+	instaslice.Status.Conditions = []metav1.Condition{discoveredCondition(instaslice, nil)}
+	instaslice.Status.Conditions[0].LastTransitionTime = metav1.Now()
+	return instaslice
+}
+
+// withAllocation adds the allocation of a 1g.5gb slice for the pod
+func withAllocation(instaslice *inferencev1alpha1.Instaslice, podUID types.UID, gpuUUID string, start int32, controllerStatus inferencev1alpha1.AllocationStatusController) *inferencev1alpha1.Instaslice {
+	if instaslice.Spec.PodAllocationRequests == nil {
+		instaslice.Spec.PodAllocationRequests = make(map[types.UID]inferencev1alpha1.AllocationRequest)
+		instaslice.Status.PodAllocationResults = make(map[types.UID]inferencev1alpha1.AllocationResult)
+	}
+	instaslice.Spec.PodAllocationRequests[podUID] = inferencev1alpha1.AllocationRequest{
+		Profile: "1g.5gb",
+		PodRef:  v1.ObjectReference{Name: string(podUID), Namespace: "default", UID: podUID},
+	}
+	instaslice.Status.PodAllocationResults[podUID] = inferencev1alpha1.AllocationResult{
+		MigPlacement:                inferencev1alpha1.Placement{Start: start, Size: 1},
+		GPUUUID:                     gpuUUID,
+		Nodename:                    types.NodeName(fakeNodeName),
+		ConfigMapResourceIdentifier: podUID + "-cm",
+		AllocationStatus:            inferencev1alpha1.AllocationStatus{AllocationStatusController: controllerStatus},
+	}
+	return instaslice
+}
+
+func TestDiscoverAvailableProfilesOnGpus(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b")
+	r := newFakeGPUReconciler(backend)
+
+	instaslice := discoveredInstaslice(t, r)
+	gpus := instaslice.Status.NodeResources.NodeGPUs
+	if assert.Len(t, gpus, 2) {
+		assert.Equal(t, "GPU-a", gpus[0].GPUUUID)
+		assert.Equal(t, "GPU-b", gpus[1].GPUUUID)
+		assert.Equal(t, "NVIDIA A100-PCIE-40GB", gpus[0].GPUName)
+	}
+	placements := instaslice.Status.NodeResources.MigPlacement
+	assert.Len(t, placements, 5)
+	assert.Len(t, placements["1g.5gb"].Placements, 7)
+	assert.Equal(t, []inferencev1alpha1.Placement{{Start: 0, Size: 4}, {Start: 4, Size: 4}}, placements["3g.20gb"].Placements)
+	assert.Equal(t, int32(nvml.GPU_INSTANCE_PROFILE_7_SLICE), placements["7g.40gb"].GIProfileID)
+
+	backend.fail("GetMigMode", nvml.ERROR_NOT_SUPPORTED)
+	_, _, _, err := r.discoverAvailableProfilesOnGpus(&inferencev1alpha1.Instaslice{})
+	assert.Error(t, err, "the MIG mode can't be detected")
+
+	backend.fail("GetMigMode", nvml.SUCCESS)
+	backend.fail("DeviceGetCount", nvml.ERROR_UNINITIALIZED)
+	_, ret, _, err := r.discoverAvailableProfilesOnGpus(&inferencev1alpha1.Instaslice{})
+	assert.Error(t, err)
+	assert.Equal(t, nvml.ERROR_UNINITIALIZED, ret)
+}
+
+func TestDiscoverSkipsMigDisabledGPUs(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b", "GPU-c")
+	backend.disableMig("GPU-a", false)
+	r := newFakeGPUReconciler(backend)
+
+	instaslice := discoveredInstaslice(t, r)
+	gpus := instaslice.Status.NodeResources.NodeGPUs
+	if assert.Len(t, gpus, 2, "no entry is left for the GPU with MIG disabled") {
+		assert.Equal(t, "GPU-b", gpus[0].GPUUUID)
+		assert.Equal(t, "GPU-c", gpus[1].GPUUUID)
+	}
+	assert.Len(t, instaslice.Status.NodeResources.MigPlacement, 5)
+	assert.Equal(t, "Discovered 2 MIG enabled GPUs.", discoveredCondition(instaslice, nil).Message)
+}
+
+func TestCreateSliceAndPopulateMigInfos(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	r := newFakeGPUReconciler(backend)
+	ctx := context.Background()
+	device, _ := backend.DeviceGetHandleByUUID("GPU-a")
+	profile := func(id int) nvml.GpuInstanceProfileInfo {
+		info, ret := device.GetGpuInstanceProfileInfo(id)
+		assert.Equal(t, nvml.SUCCESS, ret)
+		return info
+	}
+
+	migInfos, err := r.createSliceAndPopulateMigInfos(ctx, device, profile(nvml.GPU_INSTANCE_PROFILE_3_SLICE), nvml.GpuInstancePlacement{Start: 4, Size: 4}, nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE, "pod-3g")
+	assert.NoError(t, err)
+	if assert.Len(t, migInfos, 1) {
+		for _, migInfo := range migInfos {
+			assert.Equal(t, "GPU-a", migInfo.uuid)
+			assert.Equal(t, int32(4), migInfo.start)
+			assert.Equal(t, int32(4), migInfo.size)
+		}
+	}
+
+	// the slots are held by the 3g.20gb slice
+	_, err = r.createSliceAndPopulateMigInfos(ctx, device, profile(nvml.GPU_INSTANCE_PROFILE_1_SLICE), nvml.GpuInstancePlacement{Start: 5, Size: 1}, nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE, "pod-1g")
+	assert.Error(t, err)
+
+	// not a placement of the profile
+	_, err = r.createSliceAndPopulateMigInfos(ctx, device, profile(nvml.GPU_INSTANCE_PROFILE_2_SLICE), nvml.GpuInstancePlacement{Start: 1, Size: 2}, nvml.COMPUTE_INSTANCE_PROFILE_2_SLICE, "pod-2g")
+	assert.Error(t, err)
+
+	// the GPU instance of a previous attempt is reused
+	oneSlice := profile(nvml.GPU_INSTANCE_PROFILE_1_SLICE)
+	_, ret := device.CreateGpuInstanceWithPlacement(&oneSlice, &nvml.GpuInstancePlacement{Start: 0, Size: 1})
+	assert.Equal(t, nvml.SUCCESS, ret)
+	migInfos, err = r.createSliceAndPopulateMigInfos(ctx, device, oneSlice, nvml.GpuInstancePlacement{Start: 0, Size: 1}, nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE, "pod-1g")
+	assert.NoError(t, err)
+	assert.Len(t, migInfos, 2)
+	assert.Len(t, backend.slices("GPU-a"), 2)
+
+	backend.fail("CreateGpuInstanceWithPlacement", nvml.ERROR_UNKNOWN)
+	_, err = r.createSliceAndPopulateMigInfos(ctx, device, oneSlice, nvml.GpuInstancePlacement{Start: 1, Size: 1}, nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE, "pod-1g")
+	assert.Error(t, err)
+}
+
+func TestCleanUpCiAndGi(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	r := newFakeGPUReconciler(backend)
+	ctx := context.Background()
+	instaslice := withAllocation(discoveredInstaslice(t, r), "pod-uid", "GPU-a", 2, inferencev1alpha1.AllocationStatusCreating)
+	allocResult := instaslice.Status.PodAllocationResults["pod-uid"]
+	podRef := instaslice.Spec.PodAllocationRequests["pod-uid"].PodRef
+
+	assert.NoError(t, r.createCiAndGiProfiles(ctx, instaslice, "pod-uid"))
+	assert.Contains(t, backend.slices("GPU-a"), uint32(2))
+
+	backend.fail("ComputeInstance.Destroy", nvml.ERROR_UNKNOWN)
+	assert.Error(t, r.cleanUpCiAndGi(ctx, &allocResult, podRef))
+	assert.Contains(t, backend.slices("GPU-a"), uint32(2))
+
+	backend.fail("ComputeInstance.Destroy", nvml.SUCCESS)
+	assert.NoError(t, r.cleanUpCiAndGi(ctx, &allocResult, podRef))
+	assert.Empty(t, backend.slices("GPU-a"))
+
+	// there is nothing left to clean up
+	assert.NoError(t, r.cleanUpCiAndGi(ctx, &allocResult, podRef))
+
+	allocResult.GPUUUID = "GPU-unknown"
+	assert.Error(t, r.cleanUpCiAndGi(ctx, &allocResult, podRef))
+}
+
+func TestCreateCiAndGiProfilesAfterReboot(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	r := newFakeGPUReconciler(backend)
+	ctx := context.Background()
+	instaslice := withAllocation(discoveredInstaslice(t, r), "pod-uid", "GPU-a", 3, inferencev1alpha1.AllocationStatusUngated)
+
+	assert.NoError(t, r.createCiAndGiProfiles(ctx, instaslice, "pod-uid"))
+	configMap := &v1.ConfigMap{}
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: "pod-uid-cm", Namespace: "default"}, configMap))
+	migUUID := configMap.Data["NVIDIA_VISIBLE_DEVICES"]
+	assert.Contains(t, migUUID, "MIG-GPU-a")
+
+	// the slice of a previous attempt is reused
+	assert.NoError(t, r.createCiAndGiProfiles(ctx, instaslice, "pod-uid"))
+	assert.Len(t, backend.slices("GPU-a"), 1)
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: "pod-uid-cm", Namespace: "default"}, configMap))
+	assert.Equal(t, migUUID, configMap.Data["NVIDIA_VISIBLE_DEVICES"])
+
+	instaslice = withAllocation(instaslice, "other-uid", "GPU-unknown", 0, inferencev1alpha1.AllocationStatusUngated)
+	assert.Error(t, r.createCiAndGiProfiles(ctx, instaslice, "other-uid"))
+}
+
+func TestCreateCiAndGiProfilesReplacesLostMigDevices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	r := newFakeGPUReconciler(backend)
+	ctx := context.Background()
+	instaslice := withAllocation(discoveredInstaslice(t, r), "pod-uid", "GPU-a", 0, inferencev1alpha1.AllocationStatusUngated)
+	instaslice = withAllocation(instaslice, "second-uid", "GPU-a", 1, inferencev1alpha1.AllocationStatusUngated)
+	// both slices of the container share the configmap, it holds the devices lost in the reboot
+	second := instaslice.Status.PodAllocationResults["second-uid"]
+	second.ConfigMapResourceIdentifier = "pod-uid-cm"
+	instaslice.Status.PodAllocationResults["second-uid"] = second
+	assert.NoError(t, r.addMigDeviceToConfigMap(ctx, "MIG-lost-1", "default", "pod-uid-cm"))
+	assert.NoError(t, r.addMigDeviceToConfigMap(ctx, "MIG-lost-2", "default", "pod-uid-cm"))
+
+	assert.NoError(t, r.createCiAndGiProfiles(ctx, instaslice, "pod-uid"))
+	assert.NoError(t, r.createCiAndGiProfiles(ctx, instaslice, "second-uid"))
+	configMap := &v1.ConfigMap{}
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: "pod-uid-cm", Namespace: "default"}, configMap))
+	devices := configMapMigDevices(configMap)
+	assert.Len(t, devices, 2)
+	assert.NotContains(t, devices, "MIG-lost-1")
+	assert.NotContains(t, devices, "MIG-lost-2")
+	for _, device := range devices {
+		assert.Contains(t, device, "MIG-GPU-a")
+	}
+}
+
+func TestReconcileCreatesAndDeletesSlices(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: fakeNodeName},
+		Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{BootID: "boot-1"}},
+	}
+	instaslice := withAllocation(discoveredInstaslice(t, newFakeGPUReconciler(backend)), "pod-uid", "GPU-a", 6, inferencev1alpha1.AllocationStatusCreating)
+	r := newFakeGPUReconciler(backend, node, instaslice)
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instaslice)}
+	latest := func() *inferencev1alpha1.Instaslice {
+		var latest inferencev1alpha1.Instaslice
+		assert.NoError(t, r.Get(ctx, req.NamespacedName, &latest))
+		return &latest
+	}
+
+	_, err := r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, inferencev1alpha1.AllocationStatusCreated, latest().Status.PodAllocationResults["pod-uid"].AllocationStatus.AllocationStatusDaemonset)
+	assert.Contains(t, backend.slices("GPU-a"), uint32(6))
+	configMap := &v1.ConfigMap{}
+	assert.NoError(t, r.Get(ctx, types.NamespacedName{Name: "pod-uid-cm", Namespace: "default"}, configMap))
+	assert.Contains(t, configMap.Data["NVIDIA_VISIBLE_DEVICES"], "MIG-GPU-a")
+
+	deleting := latest()
+	allocResult := deleting.Status.PodAllocationResults["pod-uid"]
+	allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+	deleting.Status.PodAllocationResults["pod-uid"] = allocResult
+	assert.NoError(t, r.Status().Update(ctx, deleting))
+
+	_, err = r.Reconcile(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleted, latest().Status.PodAllocationResults["pod-uid"].AllocationStatus.AllocationStatusDaemonset)
+	assert.Empty(t, backend.slices("GPU-a"))
+	err = r.Get(ctx, types.NamespacedName{Name: "pod-uid-cm", Namespace: "default"}, configMap)
+	assert.True(t, errors.IsNotFound(err), "the configmap is deleted with the slice")
+}
+
+func TestReconcileWithUnknownGPU(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: fakeNodeName},
+		Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{BootID: "boot-1"}},
+	}
+	instaslice := withAllocation(discoveredInstaslice(t, newFakeGPUReconciler(backend)), "pod-uid", "GPU-gone", 0, inferencev1alpha1.AllocationStatusCreating)
+	r := newFakeGPUReconciler(backend, node, instaslice)
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instaslice)})
+	assert.Error(t, err)
+	assert.Empty(t, backend.slices("GPU-a"))
+}
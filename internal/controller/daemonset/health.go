@@ -0,0 +1,255 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The GPUs report their hardware and driver faults as XID events. A critical XID, e.g. a
+// double bit ECC error (48), a failed row remapping (64) or a GPU that fell off the bus (79),
+// leaves the slices of the GPU unusable. The daemonset waits for the XID events of the GPUs of
+// its node and marks a GPU raising a critical XID unhealthy with the Healthy condition of the
+// GPU in the Instaslice: the controller places no slice on it and can evict the pods using its
+// slices. The GPU is marked healthy again once it raised no critical XID for the recovery
+// period and NVML can reach it.
+
+const (
+	reasonCriticalXID   = "CriticalXID"
+	reasonNoCriticalXID = "NoCriticalXID"
+	// xidWaitTimeout is how long the XID events are waited for before the health of the GPUs
+	// is synced
+	xidWaitTimeout = 5 * time.Second
+)
+
+// criticalXID is the last critical XID a GPU raised
+type criticalXID struct {
+	xid uint64
+	at  time.Time
+}
+
+// ParseCriticalXIDs returns the XIDs of the comma separated list
+func ParseCriticalXIDs(xids string) (map[uint64]bool, error) {
+	critical := make(map[uint64]bool)
+	for _, field := range strings.Split(xids, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		xid, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XID %q: %v", field, err)
+		}
+		critical[xid] = true
+	}
+	return critical, nil
+}
+
+// criticalXIDs returns the XIDs that mark a GPU unhealthy, the configured ones are validated
+// at startup
+func (r *InstaSliceDaemonsetReconciler) criticalXIDs() map[uint64]bool {
+	if r.Config != nil && r.Config.CriticalXIDs != "" {
+		if critical, err := ParseCriticalXIDs(r.Config.CriticalXIDs); err == nil {
+			return critical
+		}
+	}
+	critical, _ := ParseCriticalXIDs(config.DefaultCriticalXIDs)
+	return critical
+}
+
+func (r *InstaSliceDaemonsetReconciler) gpuRecoveryPeriod() time.Duration {
+	if r.Config != nil && r.Config.GPURecoveryPeriod > 0 {
+		return r.Config.GPURecoveryPeriod
+	}
+	return config.DefaultGPURecoveryPeriod
+}
+
+// watchXIDs registers the GPUs of the node for the critical XID events and syncs their health
+// with the events raised until the context is done or the events can't be waited for
+func (r *InstaSliceDaemonsetReconciler) watchXIDs(ctx context.Context) {
+	log := logr.FromContext(ctx)
+	// the driver error is reported by the DriverHealthy condition
+	if err := r.gpu().Init(); err != nil {
+		return
+	}
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get the Instaslice of the node to watch the XID events", "nodeName", r.NodeName)
+		}
+		return
+	}
+	set, ret := r.gpu().EventSetCreate()
+	if ret != nvml.SUCCESS {
+		log.Error(ret, "unable to create the NVML event set")
+		return
+	}
+	defer set.Free()
+	registered := 0
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == "" {
+			continue
+		}
+		device, ret := r.gpu().DeviceGetHandleByUUID(gpu.GPUUUID)
+		if ret == nvml.SUCCESS {
+			ret = device.RegisterEvents(nvml.EventTypeXidCriticalError, set)
+		}
+		if ret != nvml.SUCCESS {
+			log.Error(ret, "unable to register the XID events of the GPU", "gpuUUID", gpu.GPUUUID)
+			continue
+		}
+		registered++
+	}
+	// the GPUs are not discovered yet
+	if registered == 0 {
+		return
+	}
+	critical := r.criticalXIDs()
+	for ctx.Err() == nil && r.waitXIDEvent(ctx, set, critical) {
+		r.syncGPUHealth(ctx)
+	}
+}
+
+// waitXIDEvent waits for the next XID event and records it when the XID is critical. It
+// returns false when the events can't be waited for.
+func (r *InstaSliceDaemonsetReconciler) waitXIDEvent(ctx context.Context, set nvml.EventSet, critical map[uint64]bool) bool {
+	log := logr.FromContext(ctx)
+	data, ret := set.Wait(uint32(xidWaitTimeout.Milliseconds()))
+	if ret == nvml.ERROR_TIMEOUT {
+		return true
+	}
+	if ret != nvml.SUCCESS {
+		log.Error(ret, "unable to wait for the XID events of the GPUs")
+		return false
+	}
+	if data.EventType != nvml.EventTypeXidCriticalError || data.Device == nil {
+		return true
+	}
+	uuid, ret := data.Device.GetUUID()
+	if ret != nvml.SUCCESS {
+		log.Error(ret, "unable to get the UUID of the GPU raising an XID", "xid", data.EventData)
+		return true
+	}
+	if !critical[data.EventData] {
+		log.Info("ignoring a non critical XID", "gpuUUID", uuid, "xid", data.EventData)
+		return true
+	}
+	log.Info("the GPU raised a critical XID", "gpuUUID", uuid, "xid", data.EventData)
+	if r.gpuXIDs == nil {
+		r.gpuXIDs = make(map[string]criticalXID)
+	}
+	r.gpuXIDs[uuid] = criticalXID{xid: data.EventData, at: time.Now()}
+	return true
+}
+
+// syncGPUHealth sets the Healthy condition of the GPUs of the node: a GPU that raised a
+// critical XID within the recovery period is unhealthy, an unhealthy GPU is healthy again
+// once the recovery period passed and NVML can reach it. The GPUs marked unhealthy before a
+// restart of the daemonset recover from the time they were marked.
+func (r *InstaSliceDaemonsetReconciler) syncGPUHealth(ctx context.Context) {
+	log := logr.FromContext(ctx)
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get the Instaslice of the node to sync the health of the GPUs", "nodeName", r.NodeName)
+		}
+		return
+	}
+	original := instaslice.DeepCopy()
+	period := r.gpuRecoveryPeriod()
+	now := time.Now()
+	var recovered []string
+	for i := range instaslice.Status.NodeResources.NodeGPUs {
+		gpu := &instaslice.Status.NodeResources.NodeGPUs[i]
+		if gpu.GPUUUID == "" {
+			continue
+		}
+		last, raised := r.gpuXIDs[gpu.GPUUUID]
+		if raised && now.Sub(last.at) < period {
+			meta.SetStatusCondition(&gpu.Conditions, metav1.Condition{
+				Type:    controller.GPUHealthyCondition,
+				Status:  metav1.ConditionFalse,
+				Reason:  reasonCriticalXID,
+				Message: fmt.Sprintf("The GPU raised the critical XID %d at %s.", last.xid, last.at.UTC().Format(time.RFC3339)),
+			})
+			continue
+		}
+		condition := meta.FindStatusCondition(gpu.Conditions, controller.GPUHealthyCondition)
+		if condition == nil || condition.Status != metav1.ConditionFalse {
+			continue
+		}
+		if !raised && now.Sub(condition.LastTransitionTime.Time) < period {
+			continue
+		}
+		device, ret := r.gpu().DeviceGetHandleByUUID(gpu.GPUUUID)
+		if ret == nvml.SUCCESS {
+			_, _, ret = device.GetMigMode()
+		}
+		if ret != nvml.SUCCESS {
+			log.Info("the unhealthy GPU is not reachable yet", "gpuUUID", gpu.GPUUUID, "error", ret.Error())
+			continue
+		}
+		meta.SetStatusCondition(&gpu.Conditions, metav1.Condition{
+			Type:    controller.GPUHealthyCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonNoCriticalXID,
+			Message: fmt.Sprintf("The GPU raised no critical XID for %s.", period),
+		})
+		recovered = append(recovered, gpu.GPUUUID)
+	}
+	if equality.Semantic.DeepEqual(original.Status.NodeResources.NodeGPUs, instaslice.Status.NodeResources.NodeGPUs) {
+		return
+	}
+	// the health is synced again by the next pass
+	if err := r.Status().Patch(ctx, &instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		if !apierrors.IsConflict(err) {
+			log.Error(err, "unable to update the health of the GPUs", "nodeName", r.NodeName)
+		}
+		return
+	}
+	for _, uuid := range recovered {
+		delete(r.gpuXIDs, uuid)
+		log.Info("the GPU is healthy again", "gpuUUID", uuid)
+	}
+}
+
+// gpuConditions returns the conditions of the GPU in the status of the Instaslice, they are
+// kept when the GPUs are discovered again
+func gpuConditions(instaslice *inferencev1alpha1.Instaslice, gpuUUID string) []metav1.Condition {
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == gpuUUID {
+			return gpu.Conditions
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/instaslice-operator/internal/controller"
+)
+
+// watchedEventSet returns an event set the XID events of the GPUs are registered with
+func watchedEventSet(t *testing.T, backend *fakeGPUBackend, uuids ...string) nvml.EventSet {
+	set, ret := backend.EventSetCreate()
+	assert.Equal(t, nvml.SUCCESS, ret)
+	for _, uuid := range uuids {
+		assert.Equal(t, nvml.SUCCESS, backend.gpu(uuid).RegisterEvents(nvml.EventTypeXidCriticalError, set))
+	}
+	return set
+}
+
+// gpuHealth returns the Healthy condition of the GPU in the Instaslice of the node
+func gpuHealth(t *testing.T, r *InstaSliceDaemonsetReconciler, gpuUUID string) *metav1.Condition {
+	return meta.FindStatusCondition(gpuConditions(getInstaslice(t, r), gpuUUID), controller.GPUHealthyCondition)
+}
+
+func TestParseCriticalXIDs(t *testing.T) {
+	xids, err := ParseCriticalXIDs(" 48, 79,,94 ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint64]bool{48: true, 79: true, 94: true}, xids)
+
+	_, err = ParseCriticalXIDs("48,fell-off-the-bus")
+	assert.Error(t, err)
+}
+
+func TestCriticalXIDMarksGPUUnhealthy(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b")
+	r := newFakeGPUReconciler(backend, readyInstaslice(t, backend))
+	set := watchedEventSet(t, backend, "GPU-a", "GPU-b")
+	critical := r.criticalXIDs()
+	ctx := context.Background()
+
+	// a non critical XID is ignored
+	backend.injectXID("GPU-a", 31)
+	assert.True(t, r.waitXIDEvent(ctx, set, critical))
+	r.syncGPUHealth(ctx)
+	assert.Nil(t, gpuHealth(t, r, "GPU-a"))
+
+	backend.injectXID("GPU-a", 79)
+	assert.True(t, r.waitXIDEvent(ctx, set, critical))
+	r.syncGPUHealth(ctx)
+	condition := gpuHealth(t, r, "GPU-a")
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionFalse, condition.Status)
+		assert.Equal(t, reasonCriticalXID, condition.Reason)
+		assert.Contains(t, condition.Message, "XID 79")
+	}
+	assert.Nil(t, gpuHealth(t, r, "GPU-b"))
+
+	// no event came before the timeout, the GPU stays unhealthy
+	assert.True(t, r.waitXIDEvent(ctx, set, critical))
+	r.syncGPUHealth(ctx)
+	assert.Equal(t, metav1.ConditionFalse, gpuHealth(t, r, "GPU-a").Status)
+
+	// the health is kept when the GPUs are discovered again
+	rediscovered, _, _, err := r.discoverAvailableProfilesOnGpus(getInstaslice(t, r))
+	assert.NoError(t, err)
+	assert.True(t, meta.IsStatusConditionFalse(gpuConditions(rediscovered, "GPU-a"), controller.GPUHealthyCondition))
+
+	// the events can't be waited for anymore
+	backend.fail("EventSet.Wait", nvml.ERROR_GPU_IS_LOST)
+	assert.False(t, r.waitXIDEvent(ctx, set, critical))
+}
+
+func TestUnhealthyGPURecovers(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a")
+	r := newFakeGPUReconciler(backend, readyInstaslice(t, backend))
+	r.Config.GPURecoveryPeriod = time.Minute
+	set := watchedEventSet(t, backend, "GPU-a")
+	ctx := context.Background()
+
+	backend.injectXID("GPU-a", 48)
+	assert.True(t, r.waitXIDEvent(ctx, set, r.criticalXIDs()))
+	r.syncGPUHealth(ctx)
+	assert.Equal(t, metav1.ConditionFalse, gpuHealth(t, r, "GPU-a").Status)
+
+	// the recovery period passed but NVML can't reach the GPU
+	r.gpuXIDs["GPU-a"] = criticalXID{xid: 48, at: time.Now().Add(-2 * time.Minute)}
+	backend.fail("GetMigMode", nvml.ERROR_GPU_IS_LOST)
+	r.syncGPUHealth(ctx)
+	assert.Equal(t, metav1.ConditionFalse, gpuHealth(t, r, "GPU-a").Status)
+
+	backend.fail("GetMigMode", nvml.SUCCESS)
+	r.syncGPUHealth(ctx)
+	condition := gpuHealth(t, r, "GPU-a")
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, metav1.ConditionTrue, condition.Status)
+		assert.Equal(t, reasonNoCriticalXID, condition.Reason)
+	}
+	assert.Empty(t, r.gpuXIDs)
+}
+
+func TestUnhealthyGPURecoversAfterRestart(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b")
+	instaslice := readyInstaslice(t, backend)
+	for i, markedAgo := range []time.Duration{time.Hour, time.Second} {
+		instaslice.Status.NodeResources.NodeGPUs[i].Conditions = []metav1.Condition{{
+			Type:               controller.GPUHealthyCondition,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonCriticalXID,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-markedAgo)),
+		}}
+	}
+	r := newFakeGPUReconciler(backend, instaslice)
+	r.Config.GPURecoveryPeriod = time.Minute
+
+	// the daemonset lost the XIDs, the GPUs recover from the time they were marked
+	r.syncGPUHealth(context.Background())
+	assert.Equal(t, metav1.ConditionTrue, gpuHealth(t, r, "GPU-a").Status)
+	assert.Equal(t, metav1.ConditionFalse, gpuHealth(t, r, "GPU-b").Status)
+}
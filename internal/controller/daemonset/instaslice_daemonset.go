@@ -19,6 +19,7 @@ import (
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -43,6 +44,15 @@ type InstaSliceDaemonsetReconciler struct {
 	kubeClient *kubernetes.Clientset
 	NodeName   string
 	Config     *config.Config
+	// GPU is the backend of the GPUs of the node, NVML when nil
+	GPU GPUBackend
+	// PodResources lists the devices assigned to the pods of the node, the kubelet PodResources
+	// API when nil
+	PodResources PodResourcesLister
+	// slicesMu serializes the changes to the slices of Reconcile and of the drift check
+	slicesMu sync.Mutex
+	// gpuXIDs are the last critical XIDs of the GPUs, only the XID watcher uses them
+	gpuXIDs map[string]criticalXID
 }
 
 // +kubebuilder:rbac:groups=inference.redhat.com,resources=instaslices,verbs=get;list;watch;create;update;patch;delete
@@ -51,10 +61,7 @@ type InstaSliceDaemonsetReconciler struct {
 // +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;update;patch;watch
 // +kubebuilder:rbac:groups="",resources=nodes/status,verbs=get;list;update;patch;watch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
-var (
-	discoveredGpusOnHost []string
-	initNvmlOnce         sync.Once
-)
+var discoveredGpusOnHost []string
 
 // this struct is created to represent profiles
 // in human readable format and perform string comparison
@@ -98,18 +105,12 @@ func NewInstasliceDaemonsetReconciler(
 		Config:   config,
 	}
 
-	var err error
-	initNvmlOnce.Do(func() {
-		if config.EmulatorModeEnable {
-			return
-		}
-		ret := nvml.Init()
-		if ret != nvml.SUCCESS {
-			err = goerror.New("Unable to initialize NVML")
+	// the daemonset keeps running when NVML can't be initialized, the failure is reported by
+	// the DriverHealthy condition and the initialization is retried on reconcile
+	if !config.EmulatorModeEnable {
+		if err := r.gpu().Init(); err != nil {
+			logr.Log.Error(err, "NVML initialization failed", "nodeName", nodeName)
 		}
-	})
-	if err != nil {
-		return nil, err
 	}
 
 	return r, nil
@@ -121,6 +122,8 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 	if req.Name != r.NodeName {
 		return ctrl.Result{}, nil
 	}
+	r.slicesMu.Lock()
+	defer r.slicesMu.Unlock()
 
 	nsName := types.NamespacedName{
 		Name:      r.NodeName,
@@ -156,6 +159,24 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 		log.Error(err, "error getting the node object", "name", r.NodeName)
 		return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, nil
 	}
+	driver := r.driverCondition()
+	if err := r.updateNodeConditions(ctx, &instaslice, node.Status.NodeInfo.BootID, driver); err != nil {
+		log.Error(err, "error updating the conditions of the Instaslice", "nodeName", r.NodeName)
+		return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, nil
+	}
+	// slices can't be created nor deleted without the driver
+	if driver.Status != metav1.ConditionTrue {
+		log.Info("GPU driver is not healthy, retrying", "nodeName", r.NodeName, "message", driver.Message)
+		return ctrl.Result{RequeueAfter: controller.Requeue5sDelay}, nil
+	}
+	if meta.IsStatusConditionFalse(instaslice.Status.Conditions, controller.NodeDiscoveredCondition) {
+		log.Info("Retrying the discovery of the GPUs", "nodeName", r.NodeName)
+		if err := r.discoverMigEnabledGpuWithSlices(); err != nil {
+			log.Error(err, "GPU discovery failed", "nodeName", r.NodeName)
+			return ctrl.Result{RequeueAfter: controller.Requeue5sDelay}, nil
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
 	// update the instaslice object with the Node object's current BootID
 	if instaslice.Status.NodeResources.BootID == "" {
 		originalInstaSliceObj := instaslice.DeepCopy()
@@ -168,7 +189,8 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 	} else {
 		if instaslice.Status.NodeResources.BootID != node.Status.NodeInfo.BootID {
 			for podUID, allocResult := range instaslice.Status.PodAllocationResults {
-				if allocResult.Nodename == types.NodeName(r.NodeName) {
+				// adopted slices aren't created again, the drift check releases them
+				if allocResult.Nodename == types.NodeName(r.NodeName) && !sliceAdopted(allocResult) {
 					if (allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusCreating) || (allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated) || (allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated) {
 						if err := r.createCiAndGiProfiles(ctx, &instaslice, podUID); err != nil {
 							return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, err
@@ -187,14 +209,20 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 
 		}
 	}
+	// the node is ready once the slices are synced with its boot ID
+	if err := r.updateNodeConditions(ctx, &instaslice, node.Status.NodeInfo.BootID); err != nil {
+		log.Error(err, "error updating the conditions of the Instaslice", "nodeName", r.NodeName)
+		return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, nil
+	}
 
 	for podUID, allocResult := range instaslice.Status.PodAllocationResults {
 
 		podRef := instaslice.Spec.PodAllocationRequests[podUID].PodRef
 
-		// 1) Handle "deleting"
+		// 1) Handle "deleting", allocations can be withdrawn by the controller before they
+		// are created, e.g. when the reservation of a pod group is rolled back
 		if allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting &&
-			allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated &&
+			(allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated || allocResult.AllocationStatus.AllocationStatusDaemonset == "") &&
 			allocResult.Nodename == types.NodeName(r.NodeName) {
 
 			log.Info("Performing cleanup for pod", "podRef", podRef)
@@ -204,7 +232,8 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 					log.Error(err, "error checking configmap existence", "podRef", podRef)
 					return ctrl.Result{RequeueAfter: controller.Requeue2sDelay}, err
 				}
-				if exists {
+				// a recycled slice is kept for the allocation it was handed over to
+				if exists && !sliceHandedOver(&instaslice, podUID, allocResult) {
 					err := r.cleanUpCiAndGi(ctx, &allocResult, podRef)
 					if err != nil {
 						// NVML shutdowm took time or NVML init may have failed.
@@ -213,12 +242,15 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 					}
 				}
 			}
-			err := r.deleteConfigMap(ctx,
-				string(allocResult.ConfigMapResourceIdentifier),
-				podRef.Namespace)
-			if err != nil && !errors.IsNotFound(err) {
-				log.Error(err, "error deleting config map for pod", "pod", podRef.Name)
-				return ctrl.Result{Requeue: true}, err
+			// the slices of a container share its configmap, it is deleted with the last one
+			if !configMapInUse(&instaslice, podUID, allocResult.ConfigMapResourceIdentifier) {
+				err := r.deleteConfigMap(ctx,
+					string(allocResult.ConfigMapResourceIdentifier),
+					podRef.Namespace)
+				if err != nil && !errors.IsNotFound(err) {
+					log.Error(err, "error deleting config map for pod", "pod", podRef.Name)
+					return ctrl.Result{Requeue: true}, err
+				}
 			}
 
 			newAlloc := allocResult
@@ -235,11 +267,6 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 		if allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusCreating &&
 			allocResult.AllocationStatus.AllocationStatusDaemonset == "" &&
 			allocResult.Nodename == types.NodeName(r.NodeName) {
-			exists, err := r.checkConfigMapExists(ctx, string(allocResult.ConfigMapResourceIdentifier), podRef.Namespace)
-			if err != nil {
-				log.Error(err, "error obtianing configmap", string(allocResult.ConfigMapResourceIdentifier))
-				return ctrl.Result{RequeueAfter: controller.Requeue2sDelay}, err
-			}
 			log.Info("creating allocation for pod", "podRef", podRef)
 			// We can look up the *request* in spec to see the profile or resource demands
 			allocationRequest, haveReq := instaslice.Spec.PodAllocationRequests[podUID]
@@ -248,43 +275,51 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 				log.Info("No matching PodAllocationRequest for this result; skipping", podRef)
 				continue
 			}
-			if !exists {
-				if r.Config.EmulatorModeEnable {
-					// configmap with fake MIG uuid
-					err := r.createConfigMap(ctx,
-						string(allocResult.ConfigMapResourceIdentifier),
-						podRef.Namespace,
-						string(allocResult.ConfigMapResourceIdentifier))
-					if err != nil {
-						log.Error(err, "failed to create config map (emulator mode)")
-						return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, err
-					}
-					// Emulating cost to create CI and GI on a GPU
-					time.Sleep(controller.Requeue1sDelay)
-				} else {
-					device, retCode := nvml.DeviceGetHandleByUUID(allocResult.GPUUUID)
-					if retCode != nvml.SUCCESS {
-						log.Error(retCode, "error getting GPU device handle", "gpuUUID", allocResult.GPUUUID)
-						return ctrl.Result{}, goerror.New("error fetching GPU device handle")
-					}
+			// the configmap of the container lists the MIG devices of all its slices
+			if r.Config.EmulatorModeEnable {
+				// configmap with fake MIG uuid
+				err := r.addMigDeviceToConfigMap(ctx,
+					string(podUID),
+					podRef.Namespace,
+					string(allocResult.ConfigMapResourceIdentifier))
+				if err != nil {
+					log.Error(err, "failed to create config map (emulator mode)")
+					return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, err
+				}
+				// Emulating cost to create CI and GI on a GPU
+				time.Sleep(controller.Requeue1sDelay)
+			} else {
+				device, retCode := r.gpu().DeviceGetHandleByUUID(allocResult.GPUUUID)
+				if retCode != nvml.SUCCESS {
+					log.Error(retCode, "error getting GPU device handle", "gpuUUID", allocResult.GPUUUID)
+					return ctrl.Result{}, goerror.New("error fetching GPU device handle")
+				}
 
-					selectedMig, ok := instaslice.Status.NodeResources.MigPlacement[allocationRequest.Profile]
-					if !ok {
-						log.Info("No suitable MIG profile in NodeResources; skipping creation", podRef, allocResult)
-						continue
-					}
+				selectedMig, ok := instaslice.Status.NodeResources.MigPlacement[allocationRequest.Profile]
+				if !ok {
+					log.Info("No suitable MIG profile in NodeResources; skipping creation", podRef, allocResult)
+					continue
+				}
 
-					placement := nvml.GpuInstancePlacement{
-						Start: uint32(allocResult.MigPlacement.Start),
-						Size:  uint32(allocResult.MigPlacement.Size),
-					}
+				placement := nvml.GpuInstancePlacement{
+					Start: uint32(allocResult.MigPlacement.Start),
+					Size:  uint32(allocResult.MigPlacement.Size),
+				}
 
-					giProfileInfo, retGI := device.GetGpuInstanceProfileInfo(int(selectedMig.GIProfileID))
-					if retGI != nvml.SUCCESS {
-						log.Error(retGI, "error getting GPU instance profile info", "GIProfileID", selectedMig.GIProfileID)
-						return ctrl.Result{}, goerror.New("cannot get GI profile info")
-					}
+				giProfileInfo, retGI := device.GetGpuInstanceProfileInfo(int(selectedMig.GIProfileID))
+				if retGI != nvml.SUCCESS {
+					log.Error(retGI, "error getting GPU instance profile info", "GIProfileID", selectedMig.GIProfileID)
+					return ctrl.Result{}, goerror.New("cannot get GI profile info")
+				}
 
+				// the slice is already there when a previous attempt failed to update the status
+				migInfos, err := populateMigDeviceInfos(device)
+				if err != nil {
+					log.Error(err, "unable to walk MIG devices", "gpuUUID", allocResult.GPUUUID)
+					return ctrl.Result{RequeueAfter: controller.Requeue2sDelay}, err
+				}
+				migUuid, found := migUUIDAtPlacement(migInfos, &allocResult, giProfileInfo.Id)
+				if !found {
 					ciProfileID := selectedMig.CIProfileID
 
 					createdMigInfos, err := r.createSliceAndPopulateMigInfos(
@@ -293,23 +328,20 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 						log.Error(err, "MIG creation not successful", "podRef", podRef)
 						return ctrl.Result{RequeueAfter: controller.Requeue2sDelay}, err
 					}
-
-					for migUuid, migDevice := range createdMigInfos {
-						if migDevice.start == allocResult.MigPlacement.Start && migDevice.uuid == allocResult.GPUUUID && giProfileInfo.Id == migDevice.giInfo.ProfileId {
-							if err := r.createConfigMap(ctx, migUuid, podRef.Namespace, string(allocResult.ConfigMapResourceIdentifier)); err != nil {
-								return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, err
-							}
-							log.Info("done creating mig slice for ", "pod", podRef.Name, "parentgpu", allocResult.GPUUUID, "miguuid", migUuid)
-							break
-						}
+					migUuid, found = migUUIDAtPlacement(createdMigInfos, &allocResult, giProfileInfo.Id)
+				}
+				if found {
+					if err := r.addMigDeviceToConfigMap(ctx, migUuid, podRef.Namespace, string(allocResult.ConfigMapResourceIdentifier)); err != nil {
+						return ctrl.Result{RequeueAfter: controller.Requeue1sDelay}, err
 					}
+					log.Info("done creating mig slice for ", "pod", podRef.Name, "parentgpu", allocResult.GPUUUID, "miguuid", migUuid)
 				}
 			}
 
 			newAllocationRequest := instaslice.Spec.PodAllocationRequests[podUID]
 			newAllocationResult := instaslice.Status.PodAllocationResults[podUID]
 			newAllocationResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
-			if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &newAllocationResult, &newAllocationRequest); err != nil {
+			if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, podUID, &newAllocationResult, &newAllocationRequest); err != nil {
 				return ctrl.Result{Requeue: true}, err
 			}
 
@@ -321,6 +353,28 @@ func (r *InstaSliceDaemonsetReconciler) Reconcile(ctx context.Context, req ctrl.
 }
 
 func (r *InstaSliceDaemonsetReconciler) createCiAndGiProfiles(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, podUID types.UID) error {
+	log := logr.FromContext(ctx)
+	podRef := instaslice.Spec.PodAllocationRequests[podUID].PodRef
+	allocResult := instaslice.Status.PodAllocationResults[podUID]
+	migUuid, found, err := r.createSlice(ctx, instaslice, podUID)
+	if err != nil || !found {
+		return err
+	}
+	// the configmap of a rebooted node still holds the MIG devices of the lost slices
+	live, err := r.liveMigDevices(instaslice)
+	if err != nil {
+		return err
+	}
+	if err := r.replaceLostMigDevices(ctx, podRef.Namespace, string(allocResult.ConfigMapResourceIdentifier), live, migUuid); err != nil {
+		return err
+	}
+	log.Info("done creating mig slice for ", "pod", podRef.Name, "parentgpu", allocResult.GPUUUID, "miguuid", migUuid)
+	return nil
+}
+
+// createSlice creates the slice of the allocation, or reuses the one already at its placement,
+// and returns the UUID of its MIG device
+func (r *InstaSliceDaemonsetReconciler) createSlice(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, podUID types.UID) (string, bool, error) {
 	log := logr.FromContext(ctx)
 	podRef := instaslice.Spec.PodAllocationRequests[podUID].PodRef
 	allocResult := instaslice.Status.PodAllocationResults[podUID]
@@ -330,17 +384,17 @@ func (r *InstaSliceDaemonsetReconciler) createCiAndGiProfiles(ctx context.Contex
 	if !haveReq {
 		// There's no allocation request
 		log.Info("No matching PodAllocationRequest for this result; skipping")
-		return nil
+		return "", false, nil
 	}
-	device, retCode := nvml.DeviceGetHandleByUUID(allocResult.GPUUUID)
+	device, retCode := r.gpu().DeviceGetHandleByUUID(allocResult.GPUUUID)
 	if retCode != nvml.SUCCESS {
 		log.Error(retCode, "error getting GPU device handle", "gpuUUID", allocResult.GPUUUID)
-		return goerror.New("error fetching GPU device handle, GPUUUID: " + allocResult.GPUUUID)
+		return "", false, goerror.New("error fetching GPU device handle, GPUUUID: " + allocResult.GPUUUID)
 	}
 	selectedMig, ok := instaslice.Status.NodeResources.MigPlacement[allocationRequest.Profile]
 	if !ok {
 		log.Info("No suitable MIG profile in NodeResources; skipping creation")
-		return goerror.New("Requested MIG profile not found on the node, node:  " + instaslice.Name + " profile: " + allocationRequest.Profile)
+		return "", false, goerror.New("Requested MIG profile not found on the node, node:  " + instaslice.Name + " profile: " + allocationRequest.Profile)
 	}
 
 	placement := nvml.GpuInstancePlacement{
@@ -351,7 +405,7 @@ func (r *InstaSliceDaemonsetReconciler) createCiAndGiProfiles(ctx context.Contex
 	giProfileInfo, retGI := device.GetGpuInstanceProfileInfo(int(selectedMig.GIProfileID))
 	if retGI != nvml.SUCCESS {
 		log.Error(retGI, "error getting GPU instance profile info", "GIProfileID", selectedMig.GIProfileID)
-		return goerror.New("cannot get GI profile info, GIProfileID: " + strconv.Itoa(int(selectedMig.GIProfileID)))
+		return "", false, goerror.New("cannot get GI profile info, GIProfileID: " + strconv.Itoa(int(selectedMig.GIProfileID)))
 	}
 
 	ciProfileID := selectedMig.CIProfileID
@@ -360,30 +414,61 @@ func (r *InstaSliceDaemonsetReconciler) createCiAndGiProfiles(ctx context.Contex
 		ctx, device, giProfileInfo, placement, ciProfileID, podRef.Name)
 	if err != nil {
 		log.Error(err, "MIG creation not successful")
-		return err
+		return "", false, err
 	}
 
-	for migUuid, migDevice := range createdMigInfos {
-		if migDevice.start == allocResult.MigPlacement.Start && migDevice.uuid == allocResult.GPUUUID && giProfileInfo.Id == migDevice.giInfo.ProfileId {
-			exists, _ := r.checkConfigMapExists(ctx, string(allocResult.ConfigMapResourceIdentifier), podRef.Namespace)
-			if exists {
-				log.Info("Skipping updating pod", "podRef", podRef)
-				continue
-			} else if err := r.createConfigMap(ctx, migUuid, podRef.Namespace, string(allocResult.ConfigMapResourceIdentifier)); err != nil {
-				return err
-			}
-			log.Info("done creating mig slice for ", "pod", podRef.Name, "parentgpu", allocResult.GPUUUID, "miguuid", migUuid)
-			break
+	migUuid, found := migUUIDAtPlacement(createdMigInfos, &allocResult, giProfileInfo.Id)
+	return migUuid, found, nil
+}
+
+// migUUIDAtPlacement returns the UUID of the MIG device of the GPU instance profile created at
+// the placement of the allocation.
+func migUUIDAtPlacement(migInfos map[string]*MigDeviceInfo, allocResult *inferencev1alpha1.AllocationResult, giProfileID uint32) (string, bool) {
+	for migUuid, migDevice := range migInfos {
+		if migDevice.start == allocResult.MigPlacement.Start && migDevice.uuid == allocResult.GPUUUID && giProfileID == migDevice.giInfo.ProfileId {
+			return migUuid, true
 		}
 	}
-	return nil
+	return "", false
+}
+
+// configMapInUse reports whether an allocation other than the given one still uses the configmap,
+// which is the case for the slices of a container requesting more than one.
+func configMapInUse(instaslice *inferencev1alpha1.Instaslice, key types.UID, configMapName types.UID) bool {
+	for otherKey, allocResult := range instaslice.Status.PodAllocationResults {
+		if otherKey == key || allocResult.ConfigMapResourceIdentifier != configMapName {
+			continue
+		}
+		if allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
+			return true
+		}
+	}
+	return false
+}
+
+// sliceHandedOver reports whether the slice of the deleting allocation was recycled by the
+// controller for another allocation, still active at the same placement
+func sliceHandedOver(instaslice *inferencev1alpha1.Instaslice, key types.UID, freed inferencev1alpha1.AllocationResult) bool {
+	if !meta.IsStatusConditionTrue(freed.Conditions, controller.RecycledCondition) {
+		return false
+	}
+	for otherKey, allocResult := range instaslice.Status.PodAllocationResults {
+		if otherKey == key || allocResult.GPUUUID != freed.GPUUUID || allocResult.MigPlacement != freed.MigPlacement {
+			continue
+		}
+		if allocResult.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusDeleting &&
+			allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
+			return true
+		}
+	}
+	return false
 }
 
 // cleanUpCiAndGi tears down the MIG compute instance and GPU instance.
 func (r *InstaSliceDaemonsetReconciler) cleanUpCiAndGi(ctx context.Context, allocationResult *inferencev1alpha1.AllocationResult, podRef v1.ObjectReference) error {
 	log := logr.FromContext(ctx)
 
-	parent, ret := nvml.DeviceGetHandleByUUID(allocationResult.GPUUUID)
+	parent, ret := r.gpu().DeviceGetHandleByUUID(allocationResult.GPUUUID)
 	if ret != nvml.SUCCESS {
 		log.Error(ret, "error obtaining GPU handle for cleanup")
 		return fmt.Errorf("unable to get device handle: %v", ret)
@@ -494,6 +579,7 @@ func (r *InstaSliceDaemonsetReconciler) SetupWithManager(mgr ctrl.Manager) error
 			instaslice.Name = fakeCapacity.Name
 			instaslice.Namespace = fakeCapacity.Namespace
 			instaslice.Status = fakeCapacity.Status
+			setNodeConditions(&instaslice.Status, node.Status.NodeInfo.BootID, r.driverCondition(), discoveredCondition(&instaslice, nil))
 			err = r.Status().Update(ctx, &instaslice)
 			if err != nil {
 				log.Error(err, "could not update fake capacity", "node_name", r.NodeName)
@@ -519,11 +605,17 @@ func (r *InstaSliceDaemonsetReconciler) SetupWithManager(mgr ctrl.Manager) error
 				log.Error(err, "Timed out waiting for instaslice status", "node_name", r.NodeName)
 			}
 		} else {
-			if instaslice.Status.NodeResources.NodeGPUs == nil { // TODO - use those conditions!
+			// discovery failed or ran before the conditions were maintained
+			r.slicesMu.Lock()
+			if !meta.IsStatusConditionTrue(instaslice.Status.Conditions, controller.NodeDiscoveredCondition) {
 				if e := r.discoverMigEnabledGpuWithSlices(); e != nil {
 					log.Error(e, "Error discovering MIG GPUs on node init")
 				}
+			} else if e := r.adoptExistingSlices(ctx); e != nil {
+				// the slices created while the daemonset was down
+				log.Error(e, "Error adopting the existing slices on node init")
 			}
+			r.slicesMu.Unlock()
 		}
 		if err := r.Get(ctx, typeNamespacedName, &instaslice); err != nil {
 			log.Error(err, "Unable to fetch Instaslice after discovery", "nodeName", r.NodeName)
@@ -552,6 +644,31 @@ func (r *InstaSliceDaemonsetReconciler) SetupWithManager(mgr ctrl.Manager) error
 		return mgrAddErr
 	}
 
+	// the slices of emulated GPUs can't drift and emulated GPUs raise no XID
+	if !r.Config.EmulatorModeEnable {
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			wait.UntilWithContext(ctx, r.checkDrift, r.driftCheckInterval())
+			return nil
+		})); err != nil {
+			return err
+		}
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			wait.UntilWithContext(ctx, r.watchXIDs, xidWaitTimeout)
+			return nil
+		})); err != nil {
+			return err
+		}
+		// MIG mode is enabled on the selected GPUs
+		if r.Config.EnableMigGPUs != "" {
+			if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+				wait.UntilWithContext(ctx, r.manageMigMode, migModeCheckInterval)
+				return nil
+			})); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -626,13 +743,23 @@ func (r *InstaSliceDaemonsetReconciler) discoverMigEnabledGpuWithSlices() error
 
 	customCtx := context.TODO()
 	errToCreate := r.Create(customCtx, instaslice)
+	if errors.IsAlreadyExists(errToCreate) {
+		// the discovery is run again
+		errToCreate = r.Get(customCtx, client.ObjectKeyFromObject(instaslice), instaslice)
+	}
 	if errToCreate != nil {
 		return errToCreate
 	}
-	instaslice, _, _, err := r.discoverAvailableProfilesOnGpus(instaslice)
+	driver := r.driverCondition()
+	discovered, _, _, err := r.discoverAvailableProfilesOnGpus(instaslice)
 	if err != nil {
+		if condErr := r.updateNodeConditions(customCtx, instaslice, "", driver, discoveredCondition(nil, err)); condErr != nil {
+			log.Error(condErr, "unable to report the failed discovery")
+		}
 		return err
 	}
+	instaslice = discovered
+	setNodeConditions(&instaslice.Status, "", driver, discoveredCondition(instaslice, nil))
 	totalMemoryGB, err := CalculateTotalMemoryGB(instaslice.Status.NodeResources.NodeGPUs)
 	if err != nil {
 		log.Error(err, "unable to get GPU memory")
@@ -648,6 +775,10 @@ func (r *InstaSliceDaemonsetReconciler) discoverMigEnabledGpuWithSlices() error
 		return err
 	}
 
+	// the slots of the slices already on the GPUs aren't free
+	if err := r.adoptExistingSlices(customCtx); err != nil {
+		log.Error(err, "unable to adopt the existing slices", "nodeName", r.NodeName)
+	}
 	return nil
 }
 
@@ -724,18 +855,19 @@ func (r *InstaSliceDaemonsetReconciler) patchNodeStatusForNode(ctx context.Conte
 // during init time we need to discover GPU that are MIG enabled and slices if any on them to start making allocations of the next pods.
 func (r *InstaSliceDaemonsetReconciler) discoverAvailableProfilesOnGpus(instaslice *inferencev1alpha1.Instaslice) (*inferencev1alpha1.Instaslice, nvml.Return, bool, error) {
 	log := logr.FromContext(context.TODO())
-	count, ret := nvml.DeviceGetCount()
+	count, ret := r.gpu().DeviceGetCount()
 	if ret != nvml.SUCCESS {
 		return nil, ret, false, ret
 	}
 	gpuModelMap := make(map[string]string)
 
-	nodeGPUs := make([]inferencev1alpha1.DiscoveredGPU, count)
+	// only the MIG enabled GPUs are discovered
+	nodeGPUs := make([]inferencev1alpha1.DiscoveredGPU, 0, count)
 
 	discoverProfilePerNode := true
 	var memory nvml.Memory
 	for i := 0; i < count; i++ {
-		device, ret := nvml.DeviceGetHandleByIndex(i)
+		device, ret := r.gpu().DeviceGetHandleByIndex(i)
 		if ret != nvml.SUCCESS {
 			return nil, ret, false, ret
 		}
@@ -759,9 +891,12 @@ func (r *InstaSliceDaemonsetReconciler) discoverAvailableProfilesOnGpus(instasli
 		}
 		gpuName, _ := device.GetName()
 		gpuModelMap[uuid] = gpuName
-		nodeGPUs[i].GPUUUID = uuid
-		nodeGPUs[i].GPUName = gpuName
-		nodeGPUs[i].GPUMemory = *resource.NewQuantity(int64(memory.Total), resource.BinarySI)
+		nodeGPUs = append(nodeGPUs, inferencev1alpha1.DiscoveredGPU{
+			GPUUUID:    uuid,
+			GPUName:    gpuName,
+			GPUMemory:  *resource.NewQuantity(int64(memory.Total), resource.BinarySI),
+			Conditions: gpuConditions(instaslice, uuid),
+		})
 		discoveredGpusOnHost = append(discoveredGpusOnHost, uuid)
 		if discoverProfilePerNode {
 
@@ -816,8 +951,8 @@ func (r *InstaSliceDaemonsetReconciler) discoverAvailableProfilesOnGpus(instasli
 			}
 			discoverProfilePerNode = false
 		}
-		instaslice.Status.NodeResources.NodeGPUs = nodeGPUs
 	}
+	instaslice.Status.NodeResources.NodeGPUs = nodeGPUs
 	return instaslice, ret, false, nil
 }
 
@@ -866,12 +1001,16 @@ func (m MigProfile) Attributes() []string {
 	return attr
 }
 
-// Create configmap which is used by Pods to consume MIG device
-func (r *InstaSliceDaemonsetReconciler) createConfigMap(ctx context.Context, migGPUUUID string, namespace string, resourceIdentifier string) error {
+// addMigDeviceToConfigMap adds the MIG device to the configmap used by the container to consume
+// its MIG devices, the configmap is created with the first device.
+func (r *InstaSliceDaemonsetReconciler) addMigDeviceToConfigMap(ctx context.Context, migGPUUUID string, namespace string, resourceIdentifier string) error {
 	log := logr.FromContext(ctx)
 	var configMap v1.ConfigMap
 	err := r.Get(ctx, types.NamespacedName{Name: resourceIdentifier, Namespace: namespace}, &configMap)
 	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
 		log.Info("ConfigMap not found, creating for ", "name", resourceIdentifier, "migGPUUUID", migGPUUUID)
 		configMapToCreate := &v1.ConfigMap{
 			ObjectMeta: metav1.ObjectMeta{
@@ -887,11 +1026,39 @@ func (r *InstaSliceDaemonsetReconciler) createConfigMap(ctx context.Context, mig
 			log.Error(err, "failed to create ConfigMap")
 			return err
 		}
-
+		return nil
 	}
+	devices := configMapMigDevices(&configMap)
+	for _, device := range devices {
+		if device == migGPUUUID {
+			return nil
+		}
+	}
+	devices = append(devices, migGPUUUID)
+	if configMap.Data == nil {
+		configMap.Data = make(map[string]string)
+	}
+	configMap.Data["NVIDIA_VISIBLE_DEVICES"] = strings.Join(devices, ",")
+	configMap.Data["CUDA_VISIBLE_DEVICES"] = strings.Join(devices, ",")
+	if err := r.Update(ctx, &configMap); err != nil {
+		log.Error(err, "failed to add MIG device to ConfigMap", "name", resourceIdentifier, "migGPUUUID", migGPUUUID)
+		return err
+	}
+	log.Info("MIG device added to ConfigMap", "name", resourceIdentifier, "migGPUUUID", migGPUUUID)
 	return nil
 }
 
+// configMapMigDevices returns the MIG devices listed in the configmap
+func configMapMigDevices(configMap *v1.ConfigMap) []string {
+	var devices []string
+	for _, device := range strings.Split(configMap.Data["NVIDIA_VISIBLE_DEVICES"], ",") {
+		if device = strings.TrimSpace(device); device != "" {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
 // Manage lifecycle of configmap, delete it once the pod is deleted from the system
 func (r *InstaSliceDaemonsetReconciler) deleteConfigMap(ctx context.Context, configMapName string, namespace string) error {
 	log := logr.FromContext(ctx)
@@ -1052,14 +1219,19 @@ func (r *InstaSliceDaemonsetReconciler) createSliceAndPopulateMigInfos(ctx conte
 						log.Error(ret, "unable to obtain gi post iteration")
 						return nil, fmt.Errorf("unable to obtain gi post iteration, got value: %v", gi)
 					}
+					break
 				}
 			}
+			// the gpu instance of a previous attempt is reused, any other one holds the placement
+			if gi == nil {
+				return nil, fmt.Errorf("error creating gpu instance profile with: %v", nvml.ERROR_INSUFFICIENT_RESOURCES)
+			}
+			log.Info("reusing the gpu instance at the placement", "start", placement.Start, "pod", podName)
 		default:
 			// this case is typically for scenario where ret is not equal to nvml.ERROR_INSUFFICIENT_RESOURCES
 			log.Error(ret, "gpu instance creation errored out with unknown error")
 			return nil, fmt.Errorf("gpu instance creation failed: %v", ret)
 		}
-		return nil, fmt.Errorf("error creating gpu instance profile with: %v", ret)
 	}
 
 	ciProfileInfo, ret := gi.GetComputeInstanceProfileInfo(int(ciProfileId), 0)
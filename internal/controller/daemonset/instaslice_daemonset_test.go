@@ -83,7 +83,7 @@ func TestInstaSliceDaemonsetReconciler_Reconcile_Deleting_Alloc_Status(t *testin
 	_ = appsv1.AddToScheme(s)
 
 	// Use the fake client
-	client := fake.NewClientBuilder().WithScheme(s).Build()
+	client := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&inferencev1alpha1.Instaslice{}).Build()
 	const (
 		nodeName = "test-node"
 		podUUID  = "test-pod-uuid"
@@ -147,7 +147,7 @@ func TestInstaSliceDaemonsetReconciler_Reconcile_Creating_Alloc_Status(t *testin
 		podUUID  = "test-pod-uuid"
 	)
 	// Use the fake client
-	client := fake.NewClientBuilder().WithScheme(s).Build()
+	client := fake.NewClientBuilder().WithScheme(s).WithStatusSubresource(&inferencev1alpha1.Instaslice{}).Build()
 
 	// Set NODE_NAME and EMULATOR_MODE env variables
 	assert.NoError(t, os.Setenv("NODE_NAME", nodeName))
@@ -406,6 +406,81 @@ func TestInstaSliceDaemonsetReconciler_checkConfigMapExists(t *testing.T) {
 	assert.True(t, !exists)
 }
 
+func TestAddMigDeviceToConfigMap(t *testing.T) {
+	s := scheme.Scheme
+	_ = v1.AddToScheme(s)
+	reconciler := &InstaSliceDaemonsetReconciler{Client: fake.NewClientBuilder().WithScheme(s).Build()}
+	ctx := context.Background()
+
+	assert.NoError(t, reconciler.addMigDeviceToConfigMap(ctx, "MIG-a", "default", "cm"))
+	assert.NoError(t, reconciler.addMigDeviceToConfigMap(ctx, "MIG-b", "default", "cm"))
+	// adding a device twice is a no-op
+	assert.NoError(t, reconciler.addMigDeviceToConfigMap(ctx, "MIG-a", "default", "cm"))
+
+	configMap := &v1.ConfigMap{}
+	assert.NoError(t, reconciler.Get(ctx, types.NamespacedName{Name: "cm", Namespace: "default"}, configMap))
+	assert.Equal(t, "MIG-a,MIG-b", configMap.Data["NVIDIA_VISIBLE_DEVICES"])
+	assert.Equal(t, "MIG-a,MIG-b", configMap.Data["CUDA_VISIBLE_DEVICES"])
+	assert.Equal(t, []string{"MIG-a", "MIG-b"}, configMapMigDevices(configMap))
+}
+
+func TestConfigMapInUse(t *testing.T) {
+	instaslice := &inferencev1alpha1.Instaslice{
+		Status: inferencev1alpha1.InstasliceStatus{
+			PodAllocationResults: map[types.UID]inferencev1alpha1.AllocationResult{
+				"pod-uid":         {ConfigMapResourceIdentifier: "cm"},
+				"pod-uid-model-1": {ConfigMapResourceIdentifier: "cm"},
+				"other-uid":       {ConfigMapResourceIdentifier: "other-cm"},
+			},
+		},
+	}
+	assert.True(t, configMapInUse(instaslice, "pod-uid", "cm"))
+	assert.False(t, configMapInUse(instaslice, "other-uid", "other-cm"))
+
+	instaslice.Status.PodAllocationResults["pod-uid-model-1"] = inferencev1alpha1.AllocationResult{
+		ConfigMapResourceIdentifier: "cm",
+		AllocationStatus:            inferencev1alpha1.AllocationStatus{AllocationStatusDaemonset: inferencev1alpha1.AllocationStatusDeleted},
+	}
+	assert.False(t, configMapInUse(instaslice, "pod-uid", "cm"), "the other slice is already deleted")
+}
+
+func TestSliceHandedOver(t *testing.T) {
+	placement := inferencev1alpha1.Placement{Start: 2, Size: 1}
+	freed := inferencev1alpha1.AllocationResult{
+		GPUUUID:      "gpu-a",
+		MigPlacement: placement,
+		AllocationStatus: inferencev1alpha1.AllocationStatus{
+			AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+			AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+		},
+		Conditions: []metav1.Condition{{Type: controller.RecycledCondition, Status: metav1.ConditionTrue, Reason: "SliceHandedOver"}},
+	}
+	instaslice := &inferencev1alpha1.Instaslice{
+		Status: inferencev1alpha1.InstasliceStatus{
+			PodAllocationResults: map[types.UID]inferencev1alpha1.AllocationResult{
+				"completed-uid": freed,
+				"waiting-uid": {
+					GPUUUID:          "gpu-a",
+					MigPlacement:     placement,
+					AllocationStatus: inferencev1alpha1.AllocationStatus{AllocationStatusController: inferencev1alpha1.AllocationStatusCreating},
+				},
+			},
+		},
+	}
+	assert.True(t, sliceHandedOver(instaslice, "completed-uid", freed))
+
+	notRecycled := *freed.DeepCopy()
+	notRecycled.Conditions = nil
+	assert.False(t, sliceHandedOver(instaslice, "completed-uid", notRecycled), "the slice wasn't recycled")
+
+	instaslice.Status.PodAllocationResults["waiting-uid"] = inferencev1alpha1.AllocationResult{
+		GPUUUID:          "gpu-a",
+		MigPlacement:     placement,
+		AllocationStatus: inferencev1alpha1.AllocationStatus{AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting},
+	}
+	assert.False(t, sliceHandedOver(instaslice, "completed-uid", freed), "the allocation it was handed over to is withdrawn")
+}
+
 func TestCalculateTotalMemoryGB(t *testing.T) {
 	type args struct {
 		isEmulated bool
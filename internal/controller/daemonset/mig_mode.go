@@ -0,0 +1,197 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Only the GPUs with MIG mode enabled are discovered. The daemonset can enable MIG mode on the
+// GPUs selected by the configuration instead of requiring a manual nvidia-smi step: a GPU is
+// switched once no compute process runs on it. The new mode is activated right away or, on
+// the platforms where the GPU can't be reset by the driver, stays pending until the GPU is
+// reset or the node rebooted. The MigModeEnabled condition of the Instaslice reports the GPUs
+// waiting to be idle or reset, and the GPUs are discovered again once MIG mode is active.
+
+const (
+	reasonMigModeEnabled = "MigModeEnabled"
+	reasonGPUBusy        = "GPUBusy"
+	reasonResetRequired  = "ResetRequired"
+	reasonMigModeError   = "MigModeError"
+	// migModeCheckInterval is how often the MIG mode of the selected GPUs is checked
+	migModeCheckInterval = 30 * time.Second
+)
+
+// migModeSelected reports whether the daemonset enables MIG mode on the GPU
+func (r *InstaSliceDaemonsetReconciler) migModeSelected(gpuUUID string) bool {
+	if r.Config == nil || r.Config.EnableMigGPUs == "" {
+		return false
+	}
+	for _, selected := range strings.Split(r.Config.EnableMigGPUs, ",") {
+		selected = strings.TrimSpace(selected)
+		if selected == controller.MigModeAllGPUs || selected == gpuUUID {
+			return true
+		}
+	}
+	return false
+}
+
+// manageMigMode enables MIG mode on the selected GPUs of a managed node and discovers the GPUs
+// again when it is active on one of them that isn't discovered yet, e.g. after its reset
+func (r *InstaSliceDaemonsetReconciler) manageMigMode(ctx context.Context) {
+	log := logr.FromContext(ctx)
+	// the driver error is reported by the DriverHealthy condition
+	if err := r.gpu().Init(); err != nil {
+		return
+	}
+	r.slicesMu.Lock()
+	defer r.slicesMu.Unlock()
+
+	nsName := types.NamespacedName{Name: r.NodeName, Namespace: controller.InstaSliceOperatorNamespace}
+	var instaslice inferencev1alpha1.Instaslice
+	// the GPUs of a node that isn't managed are left alone
+	if err := r.Get(ctx, nsName, &instaslice); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get the Instaslice of the node to manage the MIG mode", "nodeName", r.NodeName)
+		}
+		return
+	}
+	rediscover, condition := r.enableMigMode(ctx, &instaslice)
+	// the GPUs are discovered by Reconcile until the discovery succeeded
+	if rediscover && meta.IsStatusConditionTrue(instaslice.Status.Conditions, controller.NodeDiscoveredCondition) {
+		log.Info("discovering the GPUs again after enabling MIG mode", "nodeName", r.NodeName)
+		if err := r.discoverMigEnabledGpuWithSlices(); err != nil {
+			log.Error(err, "unable to discover the GPUs after enabling MIG mode", "nodeName", r.NodeName)
+		}
+		if err := r.Get(ctx, nsName, &instaslice); err != nil {
+			log.Error(err, "unable to get the Instaslice of the node after the discovery", "nodeName", r.NodeName)
+			return
+		}
+		if err := r.addMigCapacityToNode(ctx, &instaslice); err != nil {
+			log.Error(err, "error adding mig capacity to node")
+		}
+	}
+	if err := r.updateNodeConditions(ctx, &instaslice, "", condition); err != nil {
+		log.Error(err, "unable to report the MIG mode of the GPUs", "nodeName", r.NodeName)
+	}
+}
+
+// enableMigMode enables MIG mode on the selected GPUs that are idle. It returns whether MIG
+// mode is active on a selected GPU the Instaslice doesn't hold yet and the MigModeEnabled
+// condition for the selected GPUs.
+func (r *InstaSliceDaemonsetReconciler) enableMigMode(ctx context.Context, instaslice *inferencev1alpha1.Instaslice) (bool, metav1.Condition) {
+	log := logr.FromContext(ctx)
+	failed := func(err error) metav1.Condition {
+		return metav1.Condition{
+			Type:    controller.NodeMigModeEnabledCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  reasonMigModeError,
+			Message: err.Error(),
+		}
+	}
+	count, ret := r.gpu().DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return false, failed(fmt.Errorf("unable to get the GPU count: %v", ret))
+	}
+	discovered := make(map[string]bool, len(instaslice.Status.NodeResources.NodeGPUs))
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		discovered[gpu.GPUUUID] = true
+	}
+	rediscover := false
+	var busy, pending []string
+	for i := 0; i < count; i++ {
+		device, ret := r.gpu().DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return rediscover, failed(fmt.Errorf("unable to get device handle of GPU %d: %v", i, ret))
+		}
+		uuid, ret := device.GetUUID()
+		if ret != nvml.SUCCESS {
+			return rediscover, failed(fmt.Errorf("unable to get the UUID of GPU %d: %v", i, ret))
+		}
+		if !r.migModeSelected(uuid) {
+			continue
+		}
+		current, pendingMode, ret := device.GetMigMode()
+		if ret == nvml.ERROR_NOT_SUPPORTED {
+			log.Info("the GPU doesn't support MIG", "gpuUUID", uuid)
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return rediscover, failed(fmt.Errorf("unable to get the MIG mode of GPU %s: %v", uuid, ret))
+		}
+		if current == nvml.DEVICE_MIG_ENABLE {
+			rediscover = rediscover || !discovered[uuid]
+			continue
+		}
+		if pendingMode == nvml.DEVICE_MIG_ENABLE {
+			pending = append(pending, uuid)
+			continue
+		}
+		processes, ret := device.GetComputeRunningProcesses()
+		if ret != nvml.SUCCESS {
+			return rediscover, failed(fmt.Errorf("unable to list the processes of GPU %s: %v", uuid, ret))
+		}
+		if len(processes) > 0 {
+			log.Info("waiting for the GPU to be idle to enable MIG mode", "gpuUUID", uuid, "processes", len(processes))
+			busy = append(busy, uuid)
+			continue
+		}
+		activationStatus, ret := device.SetMigMode(nvml.DEVICE_MIG_ENABLE)
+		if ret == nvml.ERROR_IN_USE {
+			// a process started since the GPU was found idle
+			busy = append(busy, uuid)
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return rediscover, failed(fmt.Errorf("unable to enable MIG mode on GPU %s: %v", uuid, ret))
+		}
+		if activationStatus != nvml.SUCCESS {
+			log.Info("MIG mode is pending until the GPU is reset", "gpuUUID", uuid, "activationStatus", activationStatus.Error())
+			pending = append(pending, uuid)
+			continue
+		}
+		log.Info("enabled MIG mode", "gpuUUID", uuid)
+		rediscover = true
+	}
+	condition := metav1.Condition{
+		Type:    controller.NodeMigModeEnabledCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonMigModeEnabled,
+		Message: "MIG mode is enabled on the selected GPUs.",
+	}
+	switch {
+	case len(pending) > 0:
+		condition.Status, condition.Reason = metav1.ConditionFalse, reasonResetRequired
+		condition.Message = fmt.Sprintf("MIG mode is enabled on GPUs %s once they are reset.", strings.Join(pending, ", "))
+	case len(busy) > 0:
+		condition.Status, condition.Reason = metav1.ConditionFalse, reasonGPUBusy
+		condition.Message = fmt.Sprintf("MIG mode is enabled on GPUs %s once they are idle.", strings.Join(busy, ", "))
+	}
+	return rediscover, condition
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/instaslice-operator/internal/controller"
+)
+
+// migMode returns the current and pending MIG mode of the fake GPU
+func migMode(t *testing.T, backend *fakeGPUBackend, uuid string) (int, int) {
+	current, pending, ret := backend.gpu(uuid).GetMigMode()
+	assert.Equal(t, nvml.SUCCESS, ret)
+	return current, pending
+}
+
+func TestEnableMigMode(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b", "GPU-c", "GPU-d")
+	backend.disableMig("GPU-b", false)
+	backend.disableMig("GPU-c", false)
+	backend.disableMig("GPU-d", false)
+	backend.gpu("GPU-c").processes = []nvml.ProcessInfo{{Pid: 4242}}
+	r := newFakeGPUReconciler(backend)
+	r.Config.EnableMigGPUs = "GPU-b, GPU-c"
+	instaslice := discoveredInstaslice(t, r)
+	ctx := context.Background()
+
+	rediscover, condition := r.enableMigMode(ctx, instaslice)
+	assert.True(t, rediscover, "MIG mode is enabled on GPU-b")
+	assert.Equal(t, metav1.ConditionFalse, condition.Status)
+	assert.Equal(t, reasonGPUBusy, condition.Reason)
+	assert.Equal(t, "MIG mode is enabled on GPUs GPU-c once they are idle.", condition.Message)
+	current, _ := migMode(t, backend, "GPU-b")
+	assert.Equal(t, nvml.DEVICE_MIG_ENABLE, current)
+	current, _ = migMode(t, backend, "GPU-c")
+	assert.Equal(t, nvml.DEVICE_MIG_DISABLE, current, "a process runs on GPU-c")
+	current, _ = migMode(t, backend, "GPU-d")
+	assert.Equal(t, nvml.DEVICE_MIG_DISABLE, current, "GPU-d isn't selected")
+
+	backend.gpu("GPU-c").processes = nil
+	instaslice = discoveredInstaslice(t, r)
+	rediscover, condition = r.enableMigMode(ctx, instaslice)
+	assert.True(t, rediscover)
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+	assert.Len(t, discoveredInstaslice(t, r).Status.NodeResources.NodeGPUs, 3)
+
+	// the selected GPUs are discovered
+	rediscover, condition = r.enableMigMode(ctx, discoveredInstaslice(t, r))
+	assert.False(t, rediscover)
+	assert.Equal(t, reasonMigModeEnabled, condition.Reason)
+
+	backend.fail("SetMigMode", nvml.ERROR_NO_PERMISSION)
+	r.Config.EnableMigGPUs = controller.MigModeAllGPUs
+	_, condition = r.enableMigMode(ctx, instaslice)
+	assert.Equal(t, reasonMigModeError, condition.Reason)
+	assert.Contains(t, condition.Message, "GPU-d")
+}
+
+func TestEnableMigModeRequiringReset(t *testing.T) {
+	backend := newFakeGPUBackend("GPU-a", "GPU-b")
+	backend.disableMig("GPU-b", true)
+	r := newFakeGPUReconciler(backend, readyInstaslice(t, backend))
+	r.Config.EnableMigGPUs = controller.MigModeAllGPUs
+	ctx := context.Background()
+
+	// the GPUs waiting for a reset are reported on the Instaslice
+	r.manageMigMode(ctx)
+	reported := meta.FindStatusCondition(getInstaslice(t, r).Status.Conditions, controller.NodeMigModeEnabledCondition)
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, metav1.ConditionFalse, reported.Status)
+		assert.Equal(t, reasonResetRequired, reported.Reason)
+		assert.Contains(t, reported.Message, "GPU-b")
+	}
+	current, pending := migMode(t, backend, "GPU-b")
+	assert.Equal(t, nvml.DEVICE_MIG_DISABLE, current)
+	assert.Equal(t, nvml.DEVICE_MIG_ENABLE, pending)
+
+	// the pending mode isn't set again
+	backend.fail("SetMigMode", nvml.ERROR_UNKNOWN)
+	rediscover, condition := r.enableMigMode(ctx, getInstaslice(t, r))
+	assert.False(t, rediscover)
+	assert.Equal(t, reasonResetRequired, condition.Reason)
+
+	backend.reset("GPU-b")
+	rediscover, condition = r.enableMigMode(ctx, getInstaslice(t, r))
+	assert.True(t, rediscover, "GPU-b isn't discovered yet")
+	assert.Equal(t, metav1.ConditionTrue, condition.Status)
+}
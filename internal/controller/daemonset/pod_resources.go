@@ -0,0 +1,83 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package daemonset
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	// KubeletPodResourcesSocket is the endpoint of the PodResources API of the kubelet, mounted
+	// in the daemonset pod
+	KubeletPodResourcesSocket = "unix:///var/lib/kubelet/pod-resources/kubelet.sock"
+	podResourcesTimeout       = 10 * time.Second
+)
+
+// PodResourcesLister lists the devices the kubelet assigned to the containers of the pods of
+// the node, it is implemented by the client of the PodResources API
+type PodResourcesLister interface {
+	List(ctx context.Context, in *podresourcesapi.ListPodResourcesRequest, opts ...grpc.CallOption) (*podresourcesapi.ListPodResourcesResponse, error)
+}
+
+// migDeviceUser is a container the kubelet assigned a MIG device to, e.g. through the NVIDIA
+// device plugin
+type migDeviceUser struct {
+	namespace string
+	pod       string
+	container string
+}
+
+func (u migDeviceUser) String() string {
+	return fmt.Sprintf("%s/%s, container %s", u.namespace, u.pod, u.container)
+}
+
+// migDeviceUsers returns the containers using the MIG devices of the node, by MIG UUID. The
+// PodResources API of the kubelet is used when no lister is set.
+func (r *InstaSliceDaemonsetReconciler) migDeviceUsers(ctx context.Context) (map[string]migDeviceUser, error) {
+	lister := r.PodResources
+	if lister == nil {
+		conn, err := grpc.NewClient(KubeletPodResourcesSocket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to connect to the kubelet PodResources API: %v", err)
+		}
+		defer conn.Close()
+		lister = podresourcesapi.NewPodResourcesListerClient(conn)
+	}
+	ctx, cancel := context.WithTimeout(ctx, podResourcesTimeout)
+	defer cancel()
+	resp, err := lister.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the pod resources of the kubelet: %v", err)
+	}
+	users := make(map[string]migDeviceUser)
+	for _, pod := range resp.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			for _, devices := range container.GetDevices() {
+				for _, deviceID := range devices.GetDeviceIds() {
+					users[deviceID] = migDeviceUser{namespace: pod.GetNamespace(), pod: pod.GetName(), container: container.GetName()}
+				}
+			}
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,386 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DefragModes are the supported values of the defragmentation mode
+var DefragModes = []string{DefragModeDisabled, DefragModeDryRun, DefragModeEnabled}
+
+// ValidateDefragMode returns an error when the defragmentation mode isn't supported
+func ValidateDefragMode(mode string) error {
+	for _, known := range DefragModes {
+		if mode == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown defragmentation mode %q, supported modes: %s", mode, strings.Join(DefragModes, ", "))
+}
+
+// slicePlacement is the placement of a slice on a GPU of a node
+type slicePlacement struct {
+	nodeName  string
+	gpuUUID   string
+	placement inferencev1alpha1.Placement
+}
+
+func (p slicePlacement) String() string {
+	return fmt.Sprintf("%s/%s@%d+%d", p.nodeName, p.gpuUUID, p.placement.Start, p.placement.Size)
+}
+
+// defragMove recreates a restartable pod so that its slices move to other placements
+type defragMove struct {
+	pod  *v1.Pod
+	from []slicePlacement
+	to   []slicePlacement
+	// profiles and keys of the slices of the pod, in the order of from
+	profiles []string
+	keys     []types.UID
+}
+
+// defragPlan is the set of pods to recreate to open a placement of a profile
+type defragPlan struct {
+	profile string
+	target  slicePlacement
+	moves   []defragMove
+}
+
+// String describes the plan, one move per pod
+func (p *defragPlan) String() string {
+	var moves []string
+	for _, move := range p.moves {
+		from := make([]string, 0, len(move.from))
+		for _, placement := range move.from {
+			from = append(from, placement.String())
+		}
+		to := make([]string, 0, len(move.to))
+		for _, placement := range move.to {
+			to = append(to, placement.String())
+		}
+		moves = append(moves, fmt.Sprintf("%s/%s: %s -> %s", move.pod.Namespace, move.pod.Name, strings.Join(from, ","), strings.Join(to, ",")))
+	}
+	return fmt.Sprintf("open %s at %s by moving %s", p.profile, p.target, strings.Join(moves, "; "))
+}
+
+// movedSlots returns the number of slots of the slices moved by the plan
+func (p *defragPlan) movedSlots() int32 {
+	var slots int32
+	for _, move := range p.moves {
+		for _, placement := range move.from {
+			slots += placement.placement.Size
+		}
+	}
+	return slots
+}
+
+// podOwnerUID returns the UID of the controller recreating the pod, the UID of the pod when it
+// has none
+func podOwnerUID(pod *v1.Pod) types.UID {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return owner.UID
+	}
+	return pod.UID
+}
+
+// podIsRestartable reports whether the pod declares that it can be recreated elsewhere
+func podIsRestartable(pod *v1.Pod) bool {
+	return pod.Annotations[RestartableAnnotation] == "true"
+}
+
+// planDefragmentation computes the plan moving the fewest pods, then the fewest slots, that
+// opens a placement of the profile. Only running restartable pods are moved, their slices are
+// placed first fit on the other free placements of a single node, as a recreated pod would be.
+// It returns nil when no plan opens a placement.
+func (r *InstasliceReconciler) planDefragmentation(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, profileName string, pod *v1.Pod) (*defragPlan, error) {
+	nodes := make([]*inferencev1alpha1.Instaslice, 0, len(instaslices))
+	for _, instaslice := range instaslices {
+		updatedInstaSliceObject, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, updatedInstaSliceObject)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	movable, err := r.restartablePods(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *defragPlan
+	for _, node := range nodes {
+		mig, ok := node.Status.NodeResources.MigPlacement[profileName]
+		if !ok || !instasliceReady(node) || !r.nodeFitsPod(node.Name, pod) {
+			continue
+		}
+		for _, gpuUUID := range sortGPUs(node) {
+			if !gpuHealthy(node, gpuUUID) {
+				continue
+			}
+			for _, placement := range mig.Placements {
+				target := slicePlacement{nodeName: node.Name, gpuUUID: gpuUUID, placement: placement}
+				plan, ok := r.planDefragmentationAt(nodes, movable, profileName, target)
+				if !ok || len(plan.moves) == 0 {
+					// placements that are already free are used without defragmentation
+					continue
+				}
+				if best == nil || len(plan.moves) < len(best.moves) ||
+					(len(plan.moves) == len(best.moves) && plan.movedSlots() < best.movedSlots()) {
+					best = plan
+				}
+			}
+		}
+	}
+	return best, nil
+}
+
+// planDefragmentationAt returns the plan moving the pods whose slices overlap the target
+// placement. The boolean is false when one of them can't be moved.
+func (r *InstasliceReconciler) planDefragmentationAt(nodes []*inferencev1alpha1.Instaslice, movable map[types.UID]*defragMove, profileName string, target slicePlacement) (*defragPlan, bool) {
+	targetSlots := newSlotMap(nil)
+	for _, node := range nodes {
+		if node.Name == target.nodeName {
+			targetSlots = newSlotMap(node.Status.NodeResources.MigPlacement)
+		}
+	}
+	targetSlots.occupy(target.placement)
+
+	owners := make(map[types.UID]types.UID)
+	for podUID, move := range movable {
+		for _, key := range move.keys {
+			owners[key] = podUID
+		}
+	}
+
+	// pods holding slots of the target placement
+	blockers := make(map[types.UID]bool)
+	excluded := make(map[types.UID]bool)
+	for key, allocResult := range r.allocationCache {
+		if allocResult.GPUUUID != target.gpuUUID || allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+			continue
+		}
+		if targetSlots.isFree(allocResult.MigPlacement) {
+			continue
+		}
+		podUID, ok := owners[key]
+		if !ok {
+			return nil, false
+		}
+		blockers[podUID] = true
+	}
+	for _, nomination := range r.nominations {
+		for _, allocation := range nomination.allocations {
+			if allocation.Result.GPUUUID == target.gpuUUID && !targetSlots.isFree(allocation.Result.MigPlacement) {
+				return nil, false
+			}
+		}
+		for _, placements := range nomination.held {
+			for _, placement := range placements {
+				if placement.gpuUUID == target.gpuUUID && !targetSlots.isFree(placement.placement) {
+					return nil, false
+				}
+			}
+		}
+	}
+
+	plan := &defragPlan{profile: profileName, target: target}
+	podUIDs := make([]types.UID, 0, len(blockers))
+	for podUID := range blockers {
+		podUIDs = append(podUIDs, podUID)
+		for _, key := range movable[podUID].keys {
+			excluded[key] = true
+		}
+	}
+	sort.Slice(podUIDs, func(i, j int) bool { return podUIDs[i] < podUIDs[j] })
+
+	// slot maps of the cluster once the blockers are gone and the target is reserved
+	clusterSlots := make(map[string]map[string]slotMap, len(nodes))
+	for _, node := range nodes {
+		clusterSlots[node.Name] = r.nodeSlotMaps(node, excluded)
+	}
+	clusterSlots[target.nodeName][target.gpuUUID].occupy(target.placement)
+
+	for _, podUID := range podUIDs {
+		move := movable[podUID]
+		to, ok := r.relocateSlices(nodes, clusterSlots, move)
+		if !ok {
+			return nil, false
+		}
+		plan.moves = append(plan.moves, defragMove{pod: move.pod, from: move.from, to: to})
+	}
+	return plan, true
+}
+
+// relocateSlices places the slices of the moved pod first fit on the first node where they all
+// fit, its daemonset is ready and the pod fits the node, and marks their slots as used.
+func (r *InstasliceReconciler) relocateSlices(nodes []*inferencev1alpha1.Instaslice, clusterSlots map[string]map[string]slotMap, move *defragMove) ([]slicePlacement, bool) {
+	profiles := move.profiles
+	for _, node := range nodes {
+		if !instasliceReady(node) || !r.nodeFitsPod(node.Name, move.pod) {
+			continue
+		}
+		gpuSlots := make(map[string]slotMap, len(clusterSlots[node.Name]))
+		for gpuUUID, slots := range clusterSlots[node.Name] {
+			gpuSlots[gpuUUID] = append(slotMap(nil), slots...)
+		}
+		var placed []slicePlacement
+		for _, profileName := range profiles {
+			mig, ok := node.Status.NodeResources.MigPlacement[profileName]
+			if !ok {
+				break
+			}
+			for _, gpuUUID := range sortGPUs(node) {
+				if !gpuHealthy(node, gpuUUID) {
+					continue
+				}
+				if placement, ok := gpuSlots[gpuUUID].firstFit(mig.Placements); ok {
+					gpuSlots[gpuUUID].occupy(placement)
+					placed = append(placed, slicePlacement{nodeName: node.Name, gpuUUID: gpuUUID, placement: placement})
+					break
+				}
+			}
+		}
+		if len(placed) == len(profiles) {
+			clusterSlots[node.Name] = gpuSlots
+			return placed, true
+		}
+	}
+	return nil, false
+}
+
+// restartablePods returns the running restartable pods holding slices, by pod UID. Only the
+// profiles and placements of their slices are set.
+func (r *InstasliceReconciler) restartablePods(ctx context.Context, nodes []*inferencev1alpha1.Instaslice) (map[types.UID]*defragMove, error) {
+	movable := make(map[types.UID]*defragMove)
+	for _, node := range nodes {
+		podUIDs := make(map[types.UID]bool)
+		for key, allocRequest := range node.Spec.PodAllocationRequests {
+			// adopted slices aren't moved
+			if allocationAdopted(node.Status.PodAllocationResults[key]) {
+				continue
+			}
+			podUIDs[allocRequest.PodRef.UID] = true
+		}
+		for podUID := range podUIDs {
+			allocations := getPodAllocations([]inferencev1alpha1.Instaslice{*node}, podUID)
+			if len(allocations) == 0 {
+				continue
+			}
+			running := true
+			for _, allocation := range allocations {
+				if allocation.Result.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusUngated {
+					running = false
+				}
+			}
+			if !running {
+				continue
+			}
+			podRef := allocations[0].Request.PodRef
+			pod := &v1.Pod{}
+			if err := r.Get(ctx, types.NamespacedName{Name: podRef.Name, Namespace: podRef.Namespace}, pod); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			if pod.UID != podUID || !pod.DeletionTimestamp.IsZero() || !podIsRestartable(pod) {
+				continue
+			}
+			move := &defragMove{pod: pod}
+			for _, allocation := range allocations {
+				move.from = append(move.from, slicePlacement{nodeName: node.Name, gpuUUID: allocation.Result.GPUUUID, placement: allocation.Result.MigPlacement})
+				move.profiles = append(move.profiles, allocation.Request.Profile)
+				move.keys = append(move.keys, allocation.key)
+			}
+			movable[podUID] = move
+		}
+	}
+	return movable, nil
+}
+
+// defragUnsupportedMessage explains why no placement is opened for a pod with several slices
+const defragUnsupportedMessage = "defragmentation only opens placements for pods with a single slice"
+
+// defragUnsupported reports whether defragmentation is enabled but can't open a placement for
+// the slices
+func (r *InstasliceReconciler) defragUnsupported(slices []sliceRequest) bool {
+	return r.Config != nil && r.Config.DefragMode != DefragModeDisabled && len(slices) > 1
+}
+
+// defragmentForPod computes the plan opening a placement for the single slice of the pod. In
+// dry-run mode the plan is only logged. Otherwise the opened placement is nominated for the
+// pod and the placements planned for the moved pods are held for their controllers, the moved
+// pods are then evicted by evictForNomination once allocationMu is released. The boolean is
+// true when the plan was run. The caller holds allocationMu.
+func (r *InstasliceReconciler) defragmentForPod(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, slices []sliceRequest, policy AllocationPolicy, pod *v1.Pod) (bool, error) {
+	log := logr.FromContext(ctx)
+	if r.Config == nil || r.Config.DefragMode == DefragModeDisabled || len(slices) != 1 {
+		return false, nil
+	}
+	plan, err := r.planDefragmentation(ctx, instaslices, slices[0].profile, pod)
+	if err != nil || plan == nil {
+		return false, err
+	}
+	if r.Config.DefragMode == DefragModeDryRun {
+		log.Info("defragmentation plan (dry-run)", "pod", pod.Name, "plan", plan.String())
+		return false, nil
+	}
+	log.Info("running defragmentation plan", "pod", pod.Name, "plan", plan.String())
+
+	var instaslice *inferencev1alpha1.Instaslice
+	for i := range instaslices {
+		if instaslices[i].Name == plan.target.nodeName {
+			instaslice = &instaslices[i]
+		}
+	}
+	if instaslice == nil {
+		return false, nil
+	}
+	allocRequest, allocResult := r.setAllocationDetails(policy, instaslice, slices[0], plan.target.gpuUUID, plan.target.placement.Start, pod)
+	nominated := nomination{
+		instasliceName: instaslice.Name,
+		allocations: map[types.UID]utils.Allocation{
+			allocationKey(pod.UID, 0, slices[0]): {Request: *allocRequest, Result: *allocResult},
+		},
+		held: make(map[types.UID][]slicePlacement),
+	}
+	reason := fmt.Sprintf("moved to open a placement for pod %s/%s", pod.Namespace, pod.Name)
+	for _, move := range plan.moves {
+		nominated.evictions = append(nominated.evictions, nominatedEviction{pod: move.pod, reason: reason})
+		owner := podOwnerUID(move.pod)
+		nominated.held[owner] = append(nominated.held[owner], move.to...)
+	}
+	if r.nominations == nil {
+		r.nominations = make(map[types.UID]nomination)
+	}
+	r.nominations[pod.UID] = nominated
+	r.waitQueue.remove(client.ObjectKeyFromObject(pod))
+	return true, nil
+}
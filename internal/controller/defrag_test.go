@@ -0,0 +1,236 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// withRunningSlice stores an ungated 1g.5gb allocation of the pod at the start of the GPU
+func withRunningSlice(instaslice *inferencev1alpha1.Instaslice, pod *v1.Pod, gpuUUID string, start int32) *inferencev1alpha1.Instaslice {
+	if instaslice.Spec.PodAllocationRequests == nil {
+		instaslice.Spec.PodAllocationRequests = map[types.UID]inferencev1alpha1.AllocationRequest{}
+		instaslice.Status.PodAllocationResults = map[types.UID]inferencev1alpha1.AllocationResult{}
+	}
+	instaslice.Spec.PodAllocationRequests[pod.UID] = inferencev1alpha1.AllocationRequest{
+		Profile: "1g.5gb",
+		PodRef:  v1.ObjectReference{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID},
+	}
+	instaslice.Status.PodAllocationResults[pod.UID] = inferencev1alpha1.AllocationResult{
+		GPUUUID:      gpuUUID,
+		Nodename:     types.NodeName(instaslice.Name),
+		MigPlacement: inferencev1alpha1.Placement{Start: start, Size: 1},
+		AllocationStatus: inferencev1alpha1.AllocationStatus{
+			AllocationStatusController: inferencev1alpha1.AllocationStatusUngated,
+			AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+		},
+	}
+	return instaslice
+}
+
+// newMovablePod returns a running restartable 1g.5gb pod of the movable ReplicaSet
+func newMovablePod(name string) *v1.Pod {
+	movable := newPriorityPod(name, 0, "1g.5gb", false)
+	movable.Annotations = map[string]string{RestartableAnnotation: "true"}
+	controller := true
+	movable.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "movable", UID: "movable-rs-uid", Controller: &controller}}
+	return movable
+}
+
+// newFragmentedReconciler returns a reconciler where a 1g.5gb slice is running on each GPU of
+// node-1, only the one on gpu-a is restartable.
+func newFragmentedReconciler(pod *v1.Pod) (*InstasliceReconciler, *v1.Pod) {
+	movable := newMovablePod("movable")
+	pinned := newPriorityPod("pinned", 0, "1g.5gb", false)
+	instaslice := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	withRunningSlice(instaslice, movable, "gpu-a", 0)
+	withRunningSlice(instaslice, pinned, "gpu-b", 0)
+	r := newTestReconciler(instaslice, movable, pinned, pod)
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+	return r, movable
+}
+
+func TestValidateDefragMode(t *testing.T) {
+	for _, mode := range DefragModes {
+		assert.NoError(t, ValidateDefragMode(mode))
+	}
+	assert.Error(t, ValidateDefragMode("sometimes"))
+}
+
+func TestPlanDefragmentation(t *testing.T) {
+	pod := newPriorityPod("training", 0, "7g.40gb", true)
+	r, movable := newFragmentedReconciler(pod)
+
+	plan, err := r.planDefragmentation(context.TODO(), listInstaslices(t, r), "7g.40gb", pod)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, plan) || !assert.Len(t, plan.moves, 1) {
+		return
+	}
+	assert.Equal(t, slicePlacement{nodeName: "node-1", gpuUUID: "gpu-a", placement: inferencev1alpha1.Placement{Start: 0, Size: 8}}, plan.target)
+	assert.Equal(t, movable.UID, plan.moves[0].pod.UID)
+	assert.Equal(t, []slicePlacement{{nodeName: "node-1", gpuUUID: "gpu-b", placement: inferencev1alpha1.Placement{Start: 1, Size: 1}}}, plan.moves[0].to)
+	assert.Equal(t, "open 7g.40gb at node-1/gpu-a@0+8 by moving default/movable: node-1/gpu-a@0+1 -> node-1/gpu-b@1+1", plan.String())
+
+	// without the annotation no pod can be moved
+	delete(plan.moves[0].pod.Annotations, RestartableAnnotation)
+	assert.NoError(t, r.Update(context.TODO(), plan.moves[0].pod))
+	plan, err = r.planDefragmentation(context.TODO(), listInstaslices(t, r), "7g.40gb", pod)
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestPlanDefragmentationChecksTheDestinationNode(t *testing.T) {
+	pod := newPriorityPod("training", 0, "7g.40gb", true)
+	r, movable := newFragmentedReconciler(pod)
+
+	// the only free slots are on node-1, which hasn't the CPU of the moved pod
+	movable.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("128")}
+	assert.NoError(t, r.Update(context.TODO(), movable))
+	plan, err := r.planDefragmentation(context.TODO(), listInstaslices(t, r), "7g.40gb", pod)
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestDefragmentForPod(t *testing.T) {
+	pod := newPriorityPod("training", 0, "7g.40gb", true)
+	r, movable := newFragmentedReconciler(pod)
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	r.Config.DefragMode = DefragModeDryRun
+	defragmented, err := r.defragmentForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.False(t, defragmented)
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(movable), &v1.Pod{}), "the plan is only logged")
+	assert.Empty(t, r.nominations)
+
+	r.Config.DefragMode = DefragModeEnabled
+	defragmented, err = r.defragmentForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.True(t, defragmented)
+	assert.NoError(t, r.evictForNomination(context.TODO(), pod))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(movable), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "movable is evicted")
+
+	nominated, ok := r.nominations[pod.UID]
+	if !assert.True(t, ok) {
+		return
+	}
+	result := nominated.allocations[pod.UID].Result
+	assert.Equal(t, "gpu-a", result.GPUUUID)
+	assert.Equal(t, inferencev1alpha1.Placement{Start: 0, Size: 8}, result.MigPlacement)
+	assert.Empty(t, nominated.evictions)
+	held := slicePlacement{nodeName: "node-1", gpuUUID: "gpu-b", placement: inferencev1alpha1.Placement{Start: 1, Size: 1}}
+	assert.Equal(t, map[types.UID][]slicePlacement{"movable-rs-uid": {held}}, nominated.held)
+
+	// the slice of movable is released, the placement planned for it is kept for its ReplicaSet
+	delete(r.allocationCache, movable.UID)
+	other := newPriorityPod("other", 0, "1g.5gb", true)
+	otherSlices, err := r.podSliceRequests(other)
+	assert.NoError(t, err)
+	_, allocations, err := r.findNodeAndDeviceForPod(context.TODO(), listInstaslices(t, r), otherSlices, &FirstFitPolicy{}, other)
+	assert.NoError(t, err)
+	assert.Equal(t, "gpu-b", allocations[other.UID].Result.GPUUUID)
+	assert.Equal(t, int32(2), allocations[other.UID].Result.MigPlacement.Start, "other can't take the held placement")
+
+	recreated := newMovablePod("movable-recreated")
+	recreated.Spec.SchedulingGates = []v1.PodSchedulingGate{{Name: GateName}}
+	recreatedSlices, err := r.podSliceRequests(recreated)
+	assert.NoError(t, err)
+	_, allocations, err = r.findNodeAndDeviceForPod(context.TODO(), listInstaslices(t, r), recreatedSlices, &FirstFitPolicy{}, recreated)
+	assert.NoError(t, err)
+	assert.Equal(t, held.placement, allocations[recreated.UID].Result.MigPlacement)
+}
+
+func TestDefragmentForPodKeepsNominationWhenEvictionFails(t *testing.T) {
+	pod := newPriorityPod("training", 0, "7g.40gb", true)
+	first, second := newMovablePod("first"), newMovablePod("second")
+	pinned := newPriorityPod("pinned", 0, "1g.5gb", false)
+	instaslice := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	withRunningSlice(instaslice, first, "gpu-a", 0)
+	withRunningSlice(instaslice, second, "gpu-a", 1)
+	withRunningSlice(instaslice, pinned, "gpu-b", 0)
+	r := newTestReconciler(instaslice, first, second, pinned, pod)
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+	r.Config.DefragMode = DefragModeEnabled
+	// a PodDisruptionBudget protects second
+	protected := map[string]bool{second.Name: true}
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+			if subResourceName == "eviction" && protected[obj.GetName()] {
+				return apierrors.NewTooManyRequestsError("the PodDisruptionBudget doesn't allow the eviction")
+			}
+			return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+		},
+	})
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	defragmented, err := r.defragmentForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.True(t, defragmented)
+	assert.Error(t, r.evictForNomination(context.TODO(), pod))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(first), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "first is evicted")
+	nominated, ok := r.nominations[pod.UID]
+	if assert.True(t, ok, "the placement opened by moving first is kept for the pod") && assert.Len(t, nominated.evictions, 1) {
+		assert.Equal(t, second.Name, nominated.evictions[0].pod.Name)
+		assert.Len(t, nominated.held["movable-rs-uid"], 2)
+	}
+
+	// the eviction is allowed again
+	delete(protected, second.Name)
+	assert.NoError(t, r.evictForNomination(context.TODO(), pod))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(second), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "second is evicted")
+	assert.Empty(t, r.nominations[pod.UID].evictions)
+}
+
+func TestDefragmentForPodRejectsSeveralSlices(t *testing.T) {
+	pod := newPriorityPod("training", 0, "7g.40gb", true)
+	pod.Spec.Containers = append(pod.Spec.Containers, migContainer("sidecar", "1g.5gb", "sidecar-cm"))
+	r, movable := newFragmentedReconciler(pod)
+	r.Config.DefragMode = DefragModeEnabled
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	assert.True(t, r.defragUnsupported(slices))
+
+	result, err := r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.NotZero(t, result.RequeueAfter)
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(movable), &v1.Pod{}), "movable isn't moved")
+	assert.Empty(t, r.nominations)
+	condition := podSlicesCondition(t, r, pod)
+	if assert.NotNil(t, condition) {
+		assert.Contains(t, condition.Message, defragUnsupportedMessage)
+	}
+}
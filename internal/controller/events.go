@@ -0,0 +1,192 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Reasons of the events recorded on pods and of their slices condition
+const (
+	ReasonAllocated               = "Allocated"
+	ReasonWaitingForCapacity      = "WaitingForCapacity"
+	ReasonProfileUnknown          = "ProfileUnknown"
+	ReasonNodeConstraintsMismatch = "NodeConstraintsMismatch"
+	ReasonNodeNotReady            = "NodeNotReady"
+	ReasonInsufficientCPU         = "InsufficientCPU"
+	ReasonInsufficientMemory      = "InsufficientMemory"
+	ReasonInsufficientStorage     = "InsufficientStorage"
+	ReasonNoContiguousSlots       = "NoContiguousSlots"
+	ReasonSlicesCreated           = "SlicesCreated"
+	ReasonUngated                 = "Ungated"
+	ReasonSlicesReleased          = "SlicesReleased"
+	ReasonSliceRecycled           = "SliceRecycled"
+	ReasonGPUUnhealthy            = "GPUUnhealthy"
+)
+
+// noPlacementReasons are the reasons a node can't hold the slices of a pod, from the closest
+// to fitting to the farthest. The closest reason found on a node is the one reported.
+var noPlacementReasons = []struct {
+	reason      string
+	description string
+}{
+	{ReasonNoContiguousSlots, "with no contiguous free slots"},
+	{ReasonInsufficientCPU, "with insufficient cpu"},
+	{ReasonInsufficientMemory, "with insufficient memory"},
+	{ReasonInsufficientStorage, "with insufficient storage"},
+	{ReasonNodeConstraintsMismatch, "not matching the node selector, affinity or tolerations"},
+	{ReasonNodeNotReady, "not ready"},
+	{ReasonProfileUnknown, "without the profile"},
+}
+
+// recordEvent records an event on the object when the reconciler has a recorder
+func (r *InstasliceReconciler) recordEvent(object runtime.Object, eventType, reason, message string) {
+	if r.Recorder != nil {
+		r.Recorder.Event(object, eventType, reason, message)
+	}
+}
+
+// recordPodRefEvent records an event on the pod of an allocation request
+func (r *InstasliceReconciler) recordPodRefEvent(podRef v1.ObjectReference, eventType, reason, message string) {
+	podRef.Kind, podRef.APIVersion = "Pod", "v1"
+	r.recordEvent(&podRef, eventType, reason, message)
+}
+
+// reportSlicesStatus sets the slices condition of the pod and records an event with the same
+// reason and message. Nothing is done when the condition didn't change, so that requeued pods
+// don't repeat the event. Failing to set the condition doesn't fail the reconcile.
+func (r *InstasliceReconciler) reportSlicesStatus(ctx context.Context, pod *v1.Pod, status v1.ConditionStatus, eventType, reason, message string) {
+	condition := v1.PodCondition{
+		Type:               PodSlicesReadyCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	}
+	original := pod.DeepCopy()
+	if !setPodCondition(&pod.Status, condition) {
+		return
+	}
+	r.recordEvent(pod, eventType, reason, message)
+	if err := r.Status().Patch(ctx, pod, client.StrategicMergeFrom(original)); err != nil {
+		logr.FromContext(ctx).Error(err, "failed to set the slices condition", "pod", pod.Name, "reason", reason)
+	}
+}
+
+// setPodCondition sets the condition in the pod status, the transition time is kept when the
+// status doesn't change. It reports whether the condition changed.
+func setPodCondition(status *v1.PodStatus, condition v1.PodCondition) bool {
+	for i, existing := range status.Conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+			return false
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		status.Conditions[i] = condition
+		return true
+	}
+	status.Conditions = append(status.Conditions, condition)
+	return true
+}
+
+// explainNoPlacement returns why none of the nodes can hold the slices of the pod, the
+// message counts the nodes by reason, like the scheduler does.
+func (r *InstasliceReconciler) explainNoPlacement(instaslices []inferencev1alpha1.Instaslice, slices []sliceRequest, pod *v1.Pod) (string, string) {
+	var profiles []string
+	for _, slice := range slices {
+		profiles = append(profiles, slice.profile)
+	}
+	if len(instaslices) == 0 {
+		return ReasonWaitingForCapacity, "no node is managed by instaslice"
+	}
+	nodes := make(map[string]int)
+	for i := range instaslices {
+		nodes[r.nodeNoPlacementReason(&instaslices[i], profiles, pod)]++
+	}
+	reason := ""
+	var counts []string
+	for _, candidate := range noPlacementReasons {
+		count, ok := nodes[candidate.reason]
+		if !ok {
+			continue
+		}
+		if reason == "" {
+			reason = candidate.reason
+		}
+		counts = append(counts, fmt.Sprintf("%d %s", count, candidate.description))
+	}
+	return reason, fmt.Sprintf("0/%d nodes can hold the slices of profile %s: %s", len(instaslices), strings.Join(profiles, ", "), strings.Join(counts, ", "))
+}
+
+// nodeNoPlacementReason returns why the node can't hold the slices of the profiles
+func (r *InstasliceReconciler) nodeNoPlacementReason(instaslice *inferencev1alpha1.Instaslice, profiles []string, pod *v1.Pod) string {
+	for _, profile := range profiles {
+		if _, ok := instaslice.Status.NodeResources.MigPlacement[profile]; !ok {
+			return ReasonProfileUnknown
+		}
+	}
+	if !instasliceReady(instaslice) {
+		return ReasonNodeNotReady
+	}
+	if !r.ResourceCache.Schedulable(instaslice.Name, pod) {
+		return ReasonNodeConstraintsMismatch
+	}
+	insufficient, _ := r.ResourceCache.Insufficient(instaslice.Name, pod)
+	if len(insufficient) == 0 {
+		return ReasonNoContiguousSlots
+	}
+	switch insufficient[0] {
+	case v1.ResourceCPU:
+		return ReasonInsufficientCPU
+	case v1.ResourceMemory:
+		return ReasonInsufficientMemory
+	}
+	return ReasonInsufficientStorage
+}
+
+// describeAllocations lists the placements of the allocations, ordered by key
+func describeAllocations(allocations map[types.UID]inferencev1alpha1.AllocationResult) string {
+	keys := make([]types.UID, 0, len(allocations))
+	for key := range allocations {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	placements := make([]string, 0, len(keys))
+	for _, key := range keys {
+		allocResult := allocations[key]
+		placements = append(placements, slicePlacement{
+			nodeName:  string(allocResult.Nodename),
+			gpuUUID:   allocResult.GPUUUID,
+			placement: allocResult.MigPlacement,
+		}.String())
+	}
+	return strings.Join(placements, ", ")
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// drainEvents returns the events recorded so far
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func podSlicesCondition(t *testing.T, r *InstasliceReconciler, pod *v1.Pod) *v1.PodCondition {
+	var latest v1.Pod
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(pod), &latest))
+	for _, condition := range latest.Status.Conditions {
+		if condition.Type == PodSlicesReadyCondition {
+			return &condition
+		}
+	}
+	return nil
+}
+
+func TestExplainNoPlacement(t *testing.T) {
+	holder := newPriorityPod("holder", 0, "7g.40gb", false)
+	pod := newPriorityPod("inference", 0, "7g.40gb", true)
+	pod.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")}
+	full := withRunningPod(newTestInstaslice("node-1", "gpu-a"), holder, "gpu-a")
+	small := newTestInstaslice("node-2", "gpu-b")
+	a30 := newTestInstaslice("node-3", "gpu-c")
+	a30.Status.NodeResources.MigPlacement = a30MigPlacement()
+	r := newTestReconciler(full, small, a30, holder, pod)
+	r.ResourceCache = newTestResourceCache("node-1", "node-3")
+	r.ResourceCache.ResourceEventHandlerForNode().AddFunc(&v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("1"),
+			v1.ResourceMemory: resource.MustParse("256Gi"),
+		}},
+	})
+	r.allocationCache[holder.UID] = full.Status.PodAllocationResults[holder.UID]
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	reason, message := r.explainNoPlacement(listInstaslices(t, r), slices, pod)
+	assert.Equal(t, ReasonNoContiguousSlots, reason)
+	assert.Equal(t, "0/3 nodes can hold the slices of profile 7g.40gb: 1 with no contiguous free slots, 1 with insufficient cpu, 1 without the profile", message)
+
+	reason, _ = r.explainNoPlacement(listInstaslices(t, r)[1:], slices, pod)
+	assert.Equal(t, ReasonInsufficientCPU, reason)
+	reason, _ = r.explainNoPlacement(listInstaslices(t, r)[2:], slices, pod)
+	assert.Equal(t, ReasonProfileUnknown, reason)
+
+	// the reason is recorded on the pod once, while it keeps waiting
+	for i := 0; i < 2; i++ {
+		_, err = r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Warning NoContiguousSlots " + message}, drainEvents(recorder))
+	condition := podSlicesCondition(t, r, pod)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionFalse, condition.Status)
+		assert.Equal(t, ReasonNoContiguousSlots, condition.Reason)
+	}
+}
+
+func TestReportSlicesStatusOnAllocation(t *testing.T) {
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), pod)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	_, err = r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	message := "slices allocated, waiting for the daemonset to create them: node-1/gpu-a@0+1"
+	assert.Equal(t, []string{"Normal Allocated " + message}, drainEvents(recorder))
+	condition := podSlicesCondition(t, r, pod)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionFalse, condition.Status)
+		assert.Equal(t, ReasonAllocated, condition.Reason)
+		assert.Equal(t, message, condition.Message)
+	}
+	assert.True(t, checkIfPodGatedByInstaSlice(pod), "the condition doesn't hide the gate")
+
+	r.reportSlicesStatus(context.TODO(), pod, v1.ConditionTrue, v1.EventTypeNormal, ReasonSlicesCreated, "slices created: node-1/gpu-a@0+1")
+	condition = podSlicesCondition(t, r, pod)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionTrue, condition.Status)
+		assert.Equal(t, ReasonSlicesCreated, condition.Reason)
+	}
+	assert.Len(t, drainEvents(recorder), 1)
+}
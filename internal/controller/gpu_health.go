@@ -0,0 +1,163 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilcache "k8s.io/client-go/tools/cache"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The daemonset marks a GPU raising a critical XID unhealthy with the Healthy condition of the
+// GPU in the Instaslice of its node. No slice is placed on an unhealthy GPU and the waiting
+// pods are woken once it recovers. When configured, the pods using the slices of a GPU marked
+// unhealthy are evicted, so that their controllers create them again on healthy GPUs.
+
+// gpuHealthy reports whether the GPU of the node takes new slices, a GPU without the Healthy
+// condition is healthy
+func gpuHealthy(instaslice *inferencev1alpha1.Instaslice, gpuUUID string) bool {
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == gpuUUID {
+			return !meta.IsStatusConditionFalse(gpu.Conditions, GPUHealthyCondition)
+		}
+	}
+	return true
+}
+
+// unhealthyGPUs returns the unhealthy GPUs of the node
+func unhealthyGPUs(instaslice *inferencev1alpha1.Instaslice) map[string]bool {
+	unhealthy := make(map[string]bool)
+	for _, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID != "" && !gpuHealthy(instaslice, gpu.GPUUUID) {
+			unhealthy[gpu.GPUUUID] = true
+		}
+	}
+	return unhealthy
+}
+
+// recoveredGPUs reports whether a GPU of the node was marked healthy again
+func recoveredGPUs(oldInstaslice, newInstaslice *inferencev1alpha1.Instaslice) bool {
+	for gpuUUID := range unhealthyGPUs(oldInstaslice) {
+		if gpuHealthy(newInstaslice, gpuUUID) {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantinedPods returns the pods holding ungated slices on the GPUs marked unhealthy between
+// the two versions of the Instaslice. The pods of adopted slices are not managed by InstaSlice.
+func quarantinedPods(oldInstaslice, newInstaslice *inferencev1alpha1.Instaslice) []types.NamespacedName {
+	wasUnhealthy := unhealthyGPUs(oldInstaslice)
+	quarantined := make(map[string]bool)
+	for gpuUUID := range unhealthyGPUs(newInstaslice) {
+		if !wasUnhealthy[gpuUUID] {
+			quarantined[gpuUUID] = true
+		}
+	}
+	if len(quarantined) == 0 {
+		return nil
+	}
+	seen := make(map[types.NamespacedName]bool)
+	var pods []types.NamespacedName
+	for key, allocResult := range newInstaslice.Status.PodAllocationResults {
+		if !quarantined[allocResult.GPUUUID] || allocationAdopted(allocResult) ||
+			allocResult.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusUngated {
+			continue
+		}
+		allocRequest, ok := newInstaslice.Spec.PodAllocationRequests[key]
+		if !ok {
+			continue
+		}
+		pod := types.NamespacedName{Namespace: allocRequest.PodRef.Namespace, Name: allocRequest.PodRef.Name}
+		if !seen[pod] {
+			seen[pod] = true
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].String() < pods[j].String() })
+	return pods
+}
+
+// gpuHealthEventHandler sends the pods using the slices of the GPUs marked unhealthy to the
+// controller, which evicts them
+func (r *InstasliceReconciler) gpuHealthEventHandler() utilcache.ResourceEventHandlerFuncs {
+	wake := func(pods []types.NamespacedName) {
+		if len(pods) > 0 {
+			logr.FromContext(context.Background()).Info("waking pods using unhealthy GPUs", "pods", pods)
+			r.waitQueue.send(pods...)
+		}
+	}
+	return utilcache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if instaslice, ok := obj.(*inferencev1alpha1.Instaslice); ok {
+				wake(quarantinedPods(&inferencev1alpha1.Instaslice{}, instaslice))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldInstaslice, okOld := oldObj.(*inferencev1alpha1.Instaslice)
+			newInstaslice, okNew := newObj.(*inferencev1alpha1.Instaslice)
+			if okOld && okNew {
+				wake(quarantinedPods(oldInstaslice, newInstaslice))
+			}
+		},
+	}
+}
+
+func (r *InstasliceReconciler) evictOnUnhealthyGPU() bool {
+	return r.Config != nil && r.Config.EvictOnUnhealthyGPU
+}
+
+// evictFromUnhealthyGPU evicts the running pod when one of its slices is on an unhealthy GPU,
+// its slices are released once it terminates. The eviction is retried while a
+// PodDisruptionBudget doesn't allow it.
+func (r *InstasliceReconciler) evictFromUnhealthyGPU(ctx context.Context, pod *v1.Pod, podInstaslices []inferencev1alpha1.Instaslice) (ctrl.Result, error) {
+	log := logr.FromContext(ctx)
+	nodes := make(map[string]*inferencev1alpha1.Instaslice, len(podInstaslices))
+	for i := range podInstaslices {
+		nodes[podInstaslices[i].Name] = &podInstaslices[i]
+	}
+	for _, allocation := range getPodAllocations(podInstaslices, pod.UID) {
+		allocResult := allocation.Result
+		if allocationAdopted(allocResult) || allocResult.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusUngated ||
+			gpuHealthy(nodes[allocation.instasliceName], allocResult.GPUUUID) {
+			continue
+		}
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace}}
+		if err := r.SubResource("eviction").Create(ctx, pod, eviction); err != nil {
+			if apierrors.IsNotFound(err) {
+				return ctrl.Result{}, nil
+			}
+			return ctrl.Result{}, fmt.Errorf("failed to evict pod %s/%s from unhealthy GPU %s: %w", pod.Namespace, pod.Name, allocResult.GPUUUID, err)
+		}
+		log.Info("evicted pod using a slice of an unhealthy GPU", "pod", pod.Name, "namespace", pod.Namespace, "gpuUUID", allocResult.GPUUUID, "nodeName", allocResult.Nodename)
+		r.recordEvent(pod, v1.EventTypeWarning, ReasonGPUUnhealthy, fmt.Sprintf("evicted, GPU %s of node %s is unhealthy", allocResult.GPUUUID, allocResult.Nodename))
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// withGPUHealth sets the Healthy condition of the GPU
+func withGPUHealth(instaslice *inferencev1alpha1.Instaslice, gpuUUID string, status metav1.ConditionStatus) *inferencev1alpha1.Instaslice {
+	for i, gpu := range instaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID == gpuUUID {
+			instaslice.Status.NodeResources.NodeGPUs[i].Conditions = []metav1.Condition{{Type: GPUHealthyCondition, Status: status, Reason: "CriticalXID"}}
+		}
+	}
+	return instaslice
+}
+
+func TestUnhealthyGPUTakesNoSlices(t *testing.T) {
+	instaslice := withGPUHealth(newTestInstaslice("node-1", "gpu-a", "gpu-b"), "gpu-a", metav1.ConditionFalse)
+	r := newTestReconciler(instaslice)
+
+	candidates := nodePlacementCandidates(instaslice, "7g.40gb", r.nodeSlotMaps(instaslice, nil))
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, "gpu-b", candidates[0].gpuUUID)
+	}
+
+	withGPUHealth(instaslice, "gpu-b", metav1.ConditionFalse)
+	assert.Empty(t, nodePlacementCandidates(instaslice, "1g.5gb", r.nodeSlotMaps(instaslice, nil)))
+
+	// a GPU marked healthy again takes slices
+	withGPUHealth(instaslice, "gpu-a", metav1.ConditionTrue)
+	candidates = nodePlacementCandidates(instaslice, "7g.40gb", r.nodeSlotMaps(instaslice, nil))
+	if assert.Len(t, candidates, 1) {
+		assert.Equal(t, "gpu-a", candidates[0].gpuUUID)
+	}
+}
+
+func TestQuarantinedPods(t *testing.T) {
+	running := newPriorityPod("running", 0, "7g.40gb", false)
+	healthy := withRunningPod(newTestInstaslice("node-1", "gpu-a", "gpu-b"), running, "gpu-a")
+	unhealthyB := withGPUHealth(healthy.DeepCopy(), "gpu-b", metav1.ConditionFalse)
+	unhealthyA := withGPUHealth(unhealthyB.DeepCopy(), "gpu-a", metav1.ConditionFalse)
+
+	assert.Empty(t, quarantinedPods(healthy, unhealthyB), "no pod uses gpu-b")
+	assert.Equal(t, []types.NamespacedName{{Namespace: "default", Name: "running"}}, quarantinedPods(unhealthyB, unhealthyA))
+	assert.Empty(t, quarantinedPods(unhealthyA, unhealthyA.DeepCopy()), "gpu-a was already unhealthy")
+	assert.Len(t, quarantinedPods(&inferencev1alpha1.Instaslice{}, unhealthyA), 1, "the unhealthy GPUs of an added Instaslice are quarantined")
+	assert.True(t, recoveredGPUs(unhealthyA, unhealthyB))
+	assert.False(t, recoveredGPUs(unhealthyB, unhealthyA))
+}
+
+func TestEvictFromUnhealthyGPU(t *testing.T) {
+	running := newPriorityPod("running", 0, "7g.40gb", false)
+	instaslice := withRunningPod(newTestInstaslice("node-1", "gpu-a"), running, "gpu-a")
+	r := newTestReconciler(instaslice, running)
+
+	_, err := r.evictFromUnhealthyGPU(context.TODO(), running, listInstaslices(t, r))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(running), &v1.Pod{}), "the GPU is healthy")
+
+	unhealthy := withGPUHealth(listInstaslices(t, r)[0].DeepCopy(), "gpu-a", metav1.ConditionFalse)
+	assert.NoError(t, r.Status().Update(context.TODO(), unhealthy))
+	_, err = r.evictFromUnhealthyGPU(context.TODO(), running, listInstaslices(t, r))
+	assert.NoError(t, err)
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(running), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "running is evicted")
+}
+
+func TestWaitQueueEventHandlerWakesOnRecoveredGPU(t *testing.T) {
+	unhealthy := withGPUHealth(newTestInstaslice("node-1", "gpu-a"), "gpu-a", metav1.ConditionFalse)
+	r := newTestReconciler(unhealthy)
+	r.waitQueue.add(types.NamespacedName{Namespace: "default", Name: "waiting"}, 0, "1g.5gb")
+	handler := r.waitQueueEventHandler()
+
+	handler.OnUpdate(unhealthy, unhealthy.DeepCopy())
+	assert.Len(t, r.waitQueue.pods, 1)
+
+	handler.OnUpdate(unhealthy, withGPUHealth(unhealthy.DeepCopy(), "gpu-a", metav1.ConditionTrue))
+	assert.Empty(t, r.waitQueue.pods)
+}
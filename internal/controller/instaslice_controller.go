@@ -19,11 +19,12 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
-	"math/rand"
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/manifestival/manifestival"
@@ -34,7 +35,6 @@ import (
 	rcache "github.com/openshift/instaslice-operator/internal/controller/cache"
 	"github.com/openshift/instaslice-operator/internal/controller/config"
 	mf "github.com/openshift/instaslice-operator/internal/controller/manifests"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
@@ -45,8 +45,10 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -55,6 +57,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // InstasliceReconciler reconciles a Instaslice object
@@ -69,23 +72,33 @@ type InstasliceReconciler struct {
 	// Optional override for testing
 	createDSFn    func(namespace string) *appsv1.DaemonSet
 	ResourceCache *rcache.ResourceCache
+	// Recorder records the lifecycle events of the pods, they aren't recorded when nil
+	Recorder record.EventRecorder
+	// APIReader reads the pods of orphaned allocations from the API server, the client is
+	// used when nil
+	APIReader client.Reader
+	// nominations are the placements freed for preemptors, by pod UID
+	nominations map[types.UID]nomination
+	// reserving are the allocations placed in the cache and not yet stored on the Instaslice
+	// objects, they are kept when the cache is rebuilt or cleaned up
+	reserving map[types.UID]inferencev1alpha1.AllocationResult
+	// stuckPods are the pods whose slices got stuck in creating, by pod UID
+	stuckPods map[types.UID]*stuckPod
+	// cacheSuspects are the kinds of divergence the last check of the cache found, by key
+	cacheSuspects map[types.UID]string
+	// cacheVersion counts the changes of the cache made outside of rebuilds and cleanups, which
+	// read the Instaslice objects without holding allocationMu and don't trust a read that
+	// raced with a change
+	cacheVersion uint64
+	// waitQueue holds the pods that no node can hold until capacity is freed for them
+	waitQueue waitQueue
+	// allocationMu guards allocationCache, isCacheInitialized, nominations, reserving,
+	// stuckPods, cacheSuspects and cacheVersion, which are shared by the concurrent reconciles and the watchdog. Slices are
+	// placed and reserved in the cache while holding it, the reservations are then stored on
+	// the Instaslice objects, and pods evicted, without holding it.
+	allocationMu sync.Mutex
 }
 
-// AllocationPolicy interface with a single method
-type AllocationPolicy interface {
-	SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName, allocationStatus inferencev1alpha1.AllocationStatus,
-		discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32, namespace string, podName string, gpuUuid string, resourceIndetifier types.UID) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult)
-}
-
-// not implemented
-type RightToLeftPolicy struct{}
-
-// not implemented
-type LeftToRightPolicy struct{}
-
-// first fit policy is implemented at the moment
-type FirstFitPolicy struct{}
-
 var daemonSetlabel = map[string]string{"app": "controller-daemonset"}
 
 type NodeReconciler struct {
@@ -96,7 +109,11 @@ type NodeReconciler struct {
 //+kubebuilder:rbac:groups=inference.redhat.com,resources=instaslices/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=inference.redhat.com,resources=instaslices/finalizers,verbs=update
 //+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+//+kubebuilder:rbac:groups="",resources=pods/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;update;patch;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=nodes/status,verbs=get;list;update;patch;watch
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;delete
 //+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
@@ -204,55 +221,8 @@ func (r *InstasliceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			return ctrl.Result{}, err
 		}
 	}
-	// rebuild cache on node failure
-	node := &v1.Node{}
-	err := r.Get(ctx, req.NamespacedName, node)
-	if err != nil {
-		if !apierrors.IsNotFound(err) {
-			log.Error(err, "Failed to get Node")
-			return ctrl.Result{}, err
-		}
-	} else {
-		for _, condition := range node.Status.Conditions {
-			if condition.Type == v1.NodeReady && condition.Status != v1.ConditionTrue {
-				log.Info("Detected a node going down", "node", node.Name)
-				if err := r.rebuildAllocationCache(ctx); err != nil {
-					return ctrl.Result{}, err
-				}
-				break
-			}
-		}
-	}
-	// Continue with the rest of the reconciliation logic
-	policy := &FirstFitPolicy{}
 	pod := &v1.Pod{}
-	var instasliceList inferencev1alpha1.InstasliceList
-	if err = r.List(ctx, &instasliceList, &client.ListOptions{}); err != nil {
-		log.Error(err, "Error getting Instaslice object")
-		return ctrl.Result{}, err
-	}
-
-	for _, instaslice := range instasliceList.Items {
-		// Get the node object on which the instaslice object is present
-		node := &v1.Node{}
-		if err = r.Get(ctx, client.ObjectKey{Name: instaslice.Name}, node); err != nil {
-			log.Error(err, "error getting the node object", "name", instaslice.Name)
-			return ctrl.Result{RequeueAfter: Requeue1sDelay}, err
-		}
-
-		if instaslice.Status.NodeResources.BootID == "" {
-			log.Info("Instaslice boot ID not yet populated, requeuing", "node", node.Name)
-			return ctrl.Result{RequeueAfter: Requeue5sDelay}, nil
-		}
-
-		if instaslice.Status.NodeResources.BootID != node.Status.NodeInfo.BootID {
-			err := fmt.Errorf("instaslice not in sync with the node as the boot id doesn't match")
-			log.Error(err, "instaslice's boot id not matching node's boot id", "node's boot id", node.Status.NodeInfo.BootID, "instaslice's boot id", instaslice.Status.NodeResources.BootID)
-			return ctrl.Result{RequeueAfter: Requeue10sDelay}, err
-		}
-	}
-
-	err = r.Get(ctx, req.NamespacedName, pod)
+	err := r.Get(ctx, req.NamespacedName, pod)
 	if err != nil {
 		// Error fetching the Pod
 		if errors.IsNotFound(err) {
@@ -282,42 +252,56 @@ func (r *InstasliceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
+	// only the Instaslice objects holding allocations of the pod are fetched, all of them are
+	// listed when slices are allocated to the pod
+	podInstaslices, err := r.getPodInstaslices(ctx, pod.UID)
+	if err != nil {
+		log.Error(err, "Error getting Instaslice object")
+		return ctrl.Result{}, err
+	}
+	// the pod waits for its own nodes to be in sync, the other nodes don't hold it back
+	if len(r.instaslicesInSync(ctx, podInstaslices)) != len(podInstaslices) {
+		return ctrl.Result{RequeueAfter: Requeue5sDelay}, nil
+	}
+
 	// failed pods are not deleted by InstaSlice, finalizer is removed so that user can
 	// delete the pod.
 	if pod.Status.Phase == v1.PodFailed && controllerutil.ContainsFinalizer(pod, FinalizerName) {
-		for _, instaslice := range instasliceList.Items {
-			for uuid, allocation := range instaslice.Status.PodAllocationResults {
-				allocRequest := instaslice.Spec.PodAllocationRequests[uuid]
-				if pod.UID == uuid {
-					if allocation.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusCreating && allocation.AllocationStatus.AllocationStatusDaemonset == "" {
-						return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
-					}
-					if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated || allocation.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated {
-						resultDeleting, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, &allocation, &allocRequest)
-						if err != nil {
-							return resultDeleting, nil
-						}
-						// return and rely on daemonset to se allocation status to created
-						// this will cause podmap function to wakeup pod and perform clean up
-						return ctrl.Result{}, nil
-					}
-					if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
-						err := r.removeInstasliceAllocation(ctx, instaslice.Name, &allocation)
-						if err != nil {
-							return ctrl.Result{}, err
-						}
-						r.CleanupOrphanedAllocations(ctx, &instasliceList)
-						// update DeployedPodTotal Metrics by setting value to 0 as pod allocation is deleted and pod is no loger consuming slices
-						r.UpdateDeployedPodTotalMetrics(string(allocation.Nodename), allocation.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, 0)
-						// update compatible profiles metrics
-						r.UpdateCompatibleProfilesMetrics(instaslice, instaslice.Name)
-						// requeue for the finalizer to be removed
-						return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
-					}
-					return ctrl.Result{}, nil
+		allocations := getPodAllocations(podInstaslices, pod.UID)
+		requeue := false
+		for _, allocation := range allocations {
+			allocResult, allocRequest := allocation.Result, allocation.Request
+			switch {
+			case allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusCreating && allocResult.AllocationStatus.AllocationStatusDaemonset == "":
+				requeue = true
+			case allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated || allocResult.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated:
+				recycled, err := r.recycleSlice(ctx, allocation)
+				if err != nil {
+					return ctrl.Result{Requeue: true}, nil
+				}
+				if recycled {
+					continue
+				}
+				resultDeleting, err := r.setInstasliceAllocationToDeleting(ctx, allocation.instasliceName, allocation.key, &allocResult, &allocRequest)
+				if err != nil {
+					return resultDeleting, nil
+				}
+			case allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted:
+				if err := r.releasePodAllocation(ctx, allocation); err != nil {
+					return ctrl.Result{}, err
 				}
+				// requeue for the finalizer to be removed
+				requeue = true
 			}
 		}
+		if requeue {
+			return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
+		}
+		if len(allocations) > 0 {
+			// return and rely on daemonset to set allocation status to deleted
+			// this will cause podmap function to wakeup pod and perform clean up
+			return ctrl.Result{}, nil
+		}
 		// pod can be terminated without any allocation
 		if controllerutil.RemoveFinalizer(pod, FinalizerName) {
 			if err := r.Update(ctx, pod); err != nil {
@@ -330,42 +314,44 @@ func (r *InstasliceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	// pod is completed move allocation to deleting state and return
+	// pod is completed move allocations to deleting state and return
 	if pod.Status.Phase == v1.PodSucceeded && controllerutil.ContainsFinalizer(pod, FinalizerName) {
-		for _, instaslice := range instasliceList.Items {
-			for uuid, allocation := range instaslice.Status.PodAllocationResults {
-				if uuid == pod.UID {
-					allocRequest := instaslice.Spec.PodAllocationRequests[uuid]
-					if allocation.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
-						log.Info("setting status to deleting", "pod", pod.Name)
-						result, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, &allocation, &allocRequest)
-						if err != nil {
-							return result, err
-						}
-						// return and rely on daemonset to se allocation status to created
-						// this will cause podmap function to wakeup pod and perform clean up
-						return ctrl.Result{}, nil
-					}
-
-					if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
-						err := r.removeInstasliceAllocation(ctx, instaslice.Name, &allocation)
-						if err != nil {
-							return ctrl.Result{}, err
-						}
-						r.CleanupOrphanedAllocations(ctx, &instasliceList)
-						// update DeployedPodTotal Metrics by setting value to 0 as pod allocation is deleted and pod is no loger consuming slices
-						r.UpdateDeployedPodTotalMetrics(string(allocation.Nodename), allocation.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, 0)
-						// update compatible profiles metrics
-						r.UpdateCompatibleProfilesMetrics(instaslice, instaslice.Name)
-						// requeue for the finalizer to be removed
-						return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
-					}
-					return ctrl.Result{}, nil
+		allocations := getPodAllocations(podInstaslices, pod.UID)
+		requeue := false
+		for _, allocation := range allocations {
+			allocResult, allocRequest := allocation.Result, allocation.Request
+			if allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
+				// the slice may be handed over to a waiting pod instead of being deleted
+				recycled, err := r.recycleSlice(ctx, allocation)
+				if err != nil {
+					return ctrl.Result{Requeue: true}, err
 				}
+				if recycled {
+					continue
+				}
+				log.Info("setting status to deleting", "pod", pod.Name, "container", allocRequest.ContainerName)
+				result, err := r.setInstasliceAllocationToDeleting(ctx, allocation.instasliceName, allocation.key, &allocResult, &allocRequest)
+				if err != nil {
+					return result, err
+				}
+				continue
+			}
+			if err := r.releasePodAllocation(ctx, allocation); err != nil {
+				return ctrl.Result{}, err
 			}
+			// requeue for the finalizer to be removed
+			requeue = true
+		}
+		if requeue {
+			return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
+		}
+		if len(allocations) > 0 {
+			// return and rely on daemonset to set allocation status to deleted
+			// this will cause podmap function to wakeup pod and perform clean up
+			return ctrl.Result{}, nil
 		}
 
-		// pod can be terminated as allocation was deleted in previous reconcile loop
+		// pod can be terminated as allocations were deleted in previous reconcile loop
 		if controllerutil.RemoveFinalizer(pod, FinalizerName) {
 			if err := r.Update(ctx, pod); err != nil {
 				// requeing immediately as the finalizer removal gets lost
@@ -379,134 +365,161 @@ func (r *InstasliceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	// handle deleted pod that never gets ungated
 	// set allocation status to deleting to cleanup resources if any
 	if !pod.DeletionTimestamp.IsZero() && isPodGated {
-		// allocation can be in creating or created while the user deletes the pod.
-		for _, instaslice := range instasliceList.Items {
-			for podUuid, allocation := range instaslice.Status.PodAllocationResults {
-				allocRequest := instaslice.Spec.PodAllocationRequests[podUuid]
-				if podUuid == pod.UID && (allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated) {
-					allocation.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
-					if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &allocation, &allocRequest); err != nil {
-						log.Info("unable to set instaslice to state deleted for ungated", "pod", pod.Name)
-						return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
-					}
-					return ctrl.Result{}, nil
+		r.allocationMu.Lock()
+		delete(r.nominations, pod.UID)
+		r.allocationMu.Unlock()
+		r.waitQueue.remove(client.ObjectKeyFromObject(pod))
+		// allocations can be in creating or created while the user deletes the pod.
+		released, remaining := false, false
+		for _, allocation := range getPodAllocations(podInstaslices, pod.UID) {
+			allocResult, allocRequest := allocation.Result, allocation.Request
+			switch allocResult.AllocationStatus.AllocationStatusDaemonset {
+			case inferencev1alpha1.AllocationStatusCreated:
+				allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+				if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, allocation.instasliceName, allocation.key, &allocResult, &allocRequest); err != nil {
+					log.Info("unable to set instaslice to state deleted for ungated", "pod", pod.Name)
+					return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
 				}
-				if podUuid == pod.UID && allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
-					err := r.removeInstasliceAllocation(ctx, instaslice.Name, &allocation)
-					if err != nil {
-						return ctrl.Result{}, err
-					}
-					r.CleanupOrphanedAllocations(ctx, &instasliceList)
-					// update DeployedPodTotal Metrics by setting value to 0 as pod allocation is deleted and pod is no loger consuming slices
-					r.UpdateDeployedPodTotalMetrics(string(allocation.Nodename), allocation.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, 0)
-					// update compatible profiles metrics
-					r.UpdateCompatibleProfilesMetrics(instaslice, instaslice.Name)
-					if controllerutil.RemoveFinalizer(pod, FinalizerName) {
-						if err := r.Update(ctx, pod); err != nil {
-							// requeing immediately as the finalizer removal gets lost
-							return ctrl.Result{Requeue: true}, nil
-						}
-						log.Info("finalizer deleted for allocation status deleted ", "pod", pod.Name)
-					}
-					return ctrl.Result{}, nil
+				remaining = true
+			case inferencev1alpha1.AllocationStatusDeleted:
+				if err := r.releasePodAllocation(ctx, allocation); err != nil {
+					return ctrl.Result{}, err
 				}
+				released = true
+			default:
+				remaining = true
 			}
 		}
+		if released && !remaining && controllerutil.RemoveFinalizer(pod, FinalizerName) {
+			if err := r.Update(ctx, pod); err != nil {
+				// requeing immediately as the finalizer removal gets lost
+				return ctrl.Result{Requeue: true}, nil
+			}
+			log.Info("finalizer deleted for allocation status deleted ", "pod", pod.Name)
+		}
 		return ctrl.Result{}, nil
 	}
-	// handle graceful termination of pods, wait for about 30 seconds from the time deletiontimestamp is set on the pod
+	// handle graceful termination of pods, the slices are kept until the containers terminated
+	// or the teardown delay elapsed since the deletion was requested
 	if !pod.DeletionTimestamp.IsZero() {
 		log.Info("set status to deleting for ", "pod", pod.Name)
 		if controllerutil.ContainsFinalizer(pod, FinalizerName) {
-			for _, instaslice := range instasliceList.Items {
-				for podUuid, allocation := range instaslice.Status.PodAllocationResults {
-					if podUuid == pod.UID {
-						if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
-							allocRequest := instaslice.Spec.PodAllocationRequests[podUuid]
-							err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &allocation, &allocRequest)
-							if err != nil {
-								return ctrl.Result{}, err
-							}
-							resultRemove, err := r.removeInstaSliceFinalizer(ctx, req)
-							if err != nil {
-								return resultRemove, err
-							}
-							r.CleanupOrphanedAllocations(ctx, &instasliceList)
-							// update DeployedPodTotal Metrics by setting value to 0 as pod allocation is deleted and pod is no loger consuming slices
-							r.UpdateDeployedPodTotalMetrics(string(allocation.Nodename), allocation.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, 0)
-							// update compatible profiles metrics
-							r.UpdateCompatibleProfilesMetrics(instaslice, instaslice.Name)
-						}
-						elapsed := time.Since(pod.DeletionTimestamp.Time)
-						if elapsed > 30*time.Second {
-							allocation.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
-							allocRequest := instaslice.Spec.PodAllocationRequests[podUuid]
-							if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &allocation, &allocRequest); err != nil {
-								log.Info("unable to set instaslice to state deleted for ", "pod", pod.Name)
-								return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
-							}
-						} else {
-							remainingTime := 30*time.Second - elapsed
-							return ctrl.Result{RequeueAfter: remainingTime}, nil
-						}
+			allocations := getPodAllocations(podInstaslices, pod.UID)
+			allDeleted := len(allocations) > 0
+			for _, allocation := range allocations {
+				if allocation.Result.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
+					allDeleted = false
+				}
+			}
+			if allDeleted {
+				for _, allocation := range allocations {
+					if err := r.releasePodAllocation(ctx, allocation); err != nil {
+						return ctrl.Result{}, err
 					}
 				}
+				return r.removeInstaSliceFinalizer(ctx, req)
+			}
+			remaining, err := r.teardownRemaining(ctx, pod, time.Now())
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			terminated := podContainersTerminated(pod)
+			for _, allocation := range allocations {
+				allocResult, allocRequest := allocation.Result, allocation.Request
+				if allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+					continue
+				}
+				// the pod is reconciled again when its containers terminate
+				if !terminated && remaining > 0 {
+					return ctrl.Result{RequeueAfter: remaining}, nil
+				}
+				allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+				if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, allocation.instasliceName, allocation.key, &allocResult, &allocRequest); err != nil {
+					log.Info("unable to set instaslice to state deleted for ", "pod", pod.Name)
+					return ctrl.Result{RequeueAfter: 1 * time.Second}, nil
+				}
 			}
 		}
 		// exit after handling deletion event for a pod.
 		return ctrl.Result{}, nil
 	}
 
-	// find allocation in the cluster for the pod
-	// set allocationstatus to creating when controller adds the allocation
-	// check for allocationstatus as created when daemonset is done realizing the slice on the GPU node.
+	// running pods using the slices of an unhealthy GPU are evicted when configured
+	if !isPodGated && r.evictOnUnhealthyGPU() {
+		return r.evictFromUnhealthyGPU(ctx, pod, podInstaslices)
+	}
+
+	// find allocations in the cluster for the slices of the pod
+	// set allocationstatus to creating when controller adds the allocations
+	// check for allocationstatus as created when daemonset is done realizing the slices on the GPU node.
 	// set allocationstatus to ungated and ungate the pod so that the workload can begin execution.
 	if isPodGated {
 		// return error if there are no containers in the pod
 		if len(pod.Spec.Containers) == 0 {
 			return ctrl.Result{}, fmt.Errorf(noContainerInsidePodErr+", pod: %v", pod.Name)
 		}
-		// Assume pod only has one container with one GPU requests
-		if len(pod.Spec.Containers) != 1 {
-			return ctrl.Result{}, fmt.Errorf(multipleContainersUnsupportedErr+", pod: %v", pod.Name)
+		// members of a pod group are allocated and ungated together
+		group, err := r.getPodGroup(ctx, pod)
+		if err != nil {
+			log.Error(err, "failed to get the pod group", "pod", pod.Name)
+			return ctrl.Result{}, err
 		}
-		limits := pod.Spec.Containers[0].Resources.Limits
-		profileName := r.extractProfileName(limits)
-		var podHasNodeAllocation bool
-		// search if pod has allocation in any of the instaslice object in the cluster
-		// TODO: allocations may get slower as the cluster size increases
-		for _, instaslice := range instasliceList.Items {
-			for uuid := range instaslice.Spec.PodAllocationRequests {
-				// no matter the state if allocations exists for a pod skip such a pod
-				if uuid == pod.UID {
-					podHasNodeAllocation = true
-				}
+		if group != nil {
+			instasliceList, err := r.listInstaslicesInSync(ctx)
+			if err != nil {
+				return ctrl.Result{}, err
 			}
+			return r.reconcilePodGroup(ctx, group, instasliceList)
 		}
-
-		for _, instaslice := range instasliceList.Items {
-			for uuid, allocations := range instaslice.Status.PodAllocationResults {
-				if allocations.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated && uuid == pod.UID {
-					allocations.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusUngated
-					allocRequest := instaslice.Spec.PodAllocationRequests[uuid]
-					if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &allocations, &allocRequest); err != nil {
-						return ctrl.Result{Requeue: true}, err
-					}
-					result, err := r.addNodeSelectorAndUngatePod(ctx, pod, &allocations)
-					if err != nil {
-						return result, err
-					}
-					break
+		slices, err := r.podSliceRequests(pod)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		// no matter the state if allocations exists for a pod skip such a pod
+		allocations := getPodAllocations(podInstaslices, pod.UID)
+		podHasNodeAllocation := len(allocations) > 0
+
+		// the pod is ungated once the daemonset has created the slices of all its containers,
+		// or when the InstaSlice object got updated with ungated status but the controller
+		// failed ungating the pod.
+		if podHasNodeAllocation && allocationsReadyToUngate(allocations) {
+			ungated := make(map[string]map[types.UID]utils.Allocation)
+			for _, allocation := range allocations {
+				if allocation.Result.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated {
+					continue
 				}
-				// InstaSlice object got updated with ungated status but the controller failed
-				// ungating the pod.
-				if allocations.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated && uuid == pod.UID {
-					result, err := r.addNodeSelectorAndUngatePod(ctx, pod, &allocations)
-					if err != nil {
-						return result, err
-					}
+				allocation.Result.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusUngated
+				if ungated[allocation.instasliceName] == nil {
+					ungated[allocation.instasliceName] = make(map[types.UID]utils.Allocation)
+				}
+				ungated[allocation.instasliceName][allocation.key] = allocation.Allocation
+			}
+			for instasliceName, instasliceAllocations := range ungated {
+				if err := utils.UpdateInstasliceAllocations(ctx, r.Client, instasliceName, instasliceAllocations); err != nil {
+					return ctrl.Result{Requeue: true}, err
 				}
 			}
+			created := make(map[types.UID]inferencev1alpha1.AllocationResult, len(allocations))
+			for _, allocation := range allocations {
+				created[allocation.key] = allocation.Result
+			}
+			r.reportSlicesStatus(ctx, pod, v1.ConditionTrue, v1.EventTypeNormal, ReasonSlicesCreated, "slices created: "+describeAllocations(created))
+			result, err := r.addNodeSelectorAndUngatePod(ctx, pod, &allocations[0].Result)
+			if err != nil {
+				return result, err
+			}
+			r.recordEvent(pod, v1.EventTypeNormal, ReasonUngated, fmt.Sprintf("scheduling gate removed, the pod runs on node %s", allocations[0].Result.Nodename))
+		}
+
+		// every Instaslice object is a candidate when the slices of the pod are allocated
+		instasliceList := &inferencev1alpha1.InstasliceList{Items: podInstaslices}
+		if !podHasNodeAllocation {
+			instasliceList, err = r.listInstaslicesInSync(ctx)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		for _, instaslice := range instasliceList.Items {
 			// Fetch latest Instaslice state before updating metrics
 			updatedInstaslice, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
 			if err != nil {
@@ -516,58 +529,216 @@ func (r *InstasliceReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			// update compatible profiles metrics
 			r.UpdateCompatibleProfilesMetrics(*updatedInstaslice, instaslice.Name)
 		}
-		// pod does not have an allocation yet, make allocation
-		// find the node
+		// pod does not have allocations yet, make allocations
 		if !podHasNodeAllocation {
-			sort.Slice(instasliceList.Items, func(i, j int) bool {
-				// Sort by Name in ascending order
-				return instasliceList.Items[i].Name < instasliceList.Items[j].Name
-			})
-			err := r.rebuildAllocationCache(ctx)
-			if err != nil {
-				return ctrl.Result{}, err
-			}
+			return r.allocatePod(ctx, pod, slices, instasliceList)
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+	return ctrl.Result{}, nil
+}
 
-			r.CleanupOrphanedAllocations(ctx, &instasliceList)
-			for _, instaslice := range instasliceList.Items {
-				// find the GPU on the node and the GPU index where the slice can be created
-				allocRequest, allocResult, err := r.findNodeAndDeviceForASlice(ctx, &instaslice, profileName, policy, pod)
-				if err != nil {
-					continue
-				}
-				podHasNodeAllocation = true
-				if podHasNodeAllocation {
-					err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, allocResult, allocRequest)
-					if err != nil {
-						return ctrl.Result{Requeue: true}, nil
-					}
-					// allocation was successful and hence update the cache with new allocation
-					r.updateCacheWithNewAllocation(allocRequest.PodRef.UID, *allocResult)
-					processedSlices, err := r.calculateProfileFitOnGPU(&instaslice, allocRequest.Profile, allocResult.GPUUUID, false, pod)
-					if err != nil {
-						log.Error(err, "failed to calculate processed GPU slices for profile %s: %w", allocRequest.Profile, err)
-					}
-					// update deployed pod total metrics
-					r.UpdateDeployedPodTotalMetrics(string(allocResult.Nodename), allocResult.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, processedSlices)
-					// update total processed GPU slices metrics
-					r.IncrementTotalProcessedGpuSliceMetrics(string(allocResult.Nodename), allocResult.GPUUUID, profileName, processedSlices)
-					return ctrl.Result{}, nil
-				}
-			}
+// podPlacement is what placing the slices of a pod decided while holding allocationMu, it is
+// carried out by allocatePod once the lock is released
+type podPlacement struct {
+	// instaslice and allocations are the slices reserved in the cache, to store on the object
+	instaslice  *inferencev1alpha1.Instaslice
+	allocations map[types.UID]utils.Allocation
+	// nominated reports whether the allocations are the ones nominated for the pod
+	nominated bool
+	// evict runs the evictions still pending for the nomination of the pod
+	evict bool
+	// queue adds the pod to the wait queue
+	queue bool
+	// eventType, reason and message report the slices condition of the pod, when reason is set
+	eventType string
+	reason    string
+	message   string
+	result    ctrl.Result
+	err       error
+}
+
+// allocatePod places the slices of the pod and reserves them on the Instaslice object of the
+// selected node. Only the placement is searched and reserved in the cache while holding
+// allocationMu, so that concurrent reconciles don't select the same slots. The cache is
+// refreshed before, the reservation is stored on the Instaslice object, pods are evicted and
+// the pod status is reported afterwards, so that concurrent reconciles place pods meanwhile.
+func (r *InstasliceReconciler) allocatePod(ctx context.Context, pod *v1.Pod, slices []sliceRequest, instasliceList *inferencev1alpha1.InstasliceList) (ctrl.Result, error) {
+	log := logr.FromContext(ctx)
+	if err := r.rebuildAllocationCache(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.CleanupOrphanedAllocations(ctx, instasliceList)
+	policy, err := r.allocationPolicyForPod(ctx, pod)
+	if err != nil {
+		log.Error(err, "failed to select the allocation policy", "pod", pod.Name)
+		return ctrl.Result{}, err
+	}
+
+	r.allocationMu.Lock()
+	placement := r.placePod(ctx, pod, slices, instasliceList, policy)
+	r.allocationMu.Unlock()
+
+	if placement.instaslice != nil {
+		return r.storePodAllocations(ctx, pod, placement)
+	}
+	if placement.evict {
+		// the pods a PodDisruptionBudget didn't allow to evict yet are evicted again
+		if err := r.evictForNomination(ctx, pod); err != nil {
+			log.Error(err, "eviction failed", "pod", pod.Name)
+			return ctrl.Result{RequeueAfter: Requeue5sDelay}, nil
 		}
+	}
+	if placement.reason != "" {
+		r.reportSlicesStatus(ctx, pod, v1.ConditionFalse, placement.eventType, placement.reason, placement.message)
+	}
+	if placement.queue {
+		r.queueWaitingPod(pod, slices)
+	}
+	return placement.result, placement.err
+}
 
-		// if the cluster does not have suitable node, requeue request
-		if !podHasNodeAllocation {
-			log.Info("no suitable node found in cluster for ", "pod", pod.Name)
-			// Generate a random duration between 1 and 10 seconds
-			randomDuration := time.Duration(rand.Intn(10)+1) * time.Second
-			return ctrl.Result{RequeueAfter: randomDuration}, nil
+// storePodAllocations stores the allocations reserved in the cache on the Instaslice object.
+// When another worker took the placement in the meantime the reservation is dropped and the
+// pod is placed again.
+func (r *InstasliceReconciler) storePodAllocations(ctx context.Context, pod *v1.Pod, placement podPlacement) (ctrl.Result, error) {
+	log := logr.FromContext(ctx)
+	err := utils.ReserveInstasliceAllocations(ctx, r.Client, placement.instaslice.Name, placement.allocations)
+	// the allocations leave reserving and enter the cache at once, so that a rebuild of the
+	// cache in between doesn't miss them
+	r.allocationMu.Lock()
+	for key := range placement.allocations {
+		delete(r.reserving, key)
+	}
+	if err != nil {
+		for key := range placement.allocations {
+			r.forgetCachedAllocation(key)
 		}
-		return ctrl.Result{Requeue: true}, nil
+		if stderrors.Is(err, utils.ErrPlacementTaken) {
+			// the cache missed an allocation, rebuild it from the Instaslice objects
+			r.isCacheInitialized = false
+		}
+		r.allocationMu.Unlock()
+		log.Info("failed to reserve the slices, placing them again", "pod", pod.Name, "reason", err.Error())
+		return ctrl.Result{RequeueAfter: Requeue1sDelay}, nil
 	}
+	if placement.nominated {
+		delete(r.nominations, pod.UID)
+	}
+	r.recordNewAllocations(placement.allocations)
+	r.allocationMu.Unlock()
+	r.waitQueue.remove(client.ObjectKeyFromObject(pod))
+	allocated := make(map[types.UID]inferencev1alpha1.AllocationResult, len(placement.allocations))
+	for key, allocation := range placement.allocations {
+		allocated[key] = allocation.Result
+	}
+	r.reportSlicesStatus(ctx, pod, v1.ConditionFalse, v1.EventTypeNormal, ReasonAllocated, "slices allocated, waiting for the daemonset to create them: "+describeAllocations(allocated))
 	return ctrl.Result{}, nil
 }
 
+// placePod finds the node, the GPUs on the node and the GPU indexes where the slices of the pod
+// can be created and reserves them in the cache. When nothing is to be stored, the placement
+// tells which pods to evict, what to report and what the reconcile returns. Pods are only
+// nominated for preemption or defragmentation here, they are evicted by the caller. The caller
+// holds allocationMu.
+func (r *InstasliceReconciler) placePod(ctx context.Context, pod *v1.Pod, slices []sliceRequest, instasliceList *inferencev1alpha1.InstasliceList, policy AllocationPolicy) podPlacement {
+	log := logr.FromContext(ctx)
+	sort.Slice(instasliceList.Items, func(i, j int) bool {
+		// Sort by Name in ascending order
+		return instasliceList.Items[i].Name < instasliceList.Items[j].Name
+	})
+	// the cache was invalidated since it was rebuilt
+	if !r.isCacheInitialized {
+		return podPlacement{result: ctrl.Result{RequeueAfter: Requeue1sDelay}}
+	}
+	// a slice recycled for the pod is being stored
+	if len(slices) > 0 {
+		if _, ok := r.reserving[allocationKey(pod.UID, 0, slices[0])]; ok {
+			return podPlacement{result: ctrl.Result{RequeueAfter: Requeue1sDelay}}
+		}
+	}
+	// the slices freed by preemption are kept for the preemptor
+	if nominated, ok := r.nominations[pod.UID]; ok {
+		instaslice, free, err := r.nominatedPlacementFree(ctx, nominated)
+		if err != nil {
+			return podPlacement{result: ctrl.Result{Requeue: true}}
+		}
+		if !free {
+			log.Info("waiting for preempted pods to release their slices", "pod", pod.Name)
+			return podPlacement{
+				evict:     true,
+				eventType: v1.EventTypeNormal,
+				reason:    ReasonWaitingForCapacity,
+				message:   "waiting for preempted pods to release their slices",
+				result:    ctrl.Result{RequeueAfter: Requeue2sDelay},
+			}
+		}
+		r.reserveInCache(nominated.allocations)
+		return podPlacement{instaslice: instaslice, allocations: nominated.allocations, nominated: true}
+	}
+	// gated pods woken by freed capacity are allocated by priority
+	r.waitQueue.reconciled(client.ObjectKeyFromObject(pod))
+	if r.waitQueue.higherPriorityWoken(client.ObjectKeyFromObject(pod), podPriority(pod)) {
+		log.Info("a pod of higher priority is allocated first", "pod", pod.Name)
+		return podPlacement{
+			eventType: v1.EventTypeNormal,
+			reason:    ReasonWaitingForCapacity,
+			message:   "a pod of higher priority is allocated first",
+			result:    ctrl.Result{RequeueAfter: Requeue2sDelay},
+		}
+	}
+	instaslice, newAllocations, err := r.findNodeAndDeviceForPod(ctx, instasliceList.Items, slices, policy, pod)
+	if err == nil {
+		// reserve the slots before releasing the lock
+		r.reserveInCache(newAllocations)
+		return podPlacement{instaslice: instaslice, allocations: newAllocations}
+	}
+	if r.Config != nil && r.Config.PreemptionEnable {
+		preempted, err := r.preemptForPod(ctx, instasliceList.Items, slices, policy, pod)
+		if err != nil {
+			log.Error(err, "preemption failed", "pod", pod.Name)
+			return podPlacement{result: ctrl.Result{RequeueAfter: Requeue5sDelay}}
+		}
+		if preempted {
+			return podPlacement{
+				evict:     true,
+				eventType: v1.EventTypeNormal,
+				reason:    ReasonWaitingForCapacity,
+				message:   "preempting pods of lower priority",
+				result:    ctrl.Result{RequeueAfter: Requeue2sDelay},
+			}
+		}
+	}
+	defragmented, err := r.defragmentForPod(ctx, instasliceList.Items, slices, policy, pod)
+	if err != nil {
+		log.Error(err, "defragmentation failed", "pod", pod.Name)
+		return podPlacement{result: ctrl.Result{RequeueAfter: Requeue5sDelay}}
+	}
+	if defragmented {
+		return podPlacement{
+			evict:     true,
+			eventType: v1.EventTypeNormal,
+			reason:    ReasonWaitingForCapacity,
+			message:   "moving restartable pods to open a placement",
+			result:    ctrl.Result{RequeueAfter: Requeue2sDelay},
+		}
+	}
+
+	// if the cluster does not have suitable node, wait until capacity is freed for the pod
+	log.Info("no suitable node found in cluster for ", "pod", pod.Name)
+	reason, message := r.explainNoPlacement(instasliceList.Items, slices, pod)
+	if r.defragUnsupported(slices) {
+		message += "; " + defragUnsupportedMessage
+	}
+	return podPlacement{
+		queue:     true,
+		eventType: v1.EventTypeWarning,
+		reason:    reason,
+		message:   message,
+		result:    ctrl.Result{RequeueAfter: r.waitQueueResyncInterval()},
+	}
+}
+
 // Initialize Prometheus-compatible profiles metrics when the controller starts
 // Adds a background goroutine that waits for Instaslice objects.
 // Proceeds to setupWithManager(mgr) to start the reconciler
@@ -659,10 +830,67 @@ func (r *InstasliceReconciler) setupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 
+	// allocations of a pod are looked up by pod UID instead of scanning every Instaslice
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs); err != nil {
+		return err
+	}
+
+	// the cache is invalidated when the node resources of an Instaslice change underneath it
+	instasliceInformer, err := mgr.GetCache().GetInformer(context.Background(), &inferencev1alpha1.Instaslice{})
+	if err != nil {
+		return err
+	}
+	if _, err := instasliceInformer.AddEventHandler(r.instasliceEventHandler()); err != nil {
+		return err
+	}
+	// the cache is invalidated when a node goes down or comes back
+	nodeInformer, err := mgr.GetCache().GetInformer(context.Background(), &v1.Node{})
+	if err != nil {
+		return err
+	}
+	if _, err := nodeInformer.AddEventHandler(r.nodeEventHandler()); err != nil {
+		return err
+	}
+	// waiting pods are woken when slots are freed or GPUs discovered, and when classical
+	// resources are freed on a node
+	if _, err := instasliceInformer.AddEventHandler(r.waitQueueEventHandler()); err != nil {
+		return err
+	}
+	// pods using the slices of GPUs marked unhealthy are reconciled to be evicted
+	if r.evictOnUnhealthyGPU() {
+		if _, err := instasliceInformer.AddEventHandler(r.gpuHealthEventHandler()); err != nil {
+			return err
+		}
+	}
+	if r.ResourceCache != nil {
+		r.ResourceCache.OnCapacityFreed(r.wakePodsForNode)
+	}
+
+	// the cache is rebuilt once leadership is acquired, then checked periodically
+	if err := mgr.Add(manager.RunnableFunc(r.runAllocationCacheCheck)); err != nil {
+		return err
+	}
+
+	// allocations the daemonset doesn't complete are retried or marked failed by the leader
+	if err := mgr.Add(manager.RunnableFunc(r.runAllocationWatchdog)); err != nil {
+		return err
+	}
+
+	// allocations of pods deleted without being reconciled are collected by the leader
+	if err := mgr.Add(manager.RunnableFunc(r.runOrphanSweeper)); err != nil {
+		return err
+	}
+
+	maxConcurrentReconciles := config.DefaultMaxConcurrentReconciles
+	if r.Config != nil && r.Config.MaxConcurrentReconciles > 0 {
+		maxConcurrentReconciles = r.Config.MaxConcurrentReconciles
+	}
 	instaslicePredicate := NewInstaslicePredicate()
 	err = ctrl.NewControllerManagedBy(mgr).
 		For(&v1.Pod{}).Named("InstaSlice-controller").
+		WithOptions(ctrlcontroller.Options{MaxConcurrentReconciles: maxConcurrentReconciles}).
 		Watches(&inferencev1alpha1.Instaslice{}, handler.EnqueueRequestsFromMapFunc(r.podMapFunc)).
+		WatchesRawSource(source.Channel(r.waitQueue.channel(), &handler.EnqueueRequestForObject{})).
 		WithEventFilter(instaslicePredicate).
 		Complete(r)
 	if err != nil {
@@ -831,6 +1059,43 @@ func (r *InstasliceReconciler) createInstaSliceDaemonSet(namespace string) *apps
 									Name:  "EMULATOR_MODE",
 									Value: fmt.Sprintf("%v", emulatorMode),
 								},
+								{
+									Name:  "DRIFT_CHECK_INTERVAL",
+									Value: r.Config.DriftCheckInterval.String(),
+								},
+								{
+									Name:  "DRIFT_POLICY",
+									Value: r.Config.DriftPolicy,
+								},
+								{
+									Name:  "CRITICAL_XIDS",
+									Value: r.Config.CriticalXIDs,
+								},
+								{
+									Name:  "GPU_RECOVERY_PERIOD",
+									Value: r.Config.GPURecoveryPeriod.String(),
+								},
+								{
+									Name:  "ENABLE_MIG_GPUS",
+									Value: r.Config.EnableMigGPUs,
+								},
+							},
+							// the pods using the slices adopted at startup are listed by the kubelet
+							VolumeMounts: []v1.VolumeMount{
+								{
+									Name:      podResourcesVolumeName,
+									MountPath: kubeletPodResourcesDir,
+								},
+							},
+						},
+					},
+					Volumes: []v1.Volume{
+						{
+							Name: podResourcesVolumeName,
+							VolumeSource: v1.VolumeSource{
+								HostPath: &v1.HostPathVolumeSource{
+									Path: kubeletPodResourcesDir,
+								},
 							},
 						},
 					},
@@ -857,6 +1122,16 @@ func (*InstasliceReconciler) extractProfileName(limits v1.ResourceList) string {
 	return profileName
 }
 
+// extractProfileQuantity returns the number of slices of the MIG profile requested in the limits
+func (*InstasliceReconciler) extractProfileQuantity(limits v1.ResourceList) int {
+	for k, quantity := range limits {
+		if strings.Contains(k.String(), "mig-") {
+			return int(quantity.Value())
+		}
+	}
+	return 0
+}
+
 // Extract NVML specific attributes for GPUs, this will change for different generations of the GPU.
 func (*InstasliceReconciler) extractGpuProfile(instaslice *inferencev1alpha1.Instaslice, profileName string) (int32, int32, int32, int32) {
 	var size int32
@@ -910,6 +1185,9 @@ func (r *InstasliceReconciler) podMapFunc(ctx context.Context, obj client.Object
 	instaslice, ok := obj.(*inferencev1alpha1.Instaslice)
 	if ok {
 		for uuidAllocResult, allocationResult := range instaslice.Status.PodAllocationResults {
+			if allocationAdopted(allocationResult) {
+				continue
+			}
 			if allocationResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusCreated || allocationResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
 				for uuidAllocRequest, allocationRequest := range instaslice.Spec.PodAllocationRequests {
 					if uuidAllocRequest == uuidAllocResult {
@@ -956,61 +1234,118 @@ func (r *InstasliceReconciler) removeInstaSliceFinalizer(ctx context.Context, re
 	return ctrl.Result{}, nil
 }
 
-// Policy based allocation - FirstFit
-func (r *FirstFitPolicy) SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName,
-	allocationStatus inferencev1alpha1.AllocationStatus, discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32,
-	namespace string, podName string, gpuUuid string, resourceIdentifier types.UID) (*inferencev1alpha1.AllocationRequest, *inferencev1alpha1.AllocationResult) {
-	return &inferencev1alpha1.AllocationRequest{
-			Profile: profileName,
-			PodRef: v1.ObjectReference{
-				Kind:      "Pod",
-				Namespace: namespace,
-				Name:      podName,
-				UID:       podUUID,
-			},
-		}, &inferencev1alpha1.AllocationResult{
-			MigPlacement: inferencev1alpha1.Placement{
-				Size:  size,
-				Start: newStart,
-			},
-			GPUUUID:                     gpuUuid,
-			Nodename:                    nodename,
-			AllocationStatus:            allocationStatus,
-			ConfigMapResourceIdentifier: resourceIdentifier,
-			Conditions:                  []metav1.Condition{},
+func (r *InstasliceReconciler) removeInstasliceAllocation(ctx context.Context, instasliceName string, allocation *inferencev1alpha1.AllocationResult) error {
+	if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+		err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instasliceName, "", nil, nil)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
 }
 
-// Policy based allocation - LeftToRIght
-func (l *LeftToRightPolicy) SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName,
-	allocationStatus inferencev1alpha1.AllocationStatus, discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32,
-	namespace string, podName string, gpuUuid string, resourceIdentifier types.UID) *inferencev1alpha1.AllocationRequest {
-	// Implement the left-to-right policy here
-	return &inferencev1alpha1.AllocationRequest{}
+// releasePodAllocation removes an allocation deleted by the daemonset and resets its metrics
+func (r *InstasliceReconciler) releasePodAllocation(ctx context.Context, allocation podAllocation) error {
+	if err := r.removeInstasliceAllocation(ctx, allocation.instasliceName, &allocation.Result); err != nil {
+		return err
+	}
+	r.allocationMu.Lock()
+	r.forgetCachedAllocation(allocation.key)
+	delete(r.stuckPods, allocation.Request.PodRef.UID)
+	r.allocationMu.Unlock()
+	r.recordPodRefEvent(allocation.Request.PodRef, v1.EventTypeNormal, ReasonSlicesReleased, "slice released: "+describeAllocations(map[types.UID]inferencev1alpha1.AllocationResult{allocation.key: allocation.Result}))
+	// update DeployedPodTotal Metrics by setting value to 0 as pod allocation is deleted and pod is no loger consuming slices
+	r.UpdateDeployedPodTotalMetrics(string(allocation.Result.Nodename), allocation.Result.GPUUUID, allocation.Request.PodRef.Namespace, allocation.Request.PodRef.Name, allocation.Request.Profile, 0)
+	// update compatible profiles metrics
+	instaslice, err := r.getInstasliceObject(ctx, allocation.instasliceName, InstaSliceOperatorNamespace)
+	if err != nil {
+		return err
+	}
+	r.UpdateCompatibleProfilesMetrics(*instaslice, instaslice.Name)
+	return nil
 }
 
-// Policy based allocation - RigghToLeft
-func (l *RightToLeftPolicy) SetAllocationDetails(profileName string, newStart, size int32, podUUID types.UID, nodename types.NodeName,
-	allocationStatus inferencev1alpha1.AllocationStatus, discoveredGiprofile int32, Ciprofileid int32, Ciengprofileid int32,
-	namespace string, podName string, gpuUuid string, resourceIdentifier types.UID) *inferencev1alpha1.AllocationRequest {
-	// Implement the left-to-right policy here
-	return &inferencev1alpha1.AllocationRequest{}
+// listInstaslicesInSync lists the Instaslice objects in sync with their node, the nodes that
+// aren't in sync yet aren't candidates for new allocations.
+func (r *InstasliceReconciler) listInstaslicesInSync(ctx context.Context) (*inferencev1alpha1.InstasliceList, error) {
+	var instasliceList inferencev1alpha1.InstasliceList
+	if err := r.List(ctx, &instasliceList, &client.ListOptions{}); err != nil {
+		logr.FromContext(ctx).Error(err, "Error getting Instaslice object")
+		return nil, err
+	}
+	instasliceList.Items = r.instaslicesInSync(ctx, instasliceList.Items)
+	return &instasliceList, nil
 }
 
-func (r *InstasliceReconciler) removeInstasliceAllocation(ctx context.Context, instasliceName string, allocation *inferencev1alpha1.AllocationResult) error {
-	if allocation.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
-		err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instasliceName, nil, nil)
-		if err != nil {
-			return err
+// instaslicesInSync returns the Instaslice objects whose daemonset discovered the GPUs of the
+// node since it last booted.
+func (r *InstasliceReconciler) instaslicesInSync(ctx context.Context, instaslices []inferencev1alpha1.Instaslice) []inferencev1alpha1.Instaslice {
+	log := logr.FromContext(ctx)
+	inSync := make([]inferencev1alpha1.Instaslice, 0, len(instaslices))
+	for _, instaslice := range instaslices {
+		// Get the node object on which the instaslice object is present
+		node := &v1.Node{}
+		if err := r.Get(ctx, client.ObjectKey{Name: instaslice.Name}, node); err != nil {
+			log.Error(err, "error getting the node object", "name", instaslice.Name)
+			continue
 		}
+
+		if instaslice.Status.NodeResources.BootID == "" {
+			log.Info("Instaslice boot ID not yet populated, skipping the node", "node", node.Name)
+			continue
+		}
+
+		if instaslice.Status.NodeResources.BootID != node.Status.NodeInfo.BootID {
+			log.Info("instaslice not in sync with the node as the boot id doesn't match, skipping the node", "node", node.Name, "node's boot id", node.Status.NodeInfo.BootID, "instaslice's boot id", instaslice.Status.NodeResources.BootID)
+			continue
+		}
+		inSync = append(inSync, instaslice)
+	}
+	return inSync
+}
+
+// allocationsReadyToUngate reports whether the daemonset has created the slices of all the
+// allocations, or the allocations were already set to ungated.
+func allocationsReadyToUngate(allocations []podAllocation) bool {
+	for _, allocation := range allocations {
+		status := allocation.Result.AllocationStatus
+		if status.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusCreated && status.AllocationStatusController != inferencev1alpha1.AllocationStatusUngated {
+			return false
+		}
+	}
+	return true
+}
+
+// recordNewAllocations adds the stored allocations to the cache and updates the metrics
+func (r *InstasliceReconciler) recordNewAllocations(allocations map[types.UID]utils.Allocation) {
+	for key, allocation := range allocations {
+		allocRequest, allocResult := allocation.Request, allocation.Result
+		// allocation was successful and hence update the cache with new allocation
+		r.updateCacheWithNewAllocation(key, allocResult)
+		processedSlices := allocResult.MigPlacement.Size
+		// update deployed pod total metrics
+		r.UpdateDeployedPodTotalMetrics(string(allocResult.Nodename), allocResult.GPUUUID, allocRequest.PodRef.Namespace, allocRequest.PodRef.Name, allocRequest.Profile, processedSlices)
+		// update total processed GPU slices metrics
+		r.IncrementTotalProcessedGpuSliceMetrics(string(allocResult.Nodename), allocResult.GPUUUID, allocRequest.Profile, processedSlices)
+	}
+}
+
+// reserveInCache places the allocations in the cache and keeps them as reserving until they are
+// stored on the Instaslice object, the caller holds allocationMu
+func (r *InstasliceReconciler) reserveInCache(allocations map[types.UID]utils.Allocation) {
+	if r.reserving == nil {
+		r.reserving = make(map[types.UID]inferencev1alpha1.AllocationResult)
+	}
+	for key, allocation := range allocations {
+		r.updateCacheWithNewAllocation(key, allocation.Result)
+		r.reserving[key] = allocation.Result
 	}
-	return nil
 }
 
-func (r *InstasliceReconciler) setInstasliceAllocationToDeleting(ctx context.Context, instasliceName string, allocResult *inferencev1alpha1.AllocationResult, allocRequest *inferencev1alpha1.AllocationRequest) (ctrl.Result, error) {
+func (r *InstasliceReconciler) setInstasliceAllocationToDeleting(ctx context.Context, instasliceName string, key types.UID, allocResult *inferencev1alpha1.AllocationResult, allocRequest *inferencev1alpha1.AllocationRequest) (ctrl.Result, error) {
 	log := logr.FromContext(ctx)
 	allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
-	if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instasliceName, allocResult, allocRequest); err != nil {
+	if err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instasliceName, key, allocResult, allocRequest); err != nil {
 		log.Info("unable to set instaslice to state ", "state", allocResult.AllocationStatus.AllocationStatusController, "pod", allocRequest.PodRef.Name)
 		return ctrl.Result{Requeue: true}, err
 	}
@@ -352,6 +352,7 @@ func TestChangesAllocationDeletionAndFinalizer(t *testing.T) {
 			fakeClient = fake.NewClientBuilder().
 				WithScheme(scheme).
 				WithStatusSubresource(&inferencev1alpha1.Instaslice{}).
+				WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).
 				Build()
 			config := config.ConfigFromEnvironment()
 
@@ -424,7 +425,7 @@ func TestChangesAllocationDeletionAndFinalizer(t *testing.T) {
 
 			allocationResult := instaslice.Status.PodAllocationResults[pod.GetUID()]
 			allocationRequest := instaslice.Spec.PodAllocationRequests[pod.GetUID()]
-			err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, &allocationResult, &allocationRequest)
+			err := utils.UpdateOrDeleteInstasliceAllocations(ctx, r.Client, instaslice.Name, allocationRequest.PodRef.UID, &allocationResult, &allocationRequest)
 			Expect(err).NotTo(HaveOccurred())
 
 			updatedInstaSlice := &inferencev1alpha1.Instaslice{}
@@ -462,7 +463,7 @@ func TestChangesAllocationDeletionAndFinalizer(t *testing.T) {
 		It("should set allocation status to Deleting if status is not Deleted", func() {
 			allocationResult := instaslice.Status.PodAllocationResults[pod.GetUID()]
 			allocationRequest := instaslice.Spec.PodAllocationRequests[pod.GetUID()]
-			result, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, &allocationResult, &allocationRequest)
+			result, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, pod.GetUID(), &allocationResult, &allocationRequest)
 
 			Expect(err).NotTo(HaveOccurred())
 
@@ -478,7 +479,7 @@ func TestChangesAllocationDeletionAndFinalizer(t *testing.T) {
 			r.Client = fake.NewClientBuilder().WithScheme(runtime.NewScheme()).Build()
 			allocationResult := instaslice.Status.PodAllocationResults[pod.GetUID()]
 			allocationRequest := instaslice.Spec.PodAllocationRequests[pod.GetUID()]
-			result, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, &allocationResult, &allocationRequest)
+			result, err := r.setInstasliceAllocationToDeleting(ctx, instaslice.Name, pod.GetUID(), &allocationResult, &allocationRequest)
 
 			Expect(err).To(HaveOccurred())
 			Expect(result.Requeue).To(BeTrue())
@@ -509,6 +510,7 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 			fakeClient = fake.NewClientBuilder().
 				WithScheme(scheme).
 				WithStatusSubresource(&inferencev1alpha1.Instaslice{}).
+				WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).
 				Build()
 
 			config := config.ConfigFromEnvironment()
@@ -754,8 +756,8 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 			Expect(newPod.Finalizers).ToNot(ContainElement(FinalizerName))
 		})
 
-		It("should return from reconcile when more than 1 container is present in a pod", func() {
-			// Define a pod with more than a container
+		It("should return an error when a container requesting a slice has no configmap", func() {
+			// Define a pod with a container requesting a slice without the configmap of the webhook
 			pod = &v1.Pod{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "test-pod-1",
@@ -769,7 +771,15 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 				},
 				Spec: v1.PodSpec{
 					SchedulingGates: append(pod.Spec.SchedulingGates, v1.PodSchedulingGate{Name: GateName}),
-					Containers:      []v1.Container{{Name: "test-container-1"}, {Name: "test-container-2"}},
+					Containers: []v1.Container{
+						{Name: "test-container-1"},
+						{
+							Name: "test-container-2",
+							Resources: v1.ResourceRequirements{
+								Limits: v1.ResourceList{"instaslice.redhat.com/mig-1g.5gb": resource.MustParse("1")},
+							},
+						},
+					},
 				},
 				Status: v1.PodStatus{Phase: v1.PodPending, Conditions: []v1.PodCondition{{Message: "blocked"}}},
 			}
@@ -778,7 +788,7 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 			req.Name = pod.Name
 			result, err := r.Reconcile(ctx, req)
 			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring(multipleContainersUnsupportedErr))
+			Expect(err.Error()).To(ContainSubstring("no configmap injected in container test-container-2"))
 			Expect(result).To(Equal(ctrl.Result{}))
 		})
 
@@ -857,7 +867,7 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 
 			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
 				pod, daemonSet, daemonSetPod, node, instaslice,
-			).Build()
+			).WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).Build()
 
 			r := &InstasliceReconciler{Client: cl, Config: config.ConfigFromEnvironment()}
 
@@ -952,6 +962,7 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 				WithScheme(scheme).
 				WithObjects(pod, node, instaslice).
 				WithStatusSubresource(&inferencev1alpha1.Instaslice{}).
+				WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).
 				Build()
 
 			r := &InstasliceReconciler{Client: cl, Config: config.ConfigFromEnvironment()}
@@ -1034,7 +1045,7 @@ func TestInstasliceReconciler_Reconcile(t *testing.T) {
 				},
 			}
 
-			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pod, node, instaslice).Build()
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pod, node, instaslice).WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).Build()
 
 			cache := cache.NewResourceCache()
 
@@ -1314,8 +1325,10 @@ func TestGetStartIndexFromPreparedState(t *testing.T) {
 					},
 				},
 			}
-			gpuAllocatedIndex := [8]int32{1, 0, 0, 0, 0, 0, 0, 0}
-			Expect((&InstasliceReconciler{}).getStartIndexFromAllocationResults(instaslice, "2g.10gb", gpuAllocatedIndex, nil, true)).To(Equal(int32(1)))
+			slots := slotMap{true, false, false, false, false, false, false, false}
+			start, ok := (&InstasliceReconciler{}).getStartIndexFromAllocationResults(instaslice, "2g.10gb", slots, nil, true)
+			Expect(ok).To(BeTrue())
+			Expect(start).To(Equal(int32(1)))
 		})
 	})
 }
@@ -1422,7 +1435,7 @@ func TestGetTotalFitForProfileOnGPU(t *testing.T) {
 				expectedFit: 0,
 			},
 			{
-				name: "Special case: 7g.40gb with exact fit",
+				name: "Any placement size: 7g.40gb with exact fit",
 				instasliceObj: &inferencev1alpha1.Instaslice{
 					Status: inferencev1alpha1.InstasliceStatus{
 						NodeResources: inferencev1alpha1.DiscoveredNodeResources{
@@ -1436,7 +1449,7 @@ func TestGetTotalFitForProfileOnGPU(t *testing.T) {
 				},
 				profileName: "7g.40gb",
 				remaining:   7,
-				expectedFit: 0,
+				expectedFit: 1,
 			},
 			{
 				name: "Regular profile fitting multiple times",
@@ -24,43 +24,38 @@ import (
 // calculateProfileFitOnGPU handles both profile simulation fit and actual allocation size
 // simulate - `true` → simulate fits | `false` → check actual allocation
 func (r *InstasliceReconciler) calculateProfileFitOnGPU(instaslice *inferencev1alpha1.Instaslice, profileName, gpuUUID string, simulate bool, pod *v1.Pod) (int32, error) {
-	// Get the GPU allocation state (already allocated slices)
-	originalAllocatedIndex := r.gpuAllocatedSlices(gpuUUID)
-	// Create a copy of the allocated slots (fixed-size array)
-	var gpuAllocatedIndex [8]int32
-	copy(gpuAllocatedIndex[:], originalAllocatedIndex[:]) // Ensure we don’t modify real allocations
 	// Determine the required slice size for this profile
-	var neededContinuousSlot int32
 	placement, exists := instaslice.Status.NodeResources.MigPlacement[profileName]
 	if !exists || len(placement.Placements) == 0 {
 		return 0, fmt.Errorf("profile %s not found in MigPlacement", profileName)
 	}
-	neededContinuousSlot = placement.Placements[0].Size
-	// If we're checking actual allocation, count and return immediately
+	neededContinuousSlot := placement.Placements[0].Size
+	if neededContinuousSlot <= 0 {
+		return 0, fmt.Errorf("profile %s has an invalid placement size %d", profileName, neededContinuousSlot)
+	}
+	// Get the GPU allocation state (already allocated slices), this is a copy
+	// so the simulation below doesn't modify real allocations
+	slots := r.gpuSlotMap(instaslice, gpuUUID)
+	// If we're checking actual allocation, return the size of the placement
 	if !simulate {
-		actualSliceSize := int32(0)
-		startIdx := r.getStartIndexFromAllocationResults(instaslice, profileName, gpuAllocatedIndex, &pod.UID, false)
-		for i := int32(0); i < neededContinuousSlot; i++ {
-			if startIdx+i < int32(len(originalAllocatedIndex)-1) {
-				actualSliceSize++
-			}
+		if _, ok := r.getStartIndexFromAllocationResults(instaslice, profileName, slots, &pod.UID, false); !ok {
+			return 0, nil
+		}
+		if allocResult, exists := r.allocationCache[pod.UID]; exists {
+			return allocResult.MigPlacement.Size, nil
 		}
-		return actualSliceSize, nil // Return the **actual** allocated slice count
+		return neededContinuousSlot, nil // Return the **actual** allocated slice count
 	}
 	// If we are simulating, count how many times the profile **could fit**
 	fitCount := int32(0)
-	for i := 0; i < len(originalAllocatedIndex); i++ {
-		startIdx := r.getStartIndexFromAllocationResults(instaslice, profileName, gpuAllocatedIndex, nil, true)
+	for {
+		startIdx, ok := r.getStartIndexFromAllocationResults(instaslice, profileName, slots, nil, true)
 		// If no valid placement found, break the loop
-		if startIdx == 9 {
+		if !ok {
 			break
 		}
 		// Simulate allocation by marking the slots
-		for i := int32(0); i < neededContinuousSlot; i++ {
-			if startIdx+i < int32(len(gpuAllocatedIndex)) {
-				gpuAllocatedIndex[startIdx+i] = 1
-			}
-		}
+		slots.occupy(inferencev1alpha1.Placement{Start: startIdx, Size: neededContinuousSlot})
 		fitCount++ // one successful fit
 	}
 	return fitCount, nil // total hypothetical fits
@@ -0,0 +1,164 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Allocations are released by the reconciles of their pod. The sweeper collects the ones
+// whose pod is gone without being reconciled, e.g. force deleted, deleted with its namespace
+// or while the controller was down: they are set to deleting so that the daemonset deletes
+// their slices and configmaps, then released once the daemonset deleted them.
+
+func (r *InstasliceReconciler) orphanSweepInterval() time.Duration {
+	if r.Config != nil && r.Config.OrphanSweepInterval > 0 {
+		return r.Config.OrphanSweepInterval
+	}
+	return config.DefaultOrphanSweepInterval
+}
+
+// apiReader returns the reader of the pods checked by the sweeper, the API server when set
+func (r *InstasliceReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// runOrphanSweeper sweeps the orphaned allocations until the context is done
+func (r *InstasliceReconciler) runOrphanSweeper(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.sweepOrphanedAllocations(ctx); err != nil {
+			logr.FromContext(ctx).Error(err, "failed to sweep orphaned allocations")
+		}
+	}, r.orphanSweepInterval())
+	return nil
+}
+
+// sweepOrphanedAllocations sets the allocations whose pod no longer exists to deleting and
+// releases the ones the daemonset deleted. The requests a reservation left without results
+// are withdrawn, allocations still being reserved are skipped.
+func (r *InstasliceReconciler) sweepOrphanedAllocations(ctx context.Context) error {
+	log := logr.FromContext(ctx)
+	var instasliceList inferencev1alpha1.InstasliceList
+	if err := r.List(ctx, &instasliceList); err != nil {
+		return err
+	}
+	pods := make(map[types.UID]bool)
+	for _, instaslice := range instasliceList.Items {
+		var orphaned, unreserved []types.UID
+		var deleted []podAllocation
+		for key, allocRequest := range instaslice.Spec.PodAllocationRequests {
+			if r.isReserving(key) {
+				continue
+			}
+			allocResult, ok := instaslice.Status.PodAllocationResults[key]
+			// the reservation of the request didn't complete
+			if !ok {
+				unreserved = append(unreserved, key)
+				continue
+			}
+			// the pods of adopted allocations aren't managed, their slices outlive them
+			if allocationAdopted(allocResult) {
+				continue
+			}
+			exists, err := r.podExists(ctx, allocRequest.PodRef, pods)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			if allocResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+				deleted = append(deleted, podAllocation{
+					instasliceName: instaslice.Name,
+					key:            key,
+					Allocation:     utils.Allocation{Request: allocRequest, Result: allocResult},
+				})
+				continue
+			}
+			if allocResult.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusDeleting {
+				orphaned = append(orphaned, key)
+			}
+		}
+		if len(unreserved) > 0 {
+			sort.Slice(unreserved, func(i, j int) bool { return unreserved[i] < unreserved[j] })
+			if err := utils.WithdrawUnreservedRequests(ctx, r.Client, instaslice.Name, unreserved); err != nil {
+				return err
+			}
+			log.Info("requests left without results withdrawn", "instaslice", instaslice.Name, "keys", unreserved)
+		}
+		sort.Slice(orphaned, func(i, j int) bool { return orphaned[i] < orphaned[j] })
+		patched, err := r.updateAllocationResults(ctx, instaslice.Name, orphaned, func(_ types.UID, allocResult *inferencev1alpha1.AllocationResult) bool {
+			status := &allocResult.AllocationStatus
+			if status.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting || status.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+				return false
+			}
+			status.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if patched {
+			log.Info("allocations of deleted pods set to deleting", "instaslice", instaslice.Name, "keys", orphaned)
+		}
+		for _, allocation := range deleted {
+			if err := r.releasePodAllocation(ctx, allocation); err != nil {
+				return err
+			}
+			log.Info("allocation of deleted pod released", "instaslice", instaslice.Name, "pod", allocation.Request.PodRef.Name, "key", allocation.key)
+		}
+	}
+	return nil
+}
+
+// isReserving reports whether the allocation is placed in the cache and being reserved
+func (r *InstasliceReconciler) isReserving(key types.UID) bool {
+	r.allocationMu.Lock()
+	defer r.allocationMu.Unlock()
+	_, ok := r.reserving[key]
+	return ok
+}
+
+// podExists reports whether the pod of the reference still exists, a pod recreated with the
+// same name is another pod. Answers are kept by pod UID for the sweep.
+func (r *InstasliceReconciler) podExists(ctx context.Context, podRef v1.ObjectReference, pods map[types.UID]bool) (bool, error) {
+	if exists, ok := pods[podRef.UID]; ok {
+		return exists, nil
+	}
+	var pod v1.Pod
+	err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: podRef.Namespace, Name: podRef.Name}, &pod)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return false, err
+	}
+	exists := err == nil && pod.UID == podRef.UID
+	pods[podRef.UID] = exists
+	return exists, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+func TestSweepOrphanedAllocations(t *testing.T) {
+	running := newPriorityPod("running", 0, "1g.5gb", false)
+	forceDeleted := newPriorityPod("force-deleted", 0, "1g.5gb", false)
+	withdrawn := newPriorityPod("withdrawn", 0, "1g.5gb", false)
+	reserving := newPriorityPod("reserving", 0, "1g.5gb", true)
+	recreated := newPriorityPod("recreated", 0, "1g.5gb", false)
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withRunningSlice(instaslice, running, "gpu-a", 0)
+	withRunningSlice(instaslice, forceDeleted, "gpu-a", 1)
+	withRunningSlice(instaslice, withdrawn, "gpu-a", 2)
+	withRunningSlice(instaslice, reserving, "gpu-a", 3)
+	withRunningSlice(instaslice, recreated, "gpu-a", 4)
+	withStatus(instaslice, withdrawn.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusDeleted,
+	}, time.Time{})
+	// the slice of a pod of the device plugin adopted by the daemonset
+	adopted := newPriorityPod("device-plugin-workload", 0, "1g.5gb", false)
+	withRunningSlice(instaslice, adopted, "gpu-a", 5)
+	adoptedResult := instaslice.Status.PodAllocationResults[adopted.UID]
+	adoptedResult.Conditions = []metav1.Condition{{Type: AdoptedCondition, Status: metav1.ConditionTrue, Reason: "InUse", LastTransitionTime: metav1.Now()}}
+	instaslice.Status.PodAllocationResults[adopted.UID] = adoptedResult
+	// a pod with the same name as a deleted one
+	newPod := recreated.DeepCopy()
+	newPod.UID = types.UID("recreated-again")
+	r := newTestReconciler(instaslice, running, newPod)
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+	r.reserving = map[types.UID]inferencev1alpha1.AllocationResult{reserving.UID: instaslice.Status.PodAllocationResults[reserving.UID]}
+
+	assert.NoError(t, r.sweepOrphanedAllocations(context.TODO()))
+	results := getInstaslice(t, r, "node-1").Status.PodAllocationResults
+	assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, results[running.UID].AllocationStatus.AllocationStatusController)
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, results[forceDeleted.UID].AllocationStatus.AllocationStatusController)
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, results[recreated.UID].AllocationStatus.AllocationStatusController)
+	assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, results[reserving.UID].AllocationStatus.AllocationStatusController, "reservations in flight are skipped")
+	assert.NotContains(t, results, withdrawn.UID, "allocations deleted by the daemonset are released")
+	assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, results[adopted.UID].AllocationStatus.AllocationStatusController, "adopted allocations are kept")
+	assert.NotContains(t, r.allocationCache, withdrawn.UID)
+
+	// the daemonset deleted the slices of the force deleted pod
+	updated := getInstaslice(t, r, "node-1")
+	withStatus(updated, forceDeleted.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusDeleted,
+	}, time.Time{})
+	assert.NoError(t, r.Status().Update(context.TODO(), updated))
+	assert.NoError(t, r.sweepOrphanedAllocations(context.TODO()))
+	results = getInstaslice(t, r, "node-1").Status.PodAllocationResults
+	assert.NotContains(t, results, forceDeleted.UID)
+	assert.Contains(t, results, running.UID)
+}
+
+func TestSweepWithdrawsRequestsWithoutResults(t *testing.T) {
+	interrupted := newPriorityPod("interrupted", 0, "1g.5gb", true)
+	reserving := newPriorityPod("reserving", 0, "1g.5gb", true)
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withRunningSlice(instaslice, interrupted, "gpu-a", 0)
+	withRunningSlice(instaslice, reserving, "gpu-a", 1)
+	// the results of both reservations aren't stored yet
+	delete(instaslice.Status.PodAllocationResults, interrupted.UID)
+	delete(instaslice.Status.PodAllocationResults, reserving.UID)
+	r := newTestReconciler(instaslice, interrupted, reserving)
+	r.reserving = map[types.UID]inferencev1alpha1.AllocationResult{reserving.UID: {}}
+
+	assert.NoError(t, r.sweepOrphanedAllocations(context.TODO()))
+	requests := getInstaslice(t, r, "node-1").Spec.PodAllocationRequests
+	assert.NotContains(t, requests, interrupted.UID, "the reservation didn't complete")
+	assert.Contains(t, requests, reserving.UID, "reservations in flight are skipped")
+}
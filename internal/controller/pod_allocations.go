@@ -0,0 +1,187 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// instaslicePodUIDIndex indexes the Instaslice objects by the UIDs of the pods they hold
+// allocations for
+const instaslicePodUIDIndex = "spec.podAllocationRequests.podRef.uid"
+
+// sliceRequest is a MIG slice requested by a container of a pod
+type sliceRequest struct {
+	containerName string
+	profile       string
+	// index is the index of the slice among the slices of the container
+	index int
+	// configMapName is the ConfigMap injected in the container by the webhook,
+	// the daemonset fills it with the MIG device of the slice
+	configMapName string
+}
+
+// podAllocation is an allocation of a pod found on an Instaslice object
+type podAllocation struct {
+	instasliceName string
+	key            types.UID
+	utils.Allocation
+}
+
+// podSliceRequests returns the slices requested by the containers of the pod, in container
+// order. A container requests as many slices as the quantity of its MIG resource, containers
+// without a MIG resource don't request a slice.
+func (r *InstasliceReconciler) podSliceRequests(pod *v1.Pod) ([]sliceRequest, error) {
+	var slices []sliceRequest
+	for _, container := range pod.Spec.Containers {
+		profileName := r.extractProfileName(container.Resources.Limits)
+		if profileName == "" {
+			continue
+		}
+		configMapName := containerConfigMapName(&container)
+		if configMapName == "" {
+			return nil, fmt.Errorf("no configmap injected in container %s of pod %s", container.Name, pod.Name)
+		}
+		count := r.extractProfileQuantity(container.Resources.Limits)
+		if count < 1 {
+			return nil, fmt.Errorf("invalid quantity of profile %s in container %s of pod %s", profileName, container.Name, pod.Name)
+		}
+		for i := 0; i < count; i++ {
+			slices = append(slices, sliceRequest{
+				containerName: container.Name,
+				profile:       profileName,
+				index:         i,
+				configMapName: configMapName,
+			})
+		}
+	}
+	return slices, nil
+}
+
+// containerConfigMapName returns the name of the ConfigMap appended to the container by the webhook
+func containerConfigMapName(container *v1.Container) string {
+	for i := len(container.EnvFrom) - 1; i >= 0; i-- {
+		if container.EnvFrom[i].ConfigMapRef != nil {
+			return container.EnvFrom[i].ConfigMapRef.Name
+		}
+	}
+	return ""
+}
+
+// allocationKey returns the key the allocation of the i-th slice of the pod is stored under.
+// The first slice uses the pod UID, so that single slice pods keep their key.
+func allocationKey(podUID types.UID, index int, slice sliceRequest) types.UID {
+	if index == 0 {
+		return podUID
+	}
+	if slice.index == 0 {
+		return types.UID(fmt.Sprintf("%s-%s", podUID, slice.containerName))
+	}
+	return types.UID(fmt.Sprintf("%s-%s-%d", podUID, slice.containerName, slice.index))
+}
+
+// allocationAdopted reports whether the daemonset adopted the allocation for a slice that
+// existed before the node was managed. It holds the slots of the slice but no pod managed by
+// the operator, the daemonset releases it once the slice is gone.
+func allocationAdopted(allocResult inferencev1alpha1.AllocationResult) bool {
+	return meta.IsStatusConditionTrue(allocResult.Conditions, AdoptedCondition)
+}
+
+// getPodAllocations returns the allocations of the pod found on the instaslice objects,
+// including the ones whose result isn't set yet. They are sorted by instaslice and key.
+func getPodAllocations(instaslices []inferencev1alpha1.Instaslice, podUID types.UID) []podAllocation {
+	var allocations []podAllocation
+	for _, instaslice := range instaslices {
+		keys := make(map[types.UID]bool)
+		for key := range instaslice.Spec.PodAllocationRequests {
+			keys[key] = true
+		}
+		for key := range instaslice.Status.PodAllocationResults {
+			keys[key] = true
+		}
+		for key := range keys {
+			allocRequest := instaslice.Spec.PodAllocationRequests[key]
+			if allocRequest.PodRef.UID != podUID && key != podUID {
+				continue
+			}
+			allocations = append(allocations, podAllocation{
+				instasliceName: instaslice.Name,
+				key:            key,
+				Allocation: utils.Allocation{
+					Request: allocRequest,
+					Result:  instaslice.Status.PodAllocationResults[key],
+				},
+			})
+		}
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		if allocations[i].instasliceName != allocations[j].instasliceName {
+			return allocations[i].instasliceName < allocations[j].instasliceName
+		}
+		return allocations[i].key < allocations[j].key
+	})
+	return allocations
+}
+
+// instaslicePodUIDs returns the UIDs of the pods with allocations on the Instaslice object, it
+// is the indexer function of instaslicePodUIDIndex.
+func instaslicePodUIDs(obj client.Object) []string {
+	instaslice, ok := obj.(*inferencev1alpha1.Instaslice)
+	if !ok {
+		return nil
+	}
+	podUIDs := make(map[string]bool)
+	for key, allocRequest := range instaslice.Spec.PodAllocationRequests {
+		if allocationAdopted(instaslice.Status.PodAllocationResults[key]) {
+			continue
+		}
+		podUIDs[string(allocRequest.PodRef.UID)] = true
+	}
+	// results left without a request are found by the key of the first slice of the pod
+	for key := range instaslice.Status.PodAllocationResults {
+		if _, ok := instaslice.Spec.PodAllocationRequests[key]; !ok {
+			podUIDs[string(key)] = true
+		}
+	}
+	values := make([]string, 0, len(podUIDs))
+	for podUID := range podUIDs {
+		values = append(values, podUID)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// getPodInstaslices returns the Instaslice objects holding allocations of the pod, looked up
+// through instaslicePodUIDIndex instead of scanning every Instaslice object.
+func (r *InstasliceReconciler) getPodInstaslices(ctx context.Context, podUID types.UID) ([]inferencev1alpha1.Instaslice, error) {
+	var instasliceList inferencev1alpha1.InstasliceList
+	if err := r.List(ctx, &instasliceList, client.MatchingFields{instaslicePodUIDIndex: string(podUID)}); err != nil {
+		return nil, err
+	}
+	sort.Slice(instasliceList.Items, func(i, j int) bool {
+		return instasliceList.Items[i].Name < instasliceList.Items[j].Name
+	})
+	return instasliceList.Items, nil
+}
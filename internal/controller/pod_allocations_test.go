@@ -0,0 +1,453 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	rcache "github.com/openshift/instaslice-operator/internal/controller/cache"
+)
+
+func migContainer(name, profile, configMapName string) v1.Container {
+	return v1.Container{
+		Name: name,
+		Resources: v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceName("instaslice.redhat.com/mig-" + profile): resource.MustParse("1")},
+		},
+		EnvFrom: []v1.EnvFromSource{{
+			ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: configMapName}},
+		}},
+	}
+}
+
+// newTestResourceCache returns a resource cache with room for any pod on the nodes
+func newTestResourceCache(nodeNames ...string) *rcache.ResourceCache {
+	resourceCache := rcache.NewResourceCache()
+	handler := resourceCache.ResourceEventHandlerForNode()
+	for _, name := range nodeNames {
+		handler.AddFunc(&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("64"),
+				v1.ResourceMemory: resource.MustParse("256Gi"),
+			}},
+		})
+	}
+	return resourceCache
+}
+
+func TestPodSliceRequests(t *testing.T) {
+	r := &InstasliceReconciler{}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "serving"},
+		Spec: v1.PodSpec{Containers: []v1.Container{
+			{Name: "sidecar"},
+			migContainer("model-a", "1g.5gb", "cm-a"),
+			migContainer("model-b", "3g.20gb", "cm-b"),
+		}},
+	}
+
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, []sliceRequest{
+		{containerName: "model-a", profile: "1g.5gb", configMapName: "cm-a"},
+		{containerName: "model-b", profile: "3g.20gb", configMapName: "cm-b"},
+	}, slices)
+
+	pod.Spec.Containers[1].Resources.Limits[v1.ResourceName("instaslice.redhat.com/mig-1g.5gb")] = resource.MustParse("2")
+	slices, err = r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, []sliceRequest{
+		{containerName: "model-a", profile: "1g.5gb", index: 0, configMapName: "cm-a"},
+		{containerName: "model-a", profile: "1g.5gb", index: 1, configMapName: "cm-a"},
+		{containerName: "model-b", profile: "3g.20gb", configMapName: "cm-b"},
+	}, slices, "the slices of a container share its configmap")
+
+	pod.Spec.Containers[2].EnvFrom = nil
+	_, err = r.podSliceRequests(pod)
+	assert.Error(t, err, "the webhook didn't inject a configmap in model-b")
+}
+
+func TestAllocationKey(t *testing.T) {
+	assert.Equal(t, types.UID("pod-uid"), allocationKey("pod-uid", 0, sliceRequest{containerName: "model-a"}))
+	assert.Equal(t, types.UID("pod-uid-model-a-1"), allocationKey("pod-uid", 1, sliceRequest{containerName: "model-a", index: 1}))
+	assert.Equal(t, types.UID("pod-uid-model-b"), allocationKey("pod-uid", 2, sliceRequest{containerName: "model-b"}))
+	assert.Equal(t, types.UID("pod-uid-model-b-1"), allocationKey("pod-uid", 3, sliceRequest{containerName: "model-b", index: 1}))
+}
+
+func TestFindNodeAndDeviceForPodPlacesSlicesOfContainerAcrossGPUs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = inferencev1alpha1.AddToScheme(scheme)
+	node1 := newTestInstaslice("node-1", "gpu-a")
+	node2 := newTestInstaslice("node-2", "gpu-b", "gpu-c")
+	r := &InstasliceReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(scheme).WithObjects(node1, node2).Build(),
+		ResourceCache:   newTestResourceCache("node-1", "node-2"),
+		allocationCache: map[types.UID]inferencev1alpha1.AllocationResult{},
+	}
+	container := migContainer("model", "7g.40gb", "cm")
+	container.Resources.Limits[v1.ResourceName("instaslice.redhat.com/mig-7g.40gb")] = resource.MustParse("2")
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "training", Namespace: "default", UID: "pod-uid"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{container}},
+	}
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	instaslice, allocations, err := r.findNodeAndDeviceForPod(context.TODO(), []inferencev1alpha1.Instaslice{*node1, *node2}, slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", instaslice.Name, "node-1 has a single GPU")
+	if !assert.Len(t, allocations, 2) {
+		return
+	}
+	assert.Equal(t, "gpu-b", allocations["pod-uid"].Result.GPUUUID)
+	assert.Equal(t, "gpu-c", allocations["pod-uid-model-1"].Result.GPUUUID)
+	assert.Equal(t, types.UID("cm"), allocations["pod-uid-model-1"].Result.ConfigMapResourceIdentifier)
+}
+
+func TestFindNodeAndDeviceForPodHonorsNodeConstraints(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = inferencev1alpha1.AddToScheme(scheme)
+	node1 := newTestInstaslice("node-1", "gpu-a")
+	node2 := newTestInstaslice("node-2", "gpu-b")
+	r := &InstasliceReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(scheme).WithObjects(node1, node2).Build(),
+		ResourceCache:   newTestResourceCache("node-1", "node-2"),
+		allocationCache: map[types.UID]inferencev1alpha1.AllocationResult{},
+	}
+	tainted := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "training"}},
+		Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "pool", Value: "training", Effect: v1.TaintEffectNoSchedule}}},
+		Status: v1.NodeStatus{Allocatable: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("64"),
+			v1.ResourceMemory: resource.MustParse("256Gi"),
+		}},
+	}
+	r.ResourceCache.ResourceEventHandlerForNode().UpdateFunc(nil, tainted)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "inference", Namespace: "default", UID: "pod-uid"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{migContainer("model", "1g.5gb", "cm")}},
+	}
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	instaslices := []inferencev1alpha1.Instaslice{*node1, *node2}
+
+	instaslice, _, err := r.findNodeAndDeviceForPod(context.TODO(), instaslices, slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", instaslice.Name, "node-1 is tainted")
+
+	pod.Spec.NodeSelector = map[string]string{"pool": "training"}
+	_, _, err = r.findNodeAndDeviceForPod(context.TODO(), instaslices, slices, &FirstFitPolicy{}, pod)
+	assert.Error(t, err, "the pod doesn't tolerate the taint of the only node it selects")
+
+	pod.Spec.Tolerations = []v1.Toleration{{Key: "pool", Operator: v1.TolerationOpExists}}
+	instaslice, _, err = r.findNodeAndDeviceForPod(context.TODO(), instaslices, slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-1", instaslice.Name)
+}
+
+func TestFindNodeAndDeviceForPodSkipsNodesNotReady(t *testing.T) {
+	notReady := newTestInstaslice("node-1", "gpu-a")
+	notReady.Status.Conditions = []metav1.Condition{{
+		Type:               NodeReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "DriverError",
+		LastTransitionTime: metav1.Now(),
+	}}
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	r := newTestReconciler(notReady, newTestInstaslice("node-2", "gpu-b"), pod)
+	r.ResourceCache = newTestResourceCache("node-1", "node-2")
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	instaslice, _, err := r.findNodeAndDeviceForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", instaslice.Name, "node-1 is not ready")
+
+	reason, message := r.explainNoPlacement(listInstaslices(t, r)[:1], slices, pod)
+	assert.Equal(t, ReasonNodeNotReady, reason)
+	assert.Equal(t, "0/1 nodes can hold the slices of profile 1g.5gb: 1 not ready", message)
+}
+
+func TestFindNodeAndDeviceForPodSkipsNodesItCantGet(t *testing.T) {
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	r := newTestReconciler(newTestInstaslice("node-2", "gpu-b"), pod)
+	r.ResourceCache = newTestResourceCache("node-1", "node-2")
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	// the Instaslice of node-1 was deleted since it was listed
+	instaslices := []inferencev1alpha1.Instaslice{*newTestInstaslice("node-1", "gpu-a"), listInstaslices(t, r)[0]}
+	instaslice, _, err := r.findNodeAndDeviceForPod(context.TODO(), instaslices, slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", instaslice.Name)
+}
+
+func TestFindNodeAndDeviceForPodPlacesContainersOnOneNode(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = inferencev1alpha1.AddToScheme(scheme)
+	node1 := newTestInstaslice("node-1", "gpu-a")
+	node2 := newTestInstaslice("node-2", "gpu-b", "gpu-c")
+	r := &InstasliceReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(scheme).WithObjects(node1, node2).Build(),
+		ResourceCache:   newTestResourceCache("node-1", "node-2"),
+		allocationCache: map[types.UID]inferencev1alpha1.AllocationResult{},
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "serving", Namespace: "default", UID: "pod-uid"},
+		Spec: v1.PodSpec{Containers: []v1.Container{
+			migContainer("model-a", "4g.20gb", "cm-a"),
+			migContainer("model-b", "4g.20gb", "cm-b"),
+		}},
+	}
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	instaslice, allocations, err := r.findNodeAndDeviceForPod(context.TODO(), []inferencev1alpha1.Instaslice{*node1, *node2}, slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-2", instaslice.Name, "node-1 has room for a single 4g.20gb slice")
+	if !assert.Len(t, allocations, 2) {
+		return
+	}
+
+	first := allocations["pod-uid"]
+	assert.Equal(t, "model-a", first.Request.ContainerName)
+	assert.Equal(t, "gpu-b", first.Result.GPUUUID)
+	assert.Equal(t, types.UID("cm-a"), first.Result.ConfigMapResourceIdentifier)
+
+	second := allocations["pod-uid-model-b"]
+	assert.Equal(t, "model-b", second.Request.ContainerName)
+	assert.Equal(t, "gpu-c", second.Result.GPUUUID)
+	assert.Equal(t, types.UID("cm-b"), second.Result.ConfigMapResourceIdentifier)
+	assert.Equal(t, types.UID("pod-uid"), second.Request.PodRef.UID)
+
+	pod.Spec.Containers = append(pod.Spec.Containers, migContainer("model-c", "4g.20gb", "cm-c"))
+	slices, err = r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	_, _, err = r.findNodeAndDeviceForPod(context.TODO(), []inferencev1alpha1.Instaslice{*node1, *node2}, slices, &FirstFitPolicy{}, pod)
+	assert.Error(t, err, "no node has room for three 4g.20gb slices")
+}
+
+func TestListInstaslicesInSyncSkipsNodesNotInSync(t *testing.T) {
+	bootedNode := func(name, bootID string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     v1.NodeStatus{NodeInfo: v1.NodeSystemInfo{BootID: bootID}},
+		}
+	}
+	inSync, rebooted, undiscovered := newTestInstaslice("node-1", "gpu-a"), newTestInstaslice("node-2", "gpu-b"), newTestInstaslice("node-3", "gpu-c")
+	inSync.Status.NodeResources.BootID = "boot-1"
+	rebooted.Status.NodeResources.BootID = "boot-1"
+	r := newTestReconciler(inSync, rebooted, undiscovered, newTestInstaslice("node-4", "gpu-d"),
+		bootedNode("node-1", "boot-1"), bootedNode("node-2", "boot-2"), bootedNode("node-3", "boot-1"))
+
+	instasliceList, err := r.listInstaslicesInSync(context.TODO())
+	assert.NoError(t, err)
+	if assert.Len(t, instasliceList.Items, 1, "the nodes not in sync, or gone, aren't candidates") {
+		assert.Equal(t, "node-1", instasliceList.Items[0].Name)
+	}
+}
+
+func TestGetPodAllocations(t *testing.T) {
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	instaslice.Spec.PodAllocationRequests = map[types.UID]inferencev1alpha1.AllocationRequest{
+		"pod-uid":         {PodRef: v1.ObjectReference{UID: "pod-uid"}, ContainerName: "model-a"},
+		"pod-uid-model-b": {PodRef: v1.ObjectReference{UID: "pod-uid"}, ContainerName: "model-b"},
+		"other-uid":       {PodRef: v1.ObjectReference{UID: "other-uid"}},
+	}
+	instaslice.Status.PodAllocationResults = map[types.UID]inferencev1alpha1.AllocationResult{
+		"pod-uid": {GPUUUID: "gpu-a"},
+	}
+
+	allocations := getPodAllocations([]inferencev1alpha1.Instaslice{*instaslice}, "pod-uid")
+	if !assert.Len(t, allocations, 2) {
+		return
+	}
+	assert.Equal(t, types.UID("pod-uid"), allocations[0].key)
+	assert.Equal(t, "gpu-a", allocations[0].Result.GPUUUID)
+	assert.Equal(t, types.UID("pod-uid-model-b"), allocations[1].key)
+	assert.Equal(t, "model-b", allocations[1].Request.ContainerName, "the result of model-b isn't set yet")
+	assert.False(t, allocationsReadyToUngate(allocations))
+}
+
+func TestGetPodInstaslices(t *testing.T) {
+	node1 := newTestInstaslice("node-1", "gpu-a")
+	node1.Spec.PodAllocationRequests = map[types.UID]inferencev1alpha1.AllocationRequest{
+		"pod-uid":         {PodRef: v1.ObjectReference{UID: "pod-uid"}},
+		"pod-uid-model-b": {PodRef: v1.ObjectReference{UID: "pod-uid"}},
+	}
+	node2 := newTestInstaslice("node-2", "gpu-b")
+	node2.Spec.PodAllocationRequests = map[types.UID]inferencev1alpha1.AllocationRequest{
+		"other-uid": {PodRef: v1.ObjectReference{UID: "other-uid"}},
+	}
+	// a result left without its request
+	node2.Status.PodAllocationResults = map[types.UID]inferencev1alpha1.AllocationResult{
+		"stale-uid": {GPUUUID: "gpu-b"},
+	}
+	assert.Equal(t, []string{"pod-uid"}, instaslicePodUIDs(node1))
+	assert.Equal(t, []string{"other-uid", "stale-uid"}, instaslicePodUIDs(node2))
+
+	scheme := runtime.NewScheme()
+	_ = inferencev1alpha1.AddToScheme(scheme)
+	r := &InstasliceReconciler{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(node1, node2).
+			WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).Build(),
+	}
+	for podUID, want := range map[types.UID][]string{"pod-uid": {"node-1"}, "stale-uid": {"node-2"}, "unknown-uid": nil} {
+		instaslices, err := r.getPodInstaslices(context.TODO(), podUID)
+		assert.NoError(t, err)
+		var names []string
+		for _, instaslice := range instaslices {
+			names = append(names, instaslice.Name)
+		}
+		assert.Equal(t, want, names, podUID)
+	}
+}
+
+func TestAllocatePodConcurrently(t *testing.T) {
+	objects := []client.Object{newTestInstaslice("node-1", "gpu-a")}
+	var pods []*v1.Pod
+	for i := 0; i < 7; i++ {
+		pod := newPriorityPod(fmt.Sprintf("inference-%d", i), 0, "1g.5gb", true)
+		pods = append(pods, pod)
+		objects = append(objects, pod)
+	}
+	r := newTestReconciler(objects...)
+
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod *v1.Pod) {
+			defer wg.Done()
+			slices, err := r.podSliceRequests(pod)
+			assert.NoError(t, err)
+			// a worker may lose the race for a placement and place its slices again, until
+			// it is allocated
+			for attempt := 0; attempt < 100; attempt++ {
+				instasliceList := &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)}
+				_, err := r.allocatePod(context.TODO(), pod, slices, instasliceList)
+				assert.NoError(t, err)
+				if len(getPodAllocations(listInstaslices(t, r), pod.UID)) > 0 {
+					return
+				}
+			}
+		}(pod)
+	}
+	wg.Wait()
+
+	starts := make(map[int32]bool)
+	for _, pod := range pods {
+		allocations := getPodAllocations(listInstaslices(t, r), pod.UID)
+		if assert.Len(t, allocations, 1, pod.Name) {
+			start := allocations[0].Result.MigPlacement.Start
+			assert.False(t, starts[start], "placement %d is carved twice", start)
+			starts[start] = true
+		}
+	}
+}
+
+func TestAllocatePodWritesWithoutHoldingTheLock(t *testing.T) {
+	victim := newPriorityPod("batch", 10, "7g.40gb", false)
+	preemptor := newPriorityPod("inference", 1000, "1g.5gb", true)
+	instaslice := withRunningPod(newTestInstaslice("node-1", "gpu-a"), victim, "gpu-a")
+	r := newTestReconciler(instaslice, victim, preemptor)
+	r.Config.PreemptionEnable = true
+	r.allocationCache[victim.UID] = instaslice.Status.PodAllocationResults[victim.UID]
+	// the writes record whether another reconcile could take allocationMu meanwhile
+	var writes, locked []string
+	write := func(call string, obj client.Object) {
+		writes = append(writes, call+" "+obj.GetName())
+		if !r.allocationMu.TryLock() {
+			locked = append(locked, call+" "+obj.GetName())
+			return
+		}
+		r.allocationMu.Unlock()
+	}
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			write("patch", obj)
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+		SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+			write("patch "+subResourceName, obj)
+			return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+		},
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+			write("create "+subResourceName, obj)
+			return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+		},
+	})
+	slices, err := r.podSliceRequests(preemptor)
+	assert.NoError(t, err)
+
+	// batch is preempted
+	_, err = r.allocatePod(context.TODO(), preemptor, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Contains(t, writes, "create eviction batch")
+
+	// the slice of batch is released, the nominated slice is stored
+	r.allocationMu.Lock()
+	delete(r.allocationCache, victim.UID)
+	r.allocationMu.Unlock()
+	released := getInstaslice(t, r, "node-1")
+	victimResult := released.Status.PodAllocationResults[victim.UID]
+	victimResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusDeleted
+	released.Status.PodAllocationResults[victim.UID] = victimResult
+	assert.NoError(t, r.Status().Update(context.TODO(), released))
+	_, err = r.allocatePod(context.TODO(), preemptor, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Len(t, getPodAllocations(listInstaslices(t, r), preemptor.UID), 1)
+	assert.Contains(t, writes, "patch status inference")
+	assert.Empty(t, locked)
+}
+
+func TestAllocatePodRejectsStaleCache(t *testing.T) {
+	holder := newPriorityPod("holder", 0, "1g.5gb", false)
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	instaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a"), holder, "gpu-a", 0)
+	// the cache missed the allocation of holder
+	r := newTestReconciler(instaslice, holder, pod)
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	result, err := r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Equal(t, Requeue1sDelay, result.RequeueAfter)
+	assert.Empty(t, getPodAllocations(listInstaslices(t, r), pod.UID))
+	assert.NotContains(t, r.allocationCache, pod.UID)
+	assert.False(t, r.isCacheInitialized, "the cache is rebuilt")
+
+	_, err = r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	allocations := getPodAllocations(listInstaslices(t, r), pod.UID)
+	if assert.Len(t, allocations, 1) {
+		assert.Equal(t, int32(1), allocations[0].Result.MigPlacement.Start)
+	}
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// podGroup is a group of pods whose slices are reserved in one pass and which are ungated
+// together, once at least minMember pods of the group exist.
+type podGroup struct {
+	name      string
+	minMember int
+	// members are the pods of the group that aren't terminating, sorted by name
+	members []v1.Pod
+}
+
+// podGroupMinMember returns the min-member count of the pod group of the pod
+func podGroupMinMember(pod *v1.Pod) (int, error) {
+	value, ok := pod.Annotations[PodGroupMinMemberAnnotation]
+	if !ok {
+		return 0, fmt.Errorf("pod group %s has no %s annotation", pod.Labels[PodGroupLabel], PodGroupMinMemberAnnotation)
+	}
+	minMember, err := strconv.Atoi(value)
+	if err != nil || minMember < 1 {
+		return 0, fmt.Errorf("invalid %s annotation %q, a positive integer is expected", PodGroupMinMemberAnnotation, value)
+	}
+	return minMember, nil
+}
+
+// getPodGroup returns the pod group of the pod, nil when the pod doesn't belong to a group
+func (r *InstasliceReconciler) getPodGroup(ctx context.Context, pod *v1.Pod) (*podGroup, error) {
+	name, ok := pod.Labels[PodGroupLabel]
+	if !ok || name == "" {
+		return nil, nil
+	}
+	minMember, err := podGroupMinMember(pod)
+	if err != nil {
+		return nil, err
+	}
+	var podList v1.PodList
+	if err := r.List(ctx, &podList, client.InNamespace(pod.Namespace), client.MatchingLabels{PodGroupLabel: name}); err != nil {
+		return nil, err
+	}
+	group := &podGroup{name: name, minMember: minMember}
+	for _, member := range podList.Items {
+		if !member.DeletionTimestamp.IsZero() || member.Status.Phase == v1.PodSucceeded || member.Status.Phase == v1.PodFailed {
+			continue
+		}
+		group.members = append(group.members, member)
+	}
+	sort.Slice(group.members, func(i, j int) bool {
+		return group.members[i].Name < group.members[j].Name
+	})
+	return group, nil
+}
+
+// reconcilePodGroup allocates and ungates the gated members of the pod group. Slices are
+// reserved for all the members without allocations in one pass, once the group has at least
+// minMember pods. The members are ungated together once the daemonset has created all the
+// slices. If that doesn't happen within the pod group timeout the reservations are rolled
+// back and made again later.
+func (r *InstasliceReconciler) reconcilePodGroup(ctx context.Context, group *podGroup, instasliceList *inferencev1alpha1.InstasliceList) (ctrl.Result, error) {
+	log := logr.FromContext(ctx).WithValues("podGroup", group.name)
+
+	var gated, unreserved []v1.Pod
+	var reserved []podAllocation
+	released := false
+	for _, member := range group.members {
+		if !checkIfPodGatedByInstaSlice(&member) {
+			continue
+		}
+		gated = append(gated, member)
+		allocations := getPodAllocations(instasliceList.Items, member.UID)
+		if len(allocations) == 0 {
+			unreserved = append(unreserved, member)
+			continue
+		}
+		for _, allocation := range allocations {
+			// allocations of a rolled back reservation
+			if allocation.Result.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+				if err := r.releasePodAllocation(ctx, allocation); err != nil {
+					return ctrl.Result{}, err
+				}
+				released = true
+				continue
+			}
+			reserved = append(reserved, allocation)
+		}
+	}
+	if released {
+		return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
+	}
+	if len(gated) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	if len(unreserved) > 0 {
+		if len(group.members) < group.minMember {
+			log.Info("waiting for the pod group to be complete", "members", len(group.members), "minMember", group.minMember)
+			return ctrl.Result{RequeueAfter: Requeue10sDelay}, nil
+		}
+		if err := r.reservePodGroup(ctx, group, unreserved, instasliceList); err != nil {
+			log.Info("no room in the cluster for the pod group", "members", len(unreserved), "reason", err.Error())
+			// the members wait like single pods, any of them woken reconciles the whole group
+			for i := range unreserved {
+				slices, err := r.podSliceRequests(&unreserved[i])
+				if err != nil {
+					return ctrl.Result{}, err
+				}
+				r.queueWaitingPod(&unreserved[i], slices)
+			}
+			return ctrl.Result{RequeueAfter: r.waitQueueResyncInterval()}, nil
+		}
+		for i := range unreserved {
+			r.waitQueue.remove(client.ObjectKeyFromObject(&unreserved[i]))
+		}
+		return ctrl.Result{}, nil
+	}
+
+	for _, allocation := range reserved {
+		if allocation.Result.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting {
+			// rollback in progress, wait for the daemonset to delete the slices
+			return ctrl.Result{RequeueAfter: Requeue2sDelay}, nil
+		}
+	}
+	if allocationsReadyToUngate(reserved) {
+		return r.ungatePodGroup(ctx, gated, reserved)
+	}
+
+	timeout := config.DefaultPodGroupTimeout
+	if r.Config != nil && r.Config.PodGroupTimeout > 0 {
+		timeout = r.Config.PodGroupTimeout
+	}
+	if elapsed := time.Since(podGroupReservedAt(reserved)); elapsed < timeout {
+		return ctrl.Result{RequeueAfter: timeout - elapsed}, nil
+	}
+	log.Info("pod group not ready in time, rolling back its reservations", "timeout", timeout)
+	return ctrl.Result{RequeueAfter: Requeue2sDelay}, r.rollbackPodGroup(ctx, reserved)
+}
+
+// reservePodGroup places the slices of all the pods and stores the allocations, nothing is
+// stored when a pod doesn't fit. The slices are placed and reserved in the cache while holding
+// allocationMu, and stored without holding it. The caller doesn't hold allocationMu.
+func (r *InstasliceReconciler) reservePodGroup(ctx context.Context, group *podGroup, pods []v1.Pod, instasliceList *inferencev1alpha1.InstasliceList) error {
+	sort.Slice(instasliceList.Items, func(i, j int) bool {
+		return instasliceList.Items[i].Name < instasliceList.Items[j].Name
+	})
+	if err := r.rebuildAllocationCache(ctx); err != nil {
+		return err
+	}
+	r.CleanupOrphanedAllocations(ctx, instasliceList)
+	policies := make([]AllocationPolicy, len(pods))
+	for i := range pods {
+		policy, err := r.allocationPolicyForPod(ctx, &pods[i])
+		if err != nil {
+			return err
+		}
+		policies[i] = policy
+	}
+
+	r.allocationMu.Lock()
+	reservations, err := r.placePodGroup(ctx, group, pods, policies, instasliceList)
+	r.allocationMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(reservations))
+	for name := range reservations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if err := utils.ReserveInstasliceAllocations(ctx, r.Client, name, reservations[name]); err != nil {
+			// the group is stored as a whole, the reservations stored on the previous nodes are
+			// withdrawn and the whole group is reserved again on the next attempt
+			r.allocationMu.Lock()
+			for _, unstored := range names[i:] {
+				for key := range reservations[unstored] {
+					delete(r.reserving, key)
+					r.forgetCachedAllocation(key)
+				}
+			}
+			r.allocationMu.Unlock()
+			r.withdrawPodGroupReservations(ctx, names[:i], reservations)
+			return err
+		}
+	}
+	r.allocationMu.Lock()
+	for _, name := range names {
+		for key := range reservations[name] {
+			delete(r.reserving, key)
+		}
+		r.recordNewAllocations(reservations[name])
+	}
+	r.allocationMu.Unlock()
+	return nil
+}
+
+// placePodGroup places the slices of all the pods and reserves them in the cache, by node.
+// Nothing is reserved when a pod doesn't fit. The caller holds allocationMu.
+func (r *InstasliceReconciler) placePodGroup(ctx context.Context, group *podGroup, pods []v1.Pod, policies []AllocationPolicy, instasliceList *inferencev1alpha1.InstasliceList) (map[string]map[types.UID]utils.Allocation, error) {
+	if !r.isCacheInitialized {
+		return nil, fmt.Errorf("the allocation cache was invalidated")
+	}
+	reservations := make(map[string]map[types.UID]utils.Allocation)
+	// the allocations are added to the cache as they are made, so that the next pods of the
+	// group don't get the same slices, and removed again when the group doesn't fit
+	rollback := func() {
+		for _, allocations := range reservations {
+			for key := range allocations {
+				delete(r.reserving, key)
+				r.forgetCachedAllocation(key)
+			}
+		}
+	}
+	for i := range pods {
+		pod := &pods[i]
+		slices, err := r.podSliceRequests(pod)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		instaslice, allocations, err := r.findNodeAndDeviceForPod(ctx, instasliceList.Items, slices, policies[i], pod)
+		if err != nil {
+			rollback()
+			return nil, fmt.Errorf("pod %s: %w", pod.Name, err)
+		}
+		if reservations[instaslice.Name] == nil {
+			reservations[instaslice.Name] = make(map[types.UID]utils.Allocation)
+		}
+		for key, allocation := range allocations {
+			meta.SetStatusCondition(&allocation.Result.Conditions, metav1.Condition{
+				Type:    PodGroupReservedCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  "PodGroupComplete",
+				Message: fmt.Sprintf("reserved for pod group %s", group.name),
+			})
+			reservations[instaslice.Name][key] = allocation
+			r.reserveInCache(map[types.UID]utils.Allocation{key: allocation})
+		}
+	}
+	return reservations, nil
+}
+
+// withdrawPodGroupReservations withdraws the reservations stored on the given nodes. The
+// reservations that can't be withdrawn are kept and rolled back with the group once it
+// times out. The caller doesn't hold allocationMu.
+func (r *InstasliceReconciler) withdrawPodGroupReservations(ctx context.Context, names []string, reservations map[string]map[types.UID]utils.Allocation) {
+	log := logr.FromContext(ctx)
+	for _, name := range names {
+		keys := make([]types.UID, 0, len(reservations[name]))
+		for key := range reservations[name] {
+			keys = append(keys, key)
+		}
+		err := utils.WithdrawInstasliceAllocations(ctx, r.Client, name, keys)
+		r.allocationMu.Lock()
+		for _, key := range keys {
+			delete(r.reserving, key)
+		}
+		if err != nil {
+			r.recordNewAllocations(reservations[name])
+		} else {
+			for _, key := range keys {
+				r.forgetCachedAllocation(key)
+			}
+		}
+		r.allocationMu.Unlock()
+		if err != nil {
+			log.Error(err, "unable to withdraw the reservations of the pod group", "instaslice", name)
+		}
+	}
+}
+
+// podGroupReservedAt returns when the oldest of the allocations was reserved
+func podGroupReservedAt(allocations []podAllocation) time.Time {
+	var reservedAt time.Time
+	for _, allocation := range allocations {
+		condition := meta.FindStatusCondition(allocation.Result.Conditions, PodGroupReservedCondition)
+		if condition == nil {
+			continue
+		}
+		if reservedAt.IsZero() || condition.LastTransitionTime.Time.Before(reservedAt) {
+			reservedAt = condition.LastTransitionTime.Time
+		}
+	}
+	if reservedAt.IsZero() {
+		return time.Now()
+	}
+	return reservedAt
+}
+
+// ungatePodGroup sets the allocations to ungated and ungates all the pods
+func (r *InstasliceReconciler) ungatePodGroup(ctx context.Context, pods []v1.Pod, allocations []podAllocation) (ctrl.Result, error) {
+	ungated := make(map[string]map[types.UID]utils.Allocation)
+	nodes := make(map[types.UID]types.NodeName)
+	for _, allocation := range allocations {
+		nodes[allocation.Request.PodRef.UID] = allocation.Result.Nodename
+		if allocation.Result.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusUngated {
+			continue
+		}
+		allocation.Result.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusUngated
+		if ungated[allocation.instasliceName] == nil {
+			ungated[allocation.instasliceName] = make(map[types.UID]utils.Allocation)
+		}
+		ungated[allocation.instasliceName][allocation.key] = allocation.Allocation
+	}
+	for instasliceName, instasliceAllocations := range ungated {
+		if err := utils.UpdateInstasliceAllocations(ctx, r.Client, instasliceName, instasliceAllocations); err != nil {
+			return ctrl.Result{Requeue: true}, err
+		}
+	}
+	for i := range pods {
+		pod := &pods[i]
+		allocResult := inferencev1alpha1.AllocationResult{Nodename: nodes[pod.UID]}
+		if result, err := r.addNodeSelectorAndUngatePod(ctx, pod, &allocResult); err != nil {
+			return result, err
+		}
+		r.recordEvent(pod, v1.EventTypeNormal, ReasonUngated, fmt.Sprintf("scheduling gate removed with pod group %s, the pod runs on node %s", pod.Labels[PodGroupLabel], nodes[pod.UID]))
+	}
+	return ctrl.Result{}, nil
+}
+
+// rollbackPodGroup sets the allocations to deleting, the daemonset deletes the slices it
+// already created.
+func (r *InstasliceReconciler) rollbackPodGroup(ctx context.Context, allocations []podAllocation) error {
+	deleting := make(map[string]map[types.UID]utils.Allocation)
+	for _, allocation := range allocations {
+		allocation.Result.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+		if deleting[allocation.instasliceName] == nil {
+			deleting[allocation.instasliceName] = make(map[types.UID]utils.Allocation)
+		}
+		deleting[allocation.instasliceName][allocation.key] = allocation.Allocation
+	}
+	for instasliceName, instasliceAllocations := range deleting {
+		if err := utils.UpdateInstasliceAllocations(ctx, r.Client, instasliceName, instasliceAllocations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
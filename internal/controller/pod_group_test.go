@@ -0,0 +1,220 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+)
+
+func newGroupMember(name, group, minMember, profile string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			UID:         types.UID(name + "-uid"),
+			Labels:      map[string]string{PodGroupLabel: group},
+			Annotations: map[string]string{PodGroupMinMemberAnnotation: minMember},
+		},
+		Spec: v1.PodSpec{
+			SchedulingGates: []v1.PodSchedulingGate{{Name: GateName}},
+			Containers:      []v1.Container{migContainer("worker", profile, name+"-cm")},
+		},
+		Status: v1.PodStatus{Phase: v1.PodPending, Conditions: []v1.PodCondition{{Message: "blocked"}}},
+	}
+}
+
+func newTestReconciler(objects ...client.Object) *InstasliceReconciler {
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	_ = inferencev1alpha1.AddToScheme(scheme)
+	return &InstasliceReconciler{
+		Client:             fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(&inferencev1alpha1.Instaslice{}).WithIndex(&inferencev1alpha1.Instaslice{}, instaslicePodUIDIndex, instaslicePodUIDs).Build(),
+		Config:             &config.Config{PodGroupTimeout: time.Minute},
+		ResourceCache:      newTestResourceCache("node-1"),
+		allocationCache:    map[types.UID]inferencev1alpha1.AllocationResult{},
+		isCacheInitialized: true,
+	}
+}
+
+// reconcileGroupOf reconciles the pod group of the pod against the instaslice objects in the client
+func reconcileGroupOf(t *testing.T, r *InstasliceReconciler, pod *v1.Pod) (ctrl.Result, *inferencev1alpha1.InstasliceList) {
+	group, err := r.getPodGroup(context.TODO(), pod)
+	assert.NoError(t, err)
+	var instasliceList inferencev1alpha1.InstasliceList
+	assert.NoError(t, r.List(context.TODO(), &instasliceList))
+	result, err := r.reconcilePodGroup(context.TODO(), group, &instasliceList)
+	assert.NoError(t, err)
+	assert.NoError(t, r.List(context.TODO(), &instasliceList))
+	return result, &instasliceList
+}
+
+func TestPodGroupMinMember(t *testing.T) {
+	pod := newGroupMember("worker-0", "training", "3", "1g.5gb")
+	minMember, err := podGroupMinMember(pod)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, minMember)
+
+	for _, value := range []string{"0", "-1", "three"} {
+		pod.Annotations[PodGroupMinMemberAnnotation] = value
+		_, err = podGroupMinMember(pod)
+		assert.Error(t, err, value)
+	}
+	delete(pod.Annotations, PodGroupMinMemberAnnotation)
+	_, err = podGroupMinMember(pod)
+	assert.Error(t, err)
+}
+
+func TestReconcilePodGroupWaitsForMinMember(t *testing.T) {
+	worker0 := newGroupMember("worker-0", "training", "2", "1g.5gb")
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), worker0)
+
+	result, instasliceList := reconcileGroupOf(t, r, worker0)
+	assert.Equal(t, Requeue10sDelay, result.RequeueAfter)
+	assert.Empty(t, getPodAllocations(instasliceList.Items, worker0.UID), "nothing is reserved for a partial group")
+}
+
+func TestReconcilePodGroupReservesAllOrNothing(t *testing.T) {
+	worker0 := newGroupMember("worker-0", "training", "2", "7g.40gb")
+	worker1 := newGroupMember("worker-1", "training", "2", "7g.40gb")
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), worker0, worker1)
+
+	result, instasliceList := reconcileGroupOf(t, r, worker0)
+	assert.Empty(t, getPodAllocations(instasliceList.Items, worker0.UID), "worker-1 doesn't fit, worker-0 must not hold a GPU")
+	assert.Empty(t, r.allocationCache)
+	assert.Equal(t, r.waitQueueResyncInterval(), result.RequeueAfter)
+	assert.Len(t, r.waitQueue.pods["7g.40gb"], 2, "the members wait for a 7g.40gb slice")
+
+	// the members woken once a GPU is added are reserved and leave the queue
+	gpus := newTestInstaslice("node-1", "gpu-a", "gpu-b")
+	stored := getInstaslice(t, r, "node-1")
+	stored.Status.NodeResources = gpus.Status.NodeResources
+	assert.NoError(t, r.Status().Update(context.TODO(), stored))
+	r.invalidateAllocationCache()
+	_, instasliceList = reconcileGroupOf(t, r, worker1)
+	allocations0 := getPodAllocations(instasliceList.Items, worker0.UID)
+	allocations1 := getPodAllocations(instasliceList.Items, worker1.UID)
+	if !assert.Len(t, allocations0, 1) || !assert.Len(t, allocations1, 1) {
+		return
+	}
+	assert.Equal(t, "gpu-a", allocations0[0].Result.GPUUUID)
+	assert.Equal(t, "gpu-b", allocations1[0].Result.GPUUUID)
+	assert.Len(t, allocations0[0].Result.Conditions, 1)
+	assert.Equal(t, PodGroupReservedCondition, allocations0[0].Result.Conditions[0].Type)
+	assert.Empty(t, r.waitQueue.pods)
+	assert.Empty(t, r.waitQueue.priorities)
+}
+
+// failingPatchClient fails the patches of the object with the given name
+type failingPatchClient struct {
+	client.Client
+	name string
+}
+
+func (c *failingPatchClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if obj.GetName() == c.name {
+		return fmt.Errorf("simulated patch failure")
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestReconcilePodGroupWithdrawsStoredReservations(t *testing.T) {
+	worker0 := newGroupMember("worker-0", "training", "2", "7g.40gb")
+	worker1 := newGroupMember("worker-1", "training", "2", "7g.40gb")
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), newTestInstaslice("node-2", "gpu-b"), worker0, worker1)
+	r.ResourceCache = newTestResourceCache("node-1", "node-2")
+	r.Client = &failingPatchClient{Client: r.Client, name: "node-2"}
+
+	_, instasliceList := reconcileGroupOf(t, r, worker0)
+	assert.Empty(t, getPodAllocations(instasliceList.Items, worker0.UID), "the reservation stored on node-1 is withdrawn")
+	assert.Empty(t, getPodAllocations(instasliceList.Items, worker1.UID))
+	assert.Empty(t, r.allocationCache)
+}
+
+func TestReconcilePodGroupUngatesTogether(t *testing.T) {
+	worker0 := newGroupMember("worker-0", "training", "2", "1g.5gb")
+	worker1 := newGroupMember("worker-1", "training", "2", "1g.5gb")
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), worker0, worker1)
+	_, instasliceList := reconcileGroupOf(t, r, worker0)
+
+	// the daemonset created the slice of worker-0 only
+	instaslice := instasliceList.Items[0]
+	result := instaslice.Status.PodAllocationResults[worker0.UID]
+	result.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+	instaslice.Status.PodAllocationResults[worker0.UID] = result
+	assert.NoError(t, r.Status().Update(context.TODO(), &instaslice))
+
+	requeue, _ := reconcileGroupOf(t, r, worker0)
+	assert.NotZero(t, requeue.RequeueAfter, "worker-1 isn't ready")
+	pod := &v1.Pod{}
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(worker0), pod))
+	assert.True(t, checkIfPodGatedByInstaSlice(pod))
+
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(&instaslice), &instaslice))
+	result = instaslice.Status.PodAllocationResults[worker1.UID]
+	result.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+	instaslice.Status.PodAllocationResults[worker1.UID] = result
+	assert.NoError(t, r.Status().Update(context.TODO(), &instaslice))
+
+	_, instasliceList = reconcileGroupOf(t, r, worker1)
+	for _, worker := range []*v1.Pod{worker0, worker1} {
+		assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(worker), pod))
+		assert.False(t, checkIfPodGatedByInstaSlice(pod), worker.Name)
+		assert.Equal(t, "node-1", pod.Spec.NodeSelector[NodeLabel])
+		allocations := getPodAllocations(instasliceList.Items, worker.UID)
+		assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, allocations[0].Result.AllocationStatus.AllocationStatusController)
+	}
+}
+
+func TestReconcilePodGroupRollsBackAfterTimeout(t *testing.T) {
+	worker0 := newGroupMember("worker-0", "training", "2", "1g.5gb")
+	worker1 := newGroupMember("worker-1", "training", "2", "1g.5gb")
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"), worker0, worker1)
+	_, instasliceList := reconcileGroupOf(t, r, worker0)
+
+	// the reservation is older than the timeout
+	instaslice := instasliceList.Items[0]
+	for key, result := range instaslice.Status.PodAllocationResults {
+		result.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+		if key == worker0.UID {
+			result.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusCreated
+		}
+		instaslice.Status.PodAllocationResults[key] = result
+	}
+	assert.NoError(t, r.Status().Update(context.TODO(), &instaslice))
+
+	_, instasliceList = reconcileGroupOf(t, r, worker0)
+	for _, worker := range []*v1.Pod{worker0, worker1} {
+		allocations := getPodAllocations(instasliceList.Items, worker.UID)
+		if assert.Len(t, allocations, 1) {
+			assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, allocations[0].Result.AllocationStatus.AllocationStatusController, worker.Name)
+		}
+	}
+}
@@ -50,10 +50,51 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 		return admission.Allowed("No nvidia.com/mig-* resource found, skipping mutation.")
 	}
 
+	namespaceName := pod.Namespace
+	if namespaceName == "" {
+		namespaceName = req.Namespace
+	}
+	namespace, err := getNamespace(ctx, a.Client, namespaceName)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("could not get namespace of the pod: %v", err))
+	}
+	if name, ok := requestedAllocationPolicy(pod, namespace); ok {
+		if _, err := GetAllocationPolicy(name); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
+	if value, ok := requestedTeardownDelay(pod, namespace); ok {
+		if _, err := parseTeardownDelay(value); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
+	if _, ok := pod.Labels[PodGroupLabel]; ok {
+		if _, err := podGroupMinMember(pod); err != nil {
+			return admission.Denied(err.Error())
+		}
+	}
+
 	performQuotaArithmetic(pod, req)
 
-	// Transform resource requests from nvidia.com/mig-* to instaslice.redhat.com/mig-*
-	transformResources(&pod.Spec.Containers[0].Resources)
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		if !containerHasMIGResource(container) {
+			continue
+		}
+		// Transform resource requests from nvidia.com/mig-* to instaslice.redhat.com/mig-*
+		transformResources(&container.Resources)
+
+		// Each container gets its own ConfigMap with a unique name, the daemonset fills it
+		// with the MIG devices allocated to the container
+		configMapName := uuid.New().String()
+		container.EnvFrom = append(container.EnvFrom, v1.EnvFromSource{
+			ConfigMapRef: &v1.ConfigMapEnvSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: configMapName},
+			},
+		})
+	}
 
 	// Add scheduling
 	schedulingGateName := GateName
@@ -68,18 +109,6 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 		pod.Spec.SchedulingGates = append(pod.Spec.SchedulingGates, v1.PodSchedulingGate{Name: schedulingGateName})
 	}
 
-	// Generate an extended resource name based on the pod name
-	uuidStr := uuid.New().String()
-
-	// Add envFrom with a unique ConfigMap name derived from the pod name
-	configMapName := uuidStr
-	// Support for only one pod workloads
-	pod.Spec.Containers[0].EnvFrom = append(pod.Spec.Containers[0].EnvFrom, v1.EnvFromSource{
-		ConfigMapRef: &v1.ConfigMapEnvSource{
-			LocalObjectReference: v1.LocalObjectReference{Name: configMapName},
-		},
-	})
-
 	// Add annotation after the pod mutation
 	if pod.Labels == nil {
 		pod.Labels = make(map[string]string)
@@ -97,32 +126,44 @@ func (a *PodAnnotator) Handle(ctx context.Context, req admission.Request) admiss
 
 // hasMIGResource checks if a pod has resource requests or limits with a key that matches `nvidia.com/mig-*`
 func hasMIGResource(pod *v1.Pod) bool {
-	for _, container := range pod.Spec.Containers {
-		// Check resource limits
-		for resourceName := range container.Resources.Limits {
-			if strings.HasPrefix(string(resourceName), NvidiaMIGPrefix) {
-				return true
-			}
+	for i := range pod.Spec.Containers {
+		if containerHasMIGResource(&pod.Spec.Containers[i]) {
+			return true
 		}
-		// Check resource requests
-		for resourceName := range container.Resources.Requests {
-			if strings.HasPrefix(string(resourceName), NvidiaMIGPrefix) {
-				return true
-			}
+	}
+	return false
+}
+
+// containerHasMIGResource checks if a container has resource requests or limits with a key that matches `nvidia.com/mig-*`
+func containerHasMIGResource(container *v1.Container) bool {
+	// Check resource limits
+	for resourceName := range container.Resources.Limits {
+		if strings.HasPrefix(string(resourceName), NvidiaMIGPrefix) {
+			return true
+		}
+	}
+	// Check resource requests
+	for resourceName := range container.Resources.Requests {
+		if strings.HasPrefix(string(resourceName), NvidiaMIGPrefix) {
+			return true
 		}
 	}
 	return false
 }
 
 func performQuotaArithmetic(pod *v1.Pod, req admission.Request) admission.Response {
-	// assumption is that workloads will have 1 container where
-	// MIG is requested.
+	// every container requesting MIG slices is charged the memory of its slices.
 	// TODO instead of only iterating over regular containers,
 	// we should also consider other types of containers (such as init containers) in future
-	for _, container := range pod.Spec.Containers {
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		acceleratorMemory := 0
 		// dont bother checking requests section. Nvidia supports only limits
 		// if requests is added by user, it should be equal to limits.
 		for resourceName, quantity := range container.Resources.Limits {
+			if !strings.HasPrefix(string(resourceName), NvidiaMIGPrefix) {
+				continue
+			}
 			resourceParts := strings.Split(strings.TrimPrefix(string(resourceName), NvidiaMIGPrefix), ".")
 
 			if len(resourceParts) == 2 {
@@ -132,13 +173,14 @@ func performQuotaArithmetic(pod *v1.Pod, req admission.Request) admission.Respon
 				if err != nil {
 					return admission.Errored(http.StatusInternalServerError, fmt.Errorf("failed to parse memory value: %v", err))
 				}
-				acceleratorMemory := memoryValue * int(quantity.Value())
-				// assume 1 container workload
-				// Convert the string to ResourceName
-				resourceName := v1.ResourceName(QuotaResourceName)
-				pod.Spec.Containers[0].Resources.Limits[resourceName] = resource.MustParse(fmt.Sprintf("%dGi", acceleratorMemory))
+				acceleratorMemory += memoryValue * int(quantity.Value())
 			}
 		}
+		if acceleratorMemory > 0 {
+			// Convert the string to ResourceName
+			resourceName := v1.ResourceName(QuotaResourceName)
+			container.Resources.Limits[resourceName] = resource.MustParse(fmt.Sprintf("%dGi", acceleratorMemory))
+		}
 	}
 	// Return the modified pod spec
 	marshaledPod, err := json.Marshal(pod)
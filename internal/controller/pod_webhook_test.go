@@ -29,6 +29,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -216,3 +217,131 @@ func TestTransformResources(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleAllocationPolicy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+
+	namespaces := []client.Object{
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "batch", Labels: map[string]string{AllocationPolicyLabel: BestFitPolicyName}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "broken", Labels: map[string]string{AllocationPolicyLabel: "tightest"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "draining", Labels: map[string]string{TeardownDelayLabel: "soon"}}},
+	}
+	annotator := &PodAnnotator{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(namespaces...).Build(),
+		Decoder: admission.NewDecoder(scheme),
+	}
+
+	newPod := func(namespace string, annotations map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: namespace, Annotations: annotations},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{{
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{"nvidia.com/mig-1g.5gb": resource.MustParse("1")},
+					},
+				}},
+			},
+		}
+	}
+
+	newGroupPod := func(annotations map[string]string) *v1.Pod {
+		pod := newPod("default", annotations)
+		pod.Labels = map[string]string{PodGroupLabel: "training"}
+		return pod
+	}
+
+	tests := []struct {
+		name    string
+		pod     *v1.Pod
+		allowed bool
+	}{
+		{"no policy requested", newPod("default", nil), true},
+		{"valid pod annotation", newPod("default", map[string]string{AllocationPolicyAnnotation: SpreadPolicyName}), true},
+		{"invalid pod annotation", newPod("default", map[string]string{AllocationPolicyAnnotation: "tightest"}), false},
+		{"valid namespace label", newPod("batch", nil), true},
+		{"invalid namespace label", newPod("broken", nil), false},
+		{"pod annotation overrides namespace label", newPod("broken", map[string]string{AllocationPolicyAnnotation: SpreadPolicyName}), true},
+		{"valid teardown delay", newPod("default", map[string]string{TeardownDelayAnnotation: "2m"}), true},
+		{"invalid teardown delay", newPod("default", map[string]string{TeardownDelayAnnotation: "-1s"}), false},
+		{"invalid namespace teardown delay", newPod("draining", nil), false},
+		{"pod group with min-member", newGroupPod(map[string]string{PodGroupMinMemberAnnotation: "4"}), true},
+		{"pod group without min-member", newGroupPod(nil), false},
+		{"pod group with invalid min-member", newGroupPod(map[string]string{PodGroupMinMemberAnnotation: "0"}), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			rawPod, _ := json.Marshal(tt.pod)
+			req := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: tt.pod.Namespace,
+					Object:    runtime.RawExtension{Raw: rawPod},
+				},
+			}
+
+			resp := annotator.Handle(context.TODO(), req)
+			g.Expect(resp.Allowed).To(Equal(tt.allowed))
+		})
+	}
+}
+
+func TestHandleMultipleContainers(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	_ = v1.AddToScheme(scheme)
+	annotator := &PodAnnotator{
+		Client:  fake.NewClientBuilder().WithScheme(scheme).Build(),
+		Decoder: admission.NewDecoder(scheme),
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "serving"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{Name: "sidecar"},
+				{
+					Name: "model-a",
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{"nvidia.com/mig-1g.5gb": resource.MustParse("1")},
+					},
+				},
+				{
+					Name: "model-b",
+					Resources: v1.ResourceRequirements{
+						Limits: v1.ResourceList{"nvidia.com/mig-3g.20gb": resource.MustParse("1")},
+					},
+				},
+			},
+		},
+	}
+	rawPod, _ := json.Marshal(pod)
+	resp := annotator.Handle(context.TODO(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Object: runtime.RawExtension{Raw: rawPod}},
+	})
+	g.Expect(resp.Allowed).To(BeTrue())
+
+	patch, err := json.Marshal(resp.Patches)
+	g.Expect(err).NotTo(HaveOccurred())
+	decoded, err := jsonpatch.DecodePatch(patch)
+	g.Expect(err).NotTo(HaveOccurred())
+	patchedPodBytes, err := decoded.Apply(rawPod)
+	g.Expect(err).NotTo(HaveOccurred())
+	modifiedPod := &v1.Pod{}
+	g.Expect(json.Unmarshal(patchedPodBytes, modifiedPod)).To(Succeed())
+
+	sidecar, modelA, modelB := modifiedPod.Spec.Containers[0], modifiedPod.Spec.Containers[1], modifiedPod.Spec.Containers[2]
+	g.Expect(sidecar.EnvFrom).To(BeEmpty())
+	g.Expect(sidecar.Resources.Limits).To(BeEmpty())
+
+	g.Expect(modelA.EnvFrom).To(HaveLen(1))
+	g.Expect(modelB.EnvFrom).To(HaveLen(1))
+	g.Expect(modelA.EnvFrom[0].ConfigMapRef.Name).NotTo(Equal(modelB.EnvFrom[0].ConfigMapRef.Name))
+
+	g.Expect(modelA.Resources.Limits).To(HaveKey(v1.ResourceName("instaslice.redhat.com/mig-1g.5gb")))
+	g.Expect(modelB.Resources.Limits).To(HaveKey(v1.ResourceName("instaslice.redhat.com/mig-3g.20gb")))
+	quotaA := modelA.Resources.Limits[v1.ResourceName(QuotaResourceName)]
+	quotaB := modelB.Resources.Limits[v1.ResourceName(QuotaResourceName)]
+	g.Expect(quotaA.Cmp(resource.MustParse("5Gi"))).To(Equal(0))
+	g.Expect(quotaB.Cmp(resource.MustParse("20Gi"))).To(Equal(0))
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// nomination holds the placement freed for a preemptor until its victims release their slices
+type nomination struct {
+	instasliceName string
+	allocations    map[types.UID]utils.Allocation
+	// evictions are the pods still to evict to free the placement
+	evictions []nominatedEviction
+	// evicted reports whether a pod was evicted for the nomination
+	evicted bool
+	// held are the placements planned for the pods moved by a defragmentation, by the UID of
+	// the controller recreating them. Only its pods can take them until the nomination is
+	// allocated.
+	held map[types.UID][]slicePlacement
+}
+
+// nominatedEviction is a pod evicted to free a nominated placement
+type nominatedEviction struct {
+	pod *v1.Pod
+	// allocations are the allocations the preemption is recorded on, none when the pod is moved
+	allocations []podAllocation
+	reason      string
+}
+
+// preemptionVictim is a running pod holding slices on the node of a preemption
+type preemptionVictim struct {
+	pod         *v1.Pod
+	allocations []podAllocation
+}
+
+// preemptionPlan is a placement of the slices of the preemptor and the victims overlapping it
+type preemptionPlan struct {
+	candidate   placementCandidate
+	allocations map[types.UID]utils.Allocation
+	victims     []preemptionVictim
+}
+
+// fewerVictims reports whether the plan evicts fewer pods than the other, or as many pods with
+// a lower highest priority
+func (p *preemptionPlan) fewerVictims(other *preemptionPlan) bool {
+	if len(p.victims) != len(other.victims) {
+		return len(p.victims) < len(other.victims)
+	}
+	return highestPriority(p.victims) < highestPriority(other.victims)
+}
+
+// highestPriority returns the highest priority of the victims
+func highestPriority(victims []preemptionVictim) int32 {
+	var highest int32
+	for i, victim := range victims {
+		if i == 0 || podPriority(victim.pod) > highest {
+			highest = podPriority(victim.pod)
+		}
+	}
+	return highest
+}
+
+// podPriority returns the priority of the pod, resolved by the API server from its priority class
+func podPriority(pod *v1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+	return *pod.Spec.Priority
+}
+
+// nominatedPlacementFree reports whether the victims released the slices nominated for the
+// preemptor, and returns the Instaslice object they are stored on. The caller holds
+// allocationMu.
+func (r *InstasliceReconciler) nominatedPlacementFree(ctx context.Context, nominated nomination) (*inferencev1alpha1.Instaslice, bool, error) {
+	instaslice, err := r.getInstasliceObject(ctx, nominated.instasliceName, InstaSliceOperatorNamespace)
+	if err != nil {
+		return nil, false, err
+	}
+	excluded := make(map[types.UID]bool, len(nominated.allocations))
+	for key := range nominated.allocations {
+		excluded[key] = true
+	}
+	gpuSlots := r.nodeSlotMaps(instaslice, excluded)
+	for _, allocation := range nominated.allocations {
+		if !gpuSlots[allocation.Result.GPUUUID].isFree(allocation.Result.MigPlacement) {
+			return nil, false, nil
+		}
+		gpuSlots[allocation.Result.GPUUUID].occupy(allocation.Result.MigPlacement)
+	}
+	return instaslice, true, nil
+}
+
+// preemptForPod nominates running pods of lower priority than the preemptor for eviction so
+// that its slices fit on a node. The placement overlapping the fewest victims is selected, only
+// the victims holding slots of that placement are nominated. The placement is nominated for
+// the preemptor, the victims are then evicted by evictForNomination once allocationMu is
+// released. The boolean is false when no preemption is possible. The caller holds
+// allocationMu.
+func (r *InstasliceReconciler) preemptForPod(ctx context.Context, instaslices []inferencev1alpha1.Instaslice, slices []sliceRequest, policy AllocationPolicy, pod *v1.Pod) (bool, error) {
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == v1.PreemptNever {
+		return false, nil
+	}
+	var selected *preemptionPlan
+	for _, instaslice := range instaslices {
+		updatedInstaSliceObject, err := r.getInstasliceObject(ctx, instaslice.Name, instaslice.Namespace)
+		if err != nil {
+			return false, err
+		}
+		// the victims of the nodes that can't hold the pod aren't evicted
+		if !r.nodeCanHoldPod(updatedInstaSliceObject, slices[0].profile, pod) {
+			continue
+		}
+		plan, err := r.planPreemption(ctx, updatedInstaSliceObject, slices, policy, pod)
+		if err != nil {
+			return false, err
+		}
+		if plan != nil && (selected == nil || plan.fewerVictims(selected)) {
+			selected = plan
+		}
+	}
+	if selected == nil {
+		return false, nil
+	}
+
+	reason := fmt.Sprintf("preempted by pod %s/%s with priority %d", pod.Namespace, pod.Name, podPriority(pod))
+	nominated := nomination{instasliceName: selected.candidate.instaslice.Name, allocations: selected.allocations}
+	for _, victim := range selected.victims {
+		nominated.evictions = append(nominated.evictions, nominatedEviction{pod: victim.pod, allocations: victim.allocations, reason: reason})
+	}
+	if r.nominations == nil {
+		r.nominations = make(map[types.UID]nomination)
+	}
+	r.nominations[pod.UID] = nominated
+	r.waitQueue.remove(client.ObjectKeyFromObject(pod))
+	return true, nil
+}
+
+// planPreemption returns the placement of the slices of the preemptor on the node that
+// overlaps the fewest victims, nil when the slices don't fit even without the victims. The
+// placements the policy selects from are the ones overlapping the fewest victims.
+func (r *InstasliceReconciler) planPreemption(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, slices []sliceRequest, policy AllocationPolicy, pod *v1.Pod) (*preemptionPlan, error) {
+	victims, err := r.preemptionVictims(ctx, instaslice, podPriority(pod))
+	if err != nil || len(victims) == 0 {
+		return nil, err
+	}
+	excluded := make(map[types.UID]bool)
+	for _, victim := range victims {
+		for _, allocation := range victim.allocations {
+			excluded[allocation.key] = true
+		}
+	}
+	var plans []*preemptionPlan
+	for _, candidate := range nodePlacementCandidates(instaslice, slices[0].profile, r.nodeSlotMaps(instaslice, excluded)) {
+		allocations, ok := r.placeSlicesOnNode(policy, candidate, slices, pod, r.nodeSlotMaps(instaslice, excluded))
+		if !ok {
+			continue
+		}
+		plan := &preemptionPlan{candidate: candidate, allocations: allocations, victims: overlappingVictims(victims, allocations)}
+		// the slices fit without preemption
+		if len(plan.victims) == 0 {
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		return nil, nil
+	}
+	fewest := plans[0]
+	for _, plan := range plans[1:] {
+		if plan.fewerVictims(fewest) {
+			fewest = plan
+		}
+	}
+	var candidates []placementCandidate
+	for _, plan := range plans {
+		if !plan.fewerVictims(fewest) && !fewest.fewerVictims(plan) {
+			candidates = append(candidates, plan.candidate)
+		}
+	}
+	candidate, ok := policy.selectPlacement(slices[0].profile, candidates)
+	if !ok {
+		return fewest, nil
+	}
+	for _, plan := range plans {
+		if plan.candidate.gpuUUID == candidate.gpuUUID && plan.candidate.placement == candidate.placement {
+			return plan, nil
+		}
+	}
+	return fewest, nil
+}
+
+// overlappingVictims returns the victims holding slots of the placements of the allocations
+func overlappingVictims(victims []preemptionVictim, allocations map[types.UID]utils.Allocation) []preemptionVictim {
+	var overlapping []preemptionVictim
+	for _, victim := range victims {
+	victimAllocations:
+		for _, victimAllocation := range victim.allocations {
+			for _, allocation := range allocations {
+				if victimAllocation.Result.GPUUUID == allocation.Result.GPUUUID &&
+					placementsOverlapAny([]inferencev1alpha1.Placement{victimAllocation.Result.MigPlacement}, []inferencev1alpha1.Placement{allocation.Result.MigPlacement}) {
+					overlapping = append(overlapping, victim)
+					break victimAllocations
+				}
+			}
+		}
+	}
+	return overlapping
+}
+
+// evictForNomination evicts the pods still holding the placement nominated for the pod. The
+// nomination keeps the pods not evicted yet, they are evicted again on the next reconcile.
+// When no pod could be evicted at all the nomination is dropped, the slices of the pod are
+// placed again. allocationMu is only held to update the nomination, the caller doesn't hold
+// it.
+func (r *InstasliceReconciler) evictForNomination(ctx context.Context, pod *v1.Pod) error {
+	log := logr.FromContext(ctx)
+	for {
+		r.allocationMu.Lock()
+		nominated, ok := r.nominations[pod.UID]
+		if !ok || len(nominated.evictions) == 0 {
+			r.allocationMu.Unlock()
+			return nil
+		}
+		eviction := nominated.evictions[0]
+		r.allocationMu.Unlock()
+
+		evictionRequest := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Name: eviction.pod.Name, Namespace: eviction.pod.Namespace}}
+		err := r.SubResource("eviction").Create(ctx, eviction.pod, evictionRequest)
+		if apierrors.IsNotFound(err) {
+			err = nil
+		}
+
+		r.allocationMu.Lock()
+		// the nomination was dropped meanwhile, with the pod
+		nominated, ok = r.nominations[pod.UID]
+		if !ok {
+			r.allocationMu.Unlock()
+			return nil
+		}
+		if err != nil {
+			// a PodDisruptionBudget doesn't allow the eviction
+			if !nominated.evicted {
+				delete(r.nominations, pod.UID)
+			}
+			r.allocationMu.Unlock()
+			return fmt.Errorf("failed to evict pod %s/%s: %w", eviction.pod.Namespace, eviction.pod.Name, err)
+		}
+		nominated.evictions = nominated.evictions[1:]
+		nominated.evicted = true
+		r.nominations[pod.UID] = nominated
+		r.allocationMu.Unlock()
+
+		log.Info("evicted pod to free slices", "evicted", eviction.pod.Name, "evictedNamespace", eviction.pod.Namespace, "pod", pod.Name, "reason", eviction.reason)
+		if len(eviction.allocations) > 0 {
+			if err := r.recordPreemption(ctx, eviction.allocations, eviction.reason); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// preemptionVictims returns the running pods of the node holding slices with a priority lower
+// than the given one, by increasing priority.
+func (r *InstasliceReconciler) preemptionVictims(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, priority int32) ([]preemptionVictim, error) {
+	podUIDs := make(map[types.UID]bool)
+	for key, allocRequest := range instaslice.Spec.PodAllocationRequests {
+		// the pods of adopted allocations can't be preempted
+		if allocationAdopted(instaslice.Status.PodAllocationResults[key]) {
+			continue
+		}
+		podUIDs[allocRequest.PodRef.UID] = true
+	}
+	var victims []preemptionVictim
+	for podUID := range podUIDs {
+		allocations := getPodAllocations([]inferencev1alpha1.Instaslice{*instaslice}, podUID)
+		if len(allocations) == 0 {
+			continue
+		}
+		ungated := true
+		for _, allocation := range allocations {
+			if allocation.Result.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusUngated {
+				ungated = false
+			}
+		}
+		if !ungated {
+			continue
+		}
+		podRef := allocations[0].Request.PodRef
+		victim := &v1.Pod{}
+		if err := r.Get(ctx, types.NamespacedName{Name: podRef.Name, Namespace: podRef.Namespace}, victim); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if victim.UID != podUID || !victim.DeletionTimestamp.IsZero() || podPriority(victim) >= priority {
+			continue
+		}
+		victims = append(victims, preemptionVictim{pod: victim, allocations: allocations})
+	}
+	sort.Slice(victims, func(i, j int) bool {
+		if podPriority(victims[i].pod) != podPriority(victims[j].pod) {
+			return podPriority(victims[i].pod) < podPriority(victims[j].pod)
+		}
+		return victims[i].pod.Name < victims[j].pod.Name
+	})
+	return victims, nil
+}
+
+// recordPreemption records why the slices of the victim are released on its allocations
+func (r *InstasliceReconciler) recordPreemption(ctx context.Context, allocations []podAllocation, reason string) error {
+	preempted := make(map[string]map[types.UID]utils.Allocation)
+	for _, allocation := range allocations {
+		meta.SetStatusCondition(&allocation.Result.Conditions, metav1.Condition{
+			Type:    PreemptedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PreemptedByHigherPriorityPod",
+			Message: reason,
+		})
+		if preempted[allocation.instasliceName] == nil {
+			preempted[allocation.instasliceName] = make(map[types.UID]utils.Allocation)
+		}
+		preempted[allocation.instasliceName][allocation.key] = allocation.Allocation
+	}
+	for instasliceName, instasliceAllocations := range preempted {
+		if err := utils.UpdateInstasliceAllocations(ctx, r.Client, instasliceName, instasliceAllocations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+func newPriorityPod(name string, priority int32, profile string, gated bool) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(name + "-uid"),
+			Labels:    map[string]string{PodLabelInstasliceMutated: InstaslicePodMutatedTrue},
+		},
+		Spec: v1.PodSpec{
+			Priority:   &priority,
+			Containers: []v1.Container{migContainer("main", profile, name+"-cm")},
+		},
+		Status: v1.PodStatus{Phase: v1.PodRunning},
+	}
+	if gated {
+		pod.Spec.SchedulingGates = []v1.PodSchedulingGate{{Name: GateName}}
+		pod.Status = v1.PodStatus{Phase: v1.PodPending, Conditions: []v1.PodCondition{{Message: "blocked"}}}
+	}
+	return pod
+}
+
+// withRunningPod stores an ungated allocation of the whole GPU for the pod
+func withRunningPod(instaslice *inferencev1alpha1.Instaslice, pod *v1.Pod, gpuUUID string) *inferencev1alpha1.Instaslice {
+	instaslice.Spec.PodAllocationRequests = map[types.UID]inferencev1alpha1.AllocationRequest{
+		pod.UID: {Profile: "7g.40gb", PodRef: v1.ObjectReference{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID}},
+	}
+	instaslice.Status.PodAllocationResults = map[types.UID]inferencev1alpha1.AllocationResult{
+		pod.UID: {
+			GPUUUID:      gpuUUID,
+			Nodename:     types.NodeName(instaslice.Name),
+			MigPlacement: inferencev1alpha1.Placement{Start: 0, Size: 8},
+			AllocationStatus: inferencev1alpha1.AllocationStatus{
+				AllocationStatusController: inferencev1alpha1.AllocationStatusUngated,
+				AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+			},
+		},
+	}
+	return instaslice
+}
+
+func listInstaslices(t *testing.T, r *InstasliceReconciler) []inferencev1alpha1.Instaslice {
+	var instasliceList inferencev1alpha1.InstasliceList
+	assert.NoError(t, r.List(context.TODO(), &instasliceList))
+	return instasliceList.Items
+}
+
+func TestPreemptForPod(t *testing.T) {
+	victim := newPriorityPod("batch", 10, "7g.40gb", false)
+	preemptor := newPriorityPod("inference", 1000, "1g.5gb", true)
+	instaslice := withRunningPod(newTestInstaslice("node-1", "gpu-a"), victim, "gpu-a")
+	r := newTestReconciler(instaslice, victim, preemptor)
+	r.allocationCache[victim.UID] = instaslice.Status.PodAllocationResults[victim.UID]
+
+	slices, err := r.podSliceRequests(preemptor)
+	assert.NoError(t, err)
+	_, _, err = r.findNodeAndDeviceForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.Error(t, err, "batch holds the whole GPU")
+
+	preempted, err := r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.True(t, preempted)
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(victim), &v1.Pod{}), "batch is only nominated")
+	assert.NoError(t, r.evictForNomination(context.TODO(), preemptor))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(victim), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "batch is evicted")
+
+	items := listInstaslices(t, r)
+	condition := meta.FindStatusCondition(items[0].Status.PodAllocationResults[victim.UID].Conditions, PreemptedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, "preempted by pod default/inference with priority 1000", condition.Message)
+	}
+
+	nominated, ok := r.nominations[preemptor.UID]
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "node-1", nominated.instasliceName)
+
+	result, err := r.allocatePod(context.TODO(), preemptor, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Equal(t, Requeue2sDelay, result.RequeueAfter)
+	assert.Empty(t, getPodAllocations(listInstaslices(t, r), preemptor.UID), "batch still holds its slice")
+
+	// the slice of batch is released, other pods can't take the nominated slot
+	delete(r.allocationCache, victim.UID)
+	released := items[0]
+	victimResult := released.Status.PodAllocationResults[victim.UID]
+	victimResult.AllocationStatus.AllocationStatusDaemonset = inferencev1alpha1.AllocationStatusDeleted
+	released.Status.PodAllocationResults[victim.UID] = victimResult
+	assert.NoError(t, r.Status().Update(context.TODO(), &released))
+	other := newPriorityPod("other", 1000, "1g.5gb", true)
+	otherSlices, err := r.podSliceRequests(other)
+	assert.NoError(t, err)
+	_, otherAllocations, err := r.findNodeAndDeviceForPod(context.TODO(), items, otherSlices, &FirstFitPolicy{}, other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, nominated.allocations[preemptor.UID].Result.MigPlacement, otherAllocations[other.UID].Result.MigPlacement)
+
+	result, err = r.allocatePod(context.TODO(), preemptor, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter)
+	assert.NotContains(t, r.nominations, preemptor.UID)
+	assert.Empty(t, r.reserving)
+	allocations := getPodAllocations(listInstaslices(t, r), preemptor.UID)
+	if assert.Len(t, allocations, 1) {
+		assert.Equal(t, nominated.allocations[preemptor.UID].Result.MigPlacement, allocations[0].Result.MigPlacement)
+	}
+}
+
+func TestPreemptForPodEvictsOnlyOverlappingVictims(t *testing.T) {
+	first := newPriorityPod("first", 10, "1g.5gb", false)
+	second := newPriorityPod("second", 5, "1g.5gb", false)
+	third := newPriorityPod("third", 1, "1g.5gb", false)
+	preemptor := newPriorityPod("inference", 1000, "3g.20gb", true)
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withRunningSlice(instaslice, first, "gpu-a", 0)
+	withRunningSlice(instaslice, second, "gpu-a", 4)
+	withRunningSlice(instaslice, third, "gpu-a", 5)
+	r := newTestReconciler(instaslice, first, second, third, preemptor)
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+	slices, err := r.podSliceRequests(preemptor)
+	assert.NoError(t, err)
+
+	// the lowest priority pods hold the second placement of the profile, first holds the other one alone
+	preempted, err := r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.True(t, preempted)
+	assert.NoError(t, r.evictForNomination(context.TODO(), preemptor))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(first), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "first is evicted")
+	for _, pod := range []*v1.Pod{second, third} {
+		assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(pod), &v1.Pod{}), pod.Name)
+	}
+	if assert.Contains(t, r.nominations, preemptor.UID) {
+		allocation := r.nominations[preemptor.UID].allocations[allocationKey(preemptor.UID, 0, slices[0])]
+		assert.Equal(t, inferencev1alpha1.Placement{Start: 0, Size: 4}, allocation.Result.MigPlacement)
+	}
+}
+
+func TestPreemptForPodKeepsNominationWhenEvictionFails(t *testing.T) {
+	first := newPriorityPod("first", 10, "1g.5gb", false)
+	second := newPriorityPod("second", 20, "1g.5gb", false)
+	holder := newPriorityPod("holder", 2000, "1g.5gb", false)
+	preemptor := newPriorityPod("inference", 1000, "3g.20gb", true)
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withRunningSlice(instaslice, first, "gpu-a", 0)
+	withRunningSlice(instaslice, second, "gpu-a", 1)
+	withRunningSlice(instaslice, holder, "gpu-a", 4)
+	r := newTestReconciler(instaslice, first, second, holder, preemptor)
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+	// a PodDisruptionBudget protects second
+	protected := map[string]bool{second.Name: true}
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		SubResourceCreate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, subResource client.Object, opts ...client.SubResourceCreateOption) error {
+			if subResourceName == "eviction" && protected[obj.GetName()] {
+				return apierrors.NewTooManyRequestsError("the PodDisruptionBudget doesn't allow the eviction")
+			}
+			return c.SubResource(subResourceName).Create(ctx, obj, subResource, opts...)
+		},
+	})
+	slices, err := r.podSliceRequests(preemptor)
+	assert.NoError(t, err)
+
+	preempted, err := r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.True(t, preempted)
+	assert.Error(t, r.evictForNomination(context.TODO(), preemptor))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(first), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "first is evicted")
+	nominated, ok := r.nominations[preemptor.UID]
+	if assert.True(t, ok, "the slots freed by first are kept for the preemptor") && assert.Len(t, nominated.evictions, 1) {
+		assert.Equal(t, second.Name, nominated.evictions[0].pod.Name)
+	}
+
+	// the eviction is allowed again
+	delete(protected, second.Name)
+	assert.NoError(t, r.evictForNomination(context.TODO(), preemptor))
+	err = r.Get(context.TODO(), client.ObjectKeyFromObject(second), &v1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err), "second is evicted")
+	assert.Empty(t, r.nominations[preemptor.UID].evictions)
+
+	// nothing is freed when no victim can be evicted
+	delete(r.nominations, preemptor.UID)
+	protected[first.Name] = true
+	assert.NoError(t, r.Create(context.TODO(), newPriorityPod("first", 10, "1g.5gb", false)))
+	assert.NoError(t, r.Create(context.TODO(), newPriorityPod("second", 20, "1g.5gb", false)))
+	preempted, err = r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.True(t, preempted)
+	assert.Error(t, r.evictForNomination(context.TODO(), preemptor))
+	assert.NotContains(t, r.nominations, preemptor.UID)
+}
+
+func TestPreemptForPodSkipsNodesThatCantHoldThePod(t *testing.T) {
+	victim := newPriorityPod("batch", 10, "7g.40gb", false)
+	preemptor := newPriorityPod("inference", 1000, "1g.5gb", true)
+	notReady := withRunningPod(newTestInstaslice("node-1", "gpu-a"), victim, "gpu-a")
+	notReady.Status.Conditions = []metav1.Condition{{
+		Type:               NodeReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             "DriverError",
+		LastTransitionTime: metav1.Now(),
+	}}
+	r := newTestReconciler(notReady, victim, preemptor)
+	r.allocationCache[victim.UID] = notReady.Status.PodAllocationResults[victim.UID]
+	slices, err := r.podSliceRequests(preemptor)
+	assert.NoError(t, err)
+
+	preempted, err := r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.False(t, preempted, "node-1 is not ready")
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(victim), &v1.Pod{}))
+
+	preemptor.Spec.NodeSelector = map[string]string{"pool": "inference"}
+	ready := listInstaslices(t, r)[0]
+	ready.Status.Conditions = nil
+	assert.NoError(t, r.Status().Update(context.TODO(), &ready))
+	preempted, err = r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.False(t, preempted, "the pod doesn't select node-1")
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(victim), &v1.Pod{}))
+	assert.Empty(t, r.nominations)
+}
+
+func TestPreemptForPodSkipsHigherPriorityHolders(t *testing.T) {
+	holder := newPriorityPod("inference", 1000, "7g.40gb", false)
+	pod := newPriorityPod("batch", 10, "1g.5gb", true)
+	instaslice := withRunningPod(newTestInstaslice("node-1", "gpu-a"), holder, "gpu-a")
+	r := newTestReconciler(instaslice, holder, pod)
+	r.allocationCache[holder.UID] = instaslice.Status.PodAllocationResults[holder.UID]
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+
+	preempted, err := r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, pod)
+	assert.NoError(t, err)
+	assert.False(t, preempted)
+
+	never := v1.PreemptNever
+	preemptor := newPriorityPod("urgent", 2000, "1g.5gb", true)
+	preemptor.Spec.PreemptionPolicy = &never
+	preempted, err = r.preemptForPod(context.TODO(), listInstaslices(t, r), slices, &FirstFitPolicy{}, preemptor)
+	assert.NoError(t, err)
+	assert.False(t, preempted, "the pod never preempts")
+	assert.NoError(t, r.Get(context.TODO(), client.ObjectKeyFromObject(holder), &v1.Pod{}))
+}
@@ -26,6 +26,7 @@ type InstasliceMetrics struct {
 	compatibleProfiles *prometheus.GaugeVec
 	processedSlices    *prometheus.GaugeVec
 	deployedPodTotal   *prometheus.GaugeVec
+	cacheDivergences   *prometheus.CounterVec
 }
 
 var (
@@ -48,13 +49,19 @@ var (
 			Help: "Number of total processed GPU slices since instaslice controller start time.",
 		},
 			[]string{"node", "gpu_id"}), // Labels: node, GPU ID
+		// allocations the cache disagreed with the Instaslice objects on
+		cacheDivergences: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "instaslice_allocation_cache_divergences_total",
+			Help: "Allocations found missing, stale or mismatched in the allocation cache by the periodic check.",
+		},
+			[]string{"kind"}), // Labels: kind
 	}
 )
 
 // RegisterMetrics registers all Prometheus metrics
 func RegisterMetrics() {
 	// Register custom metrics with the global prometheus registry
-	metrics.Registry.MustRegister(instasliceMetrics.compatibleProfiles, instasliceMetrics.processedSlices, instasliceMetrics.deployedPodTotal)
+	metrics.Registry.MustRegister(instasliceMetrics.compatibleProfiles, instasliceMetrics.processedSlices, instasliceMetrics.deployedPodTotal, instasliceMetrics.cacheDivergences)
 }
 
 // UpdateGpuSliceMetrics updates GPU slice allocation metrics
@@ -73,6 +80,8 @@ func (r *InstasliceReconciler) UpdateDeployedPodTotalMetrics(nodeName, gpuID, na
 // UpdateCompatibleProfilesMetrics updates metrics based on remaining GPU slices and calculates compatible profiles dynamically
 // TODO: store metrics per gpu and when there is an update, calculate a fit for only one GPU instead of all GPUs on the host
 func (r *InstasliceReconciler) UpdateCompatibleProfilesMetrics(instasliceObj inferencev1alpha1.Instaslice, nodeName string) {
+	r.allocationMu.Lock()
+	defer r.allocationMu.Unlock()
 	sortedGPUs := sortGPUs(&instasliceObj)
 	// Iterate over each profile
 	for profileName, migPlacement := range instasliceObj.Status.NodeResources.MigPlacement {
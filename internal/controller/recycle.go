@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sort"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The slice of a completed pod is deleted by the daemonset and created again for the next pod
+// of the same profile. With recycling enabled, it is handed over to a gated pod of the same
+// profile instead: the freed allocation is set to deleting with the Recycled condition, which
+// keeps the daemonset from destroying the slice, and the waiting pod is allocated the same
+// placement. The daemonset finds the slice created and only writes the configmap of the pod.
+
+// reasonSliceHandedOver is the reason of the Recycled condition of freed allocations
+const reasonSliceHandedOver = "SliceHandedOver"
+
+// allocationRecycled reports whether the slice of the allocation was handed over to another pod
+func allocationRecycled(allocResult inferencev1alpha1.AllocationResult) bool {
+	return meta.IsStatusConditionTrue(allocResult.Conditions, RecycledCondition)
+}
+
+// recycleSlice hands the slice of the allocation of a completed pod over to a waiting pod of
+// the same profile. The boolean is false when recycling is disabled or no waiting pod takes
+// the slice, the allocation is then to be deleted as usual.
+func (r *InstasliceReconciler) recycleSlice(ctx context.Context, allocation podAllocation) (bool, error) {
+	log := logr.FromContext(ctx)
+	status := allocation.Result.AllocationStatus
+	if r.Config == nil || !r.Config.SliceRecyclingEnable ||
+		status.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusCreated ||
+		status.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting {
+		return false, nil
+	}
+	instaslice, err := r.getInstasliceObject(ctx, allocation.instasliceName, InstaSliceOperatorNamespace)
+	if err != nil {
+		return false, err
+	}
+	// the slices of an unhealthy GPU are deleted
+	if !instasliceReady(instaslice) || !gpuHealthy(instaslice, allocation.Result.GPUUUID) {
+		return false, nil
+	}
+	recipients, err := r.recyclingRecipients(ctx, allocation)
+	if err != nil {
+		return false, err
+	}
+	for _, recipient := range recipients {
+		recycled, err := r.handOverSlice(ctx, instaslice, allocation, recipient)
+		if err != nil || recycled {
+			return recycled, err
+		}
+	}
+	log.V(1).Info("no waiting pod takes the slice", "pod", allocation.Request.PodRef.Name, "profile", allocation.Request.Profile)
+	return false, nil
+}
+
+// recyclingRecipients returns the gated pods waiting for a single slice of the profile of the
+// allocation that fit its node, by priority then by age. Pod groups and preemptors are
+// allocated their own way and don't take recycled slices.
+func (r *InstasliceReconciler) recyclingRecipients(ctx context.Context, allocation podAllocation) ([]*v1.Pod, error) {
+	var podList v1.PodList
+	if err := r.List(ctx, &podList, client.MatchingLabels{PodLabelInstasliceMutated: InstaslicePodMutatedTrue}); err != nil {
+		return nil, err
+	}
+	var recipients []*v1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.UID == allocation.Request.PodRef.UID || !pod.DeletionTimestamp.IsZero() || !checkIfPodGatedByInstaSlice(pod) {
+			continue
+		}
+		if _, ok := pod.Labels[PodGroupLabel]; ok {
+			continue
+		}
+		slices, err := r.podSliceRequests(pod)
+		if err != nil || len(slices) != 1 || slices[0].profile != allocation.Request.Profile {
+			continue
+		}
+		if !r.nodeFitsPod(string(allocation.Result.Nodename), pod) {
+			continue
+		}
+		podInstaslices, err := r.getPodInstaslices(ctx, pod.UID)
+		if err != nil {
+			return nil, err
+		}
+		if len(getPodAllocations(podInstaslices, pod.UID)) > 0 {
+			continue
+		}
+		recipients = append(recipients, pod)
+	}
+	sort.Slice(recipients, func(i, j int) bool {
+		a, b := recipients[i], recipients[j]
+		if podPriority(a) != podPriority(b) {
+			return podPriority(a) > podPriority(b)
+		}
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+		return a.Name < b.Name
+	})
+	return recipients, nil
+}
+
+// handOverSlice stores the allocation of the recipient at the placement of the freed
+// allocation and sets the freed one to deleting. The new allocation is reserved in the cache
+// first, so that the reconcile of the recipient doesn't place it elsewhere. The boolean is
+// false when the recipient got slices meanwhile or the freed allocation progressed.
+func (r *InstasliceReconciler) handOverSlice(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, freed podAllocation, recipient *v1.Pod) (bool, error) {
+	log := logr.FromContext(ctx)
+	slices, err := r.podSliceRequests(recipient)
+	if err != nil {
+		return false, err
+	}
+	policy, err := r.allocationPolicyForPod(ctx, recipient)
+	if err != nil {
+		return false, err
+	}
+	allocRequest, allocResult := r.setAllocationDetails(policy, instaslice, slices[0], freed.Result.GPUUUID, freed.Result.MigPlacement.Start, recipient)
+	key := allocationKey(recipient.UID, 0, slices[0])
+	allocation := utils.Allocation{Request: *allocRequest, Result: *allocResult}
+
+	r.allocationMu.Lock()
+	_, nominated := r.nominations[recipient.UID]
+	if _, ok := r.allocationCache[key]; ok || nominated {
+		r.allocationMu.Unlock()
+		return false, nil
+	}
+	r.reserveInCache(map[types.UID]utils.Allocation{key: allocation})
+	r.allocationMu.Unlock()
+
+	freedResult := *freed.Result.DeepCopy()
+	freedResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+	meta.SetStatusCondition(&freedResult.Conditions, metav1.Condition{
+		Type:    RecycledCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonSliceHandedOver,
+		Message: fmt.Sprintf("The slice is handed over to pod %s/%s.", recipient.Namespace, recipient.Name),
+	})
+	err = utils.RecycleInstasliceAllocation(ctx, r.Client, freed.instasliceName, freed.key, freedResult, key, allocation)
+
+	r.allocationMu.Lock()
+	delete(r.reserving, key)
+	if err != nil {
+		r.forgetCachedAllocation(key)
+		r.allocationMu.Unlock()
+		if stderrors.Is(err, utils.ErrAllocationProgressed) {
+			log.Info("the slice can't be recycled", "pod", freed.Request.PodRef.Name, "reason", err.Error())
+			return false, nil
+		}
+		return false, err
+	}
+	r.forgetCachedAllocation(freed.key)
+	r.recordNewAllocations(map[types.UID]utils.Allocation{key: allocation})
+	r.allocationMu.Unlock()
+
+	placement := describeAllocations(map[types.UID]inferencev1alpha1.AllocationResult{key: allocation.Result})
+	log.Info("slice recycled", "pod", freed.Request.PodRef.Name, "recipient", recipient.Name, "placement", placement)
+	r.recordPodRefEvent(freed.Request.PodRef, v1.EventTypeNormal, ReasonSliceRecycled,
+		fmt.Sprintf("slice handed over to pod %s/%s: %s", recipient.Namespace, recipient.Name, placement))
+	r.reportSlicesStatus(ctx, recipient, v1.ConditionFalse, v1.EventTypeNormal, ReasonSliceRecycled,
+		fmt.Sprintf("slice recycled from pod %s/%s, waiting for the daemonset to configure it: %s", freed.Request.PodRef.Namespace, freed.Request.PodRef.Name, placement))
+	return true, nil
+}
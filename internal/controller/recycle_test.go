@@ -0,0 +1,102 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// newRecyclingReconciler returns a reconciler where the completed pod holds a created slice
+// on gpu-a and the waiting pods are gated
+func newRecyclingReconciler(completed *v1.Pod, waiting ...*v1.Pod) (*InstasliceReconciler, podAllocation) {
+	completed.Status.Phase = v1.PodSucceeded
+	instaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a"), completed, "gpu-a", 2)
+	objects := []client.Object{instaslice, completed}
+	for _, pod := range waiting {
+		objects = append(objects, pod)
+	}
+	r := newTestReconciler(objects...)
+	r.Config.SliceRecyclingEnable = true
+	r.allocationCache[completed.UID] = instaslice.Status.PodAllocationResults[completed.UID]
+	return r, getPodAllocations([]inferencev1alpha1.Instaslice{*instaslice}, completed.UID)[0]
+}
+
+func TestRecycleSliceHandsOverToWaitingPod(t *testing.T) {
+	completed := newPriorityPod("completed", 0, "1g.5gb", false)
+	older := newPriorityPod("older", 0, "1g.5gb", true)
+	older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+	newer := newPriorityPod("newer", 0, "1g.5gb", true)
+	newer.CreationTimestamp = metav1.NewTime(time.Now())
+	other := newPriorityPod("other-profile", 10, "2g.10gb", true)
+	r, allocation := newRecyclingReconciler(completed, newer, older, other)
+
+	recycled, err := r.recycleSlice(context.TODO(), allocation)
+	assert.NoError(t, err)
+	assert.True(t, recycled)
+
+	instaslice := getInstaslice(t, r, "node-1")
+	freed := instaslice.Status.PodAllocationResults[completed.UID]
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, freed.AllocationStatus.AllocationStatusController)
+	assert.True(t, meta.IsStatusConditionTrue(freed.Conditions, RecycledCondition))
+	handedOver, ok := instaslice.Status.PodAllocationResults[older.UID]
+	if assert.True(t, ok, "the oldest waiting pod of the profile gets the slice") {
+		assert.Equal(t, freed.GPUUUID, handedOver.GPUUUID)
+		assert.Equal(t, freed.MigPlacement, handedOver.MigPlacement)
+		assert.Equal(t, inferencev1alpha1.AllocationStatusCreating, handedOver.AllocationStatus.AllocationStatusController)
+		assert.Equal(t, older.UID, instaslice.Spec.PodAllocationRequests[older.UID].PodRef.UID)
+	}
+	assert.NotContains(t, r.allocationCache, completed.UID)
+	assert.Contains(t, r.allocationCache, older.UID)
+	assert.Empty(t, r.reserving)
+	assert.NotContains(t, cachedAllocations([]inferencev1alpha1.Instaslice{*instaslice}), completed.UID, "recycled allocations don't hold slots")
+
+	// the freed allocation is deleting and isn't recycled twice
+	allocation = getPodAllocations([]inferencev1alpha1.Instaslice{*instaslice}, completed.UID)[0]
+	recycled, err = r.recycleSlice(context.TODO(), allocation)
+	assert.NoError(t, err)
+	assert.False(t, recycled)
+}
+
+func TestRecycleSliceWithoutRecipient(t *testing.T) {
+	completed := newPriorityPod("completed", 0, "1g.5gb", false)
+	other := newPriorityPod("other-profile", 0, "2g.10gb", true)
+	running := newPriorityPod("running", 0, "1g.5gb", false)
+	r, allocation := newRecyclingReconciler(completed, other, running)
+
+	recycled, err := r.recycleSlice(context.TODO(), allocation)
+	assert.NoError(t, err)
+	assert.False(t, recycled)
+
+	waiting := newPriorityPod("waiting", 0, "1g.5gb", true)
+	r, allocation = newRecyclingReconciler(completed.DeepCopy(), waiting)
+	r.Config.SliceRecyclingEnable = false
+	recycled, err = r.recycleSlice(context.TODO(), allocation)
+	assert.NoError(t, err)
+	assert.False(t, recycled, "recycling is disabled")
+	results := getInstaslice(t, r, "node-1").Status.PodAllocationResults
+	assert.Equal(t, inferencev1alpha1.AllocationStatusUngated, results[completed.UID].AllocationStatus.AllocationStatusController)
+	assert.NotContains(t, results, waiting.UID)
+}
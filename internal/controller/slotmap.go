@@ -0,0 +1,90 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// slotMap tracks the occupied memory slots of a single GPU. The number of
+// slots is derived from the MIG placements discovered on the node, so that
+// A100/H100/H200 (8 slots), A30 (4 slots) and any future model are handled
+// the same way.
+type slotMap []bool
+
+// newSlotMap returns an empty slot map large enough to hold every placement
+// discovered for the node.
+func newSlotMap(migPlacement map[string]inferencev1alpha1.Mig) slotMap {
+	var size int32
+	for _, mig := range migPlacement {
+		for _, placement := range mig.Placements {
+			if end := placement.Start + placement.Size; end > size {
+				size = end
+			}
+		}
+	}
+	return make(slotMap, size)
+}
+
+// isFree reports whether every slot covered by the placement is available.
+func (s slotMap) isFree(placement inferencev1alpha1.Placement) bool {
+	if placement.Size <= 0 || placement.Start < 0 || int(placement.Start+placement.Size) > len(s) {
+		return false
+	}
+	for i := placement.Start; i < placement.Start+placement.Size; i++ {
+		if s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// occupy marks the slots covered by the placement as used. Slots outside of
+// the map are ignored.
+func (s slotMap) occupy(placement inferencev1alpha1.Placement) {
+	for i := placement.Start; i < placement.Start+placement.Size; i++ {
+		if i >= 0 && int(i) < len(s) {
+			s[i] = true
+		}
+	}
+}
+
+// used returns the number of occupied slots.
+func (s slotMap) used() int32 {
+	var n int32
+	for _, occupied := range s {
+		if occupied {
+			n++
+		}
+	}
+	return n
+}
+
+// full reports whether no slot is available.
+func (s slotMap) full() bool {
+	return s.used() == int32(len(s))
+}
+
+// firstFit returns the first of the given placements that is free on the
+// slot map. The boolean is false when none of the placements fit.
+func (s slotMap) firstFit(placements []inferencev1alpha1.Placement) (inferencev1alpha1.Placement, bool) {
+	for _, placement := range placements {
+		if s.isFree(placement) {
+			return placement, true
+		}
+	}
+	return inferencev1alpha1.Placement{}, false
+}
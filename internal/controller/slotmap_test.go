@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// a30MigPlacement mirrors the placements NVML reports for an A30 (4 slots).
+func a30MigPlacement() map[string]inferencev1alpha1.Mig {
+	return map[string]inferencev1alpha1.Mig{
+		"1g.6gb": {Placements: []inferencev1alpha1.Placement{
+			{Size: 1, Start: 0}, {Size: 1, Start: 1}, {Size: 1, Start: 2}, {Size: 1, Start: 3},
+		}},
+		"2g.12gb": {Placements: []inferencev1alpha1.Placement{{Size: 2, Start: 0}, {Size: 2, Start: 2}}},
+		"4g.24gb": {Placements: []inferencev1alpha1.Placement{{Size: 4, Start: 0}}},
+	}
+}
+
+// a100MigPlacement mirrors the placements NVML reports for an A100 40GB (8 slots).
+func a100MigPlacement() map[string]inferencev1alpha1.Mig {
+	return map[string]inferencev1alpha1.Mig{
+		"1g.5gb": {Placements: []inferencev1alpha1.Placement{
+			{Size: 1, Start: 0}, {Size: 1, Start: 1}, {Size: 1, Start: 2}, {Size: 1, Start: 3},
+			{Size: 1, Start: 4}, {Size: 1, Start: 5}, {Size: 1, Start: 6},
+		}},
+		"2g.10gb": {Placements: []inferencev1alpha1.Placement{{Size: 2, Start: 0}, {Size: 2, Start: 2}, {Size: 2, Start: 4}}},
+		"3g.20gb": {Placements: []inferencev1alpha1.Placement{{Size: 4, Start: 0}, {Size: 4, Start: 4}}},
+		"4g.20gb": {Placements: []inferencev1alpha1.Placement{{Size: 4, Start: 0}}},
+		"7g.40gb": {Placements: []inferencev1alpha1.Placement{{Size: 8, Start: 0}}},
+	}
+}
+
+func TestNewSlotMapSize(t *testing.T) {
+	assert.Len(t, newSlotMap(a30MigPlacement()), 4)
+	assert.Len(t, newSlotMap(a100MigPlacement()), 8)
+	assert.Len(t, newSlotMap(nil), 0)
+}
+
+func TestSlotMapIsFree(t *testing.T) {
+	slots := newSlotMap(a30MigPlacement())
+	slots.occupy(inferencev1alpha1.Placement{Start: 2, Size: 1})
+
+	assert.True(t, slots.isFree(inferencev1alpha1.Placement{Start: 0, Size: 2}))
+	assert.False(t, slots.isFree(inferencev1alpha1.Placement{Start: 2, Size: 2}))
+	assert.False(t, slots.isFree(inferencev1alpha1.Placement{Start: 3, Size: 2}), "placement beyond the slot map")
+	assert.False(t, slots.isFree(inferencev1alpha1.Placement{Start: 0, Size: 0}), "empty placement")
+	assert.Equal(t, int32(1), slots.used())
+}
+
+func TestGetStartIndexFromAllocationResultsNoPlacement(t *testing.T) {
+	instaslice := &inferencev1alpha1.Instaslice{
+		Status: inferencev1alpha1.InstasliceStatus{
+			NodeResources: inferencev1alpha1.DiscoveredNodeResources{MigPlacement: a30MigPlacement()},
+		},
+	}
+	r := &InstasliceReconciler{}
+	slots := newSlotMap(instaslice.Status.NodeResources.MigPlacement)
+	slots.occupy(inferencev1alpha1.Placement{Start: 1, Size: 1})
+
+	_, ok := r.getStartIndexFromAllocationResults(instaslice, "4g.24gb", slots, nil, true)
+	assert.False(t, ok, "4g.24gb needs the whole A30")
+
+	start, ok := r.getStartIndexFromAllocationResults(instaslice, "2g.12gb", slots, nil, true)
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), start)
+
+	_, ok = r.getStartIndexFromAllocationResults(instaslice, "unknown", slots, nil, true)
+	assert.False(t, ok, "unknown profile")
+}
+
+func TestCalculateProfileFitOnGPUUsesDiscoveredSlots(t *testing.T) {
+	instaslice := &inferencev1alpha1.Instaslice{
+		Status: inferencev1alpha1.InstasliceStatus{
+			NodeResources: inferencev1alpha1.DiscoveredNodeResources{MigPlacement: a30MigPlacement()},
+		},
+	}
+	r := &InstasliceReconciler{
+		allocationCache: map[types.UID]inferencev1alpha1.AllocationResult{
+			"pod-1": {GPUUUID: "gpu-a30", MigPlacement: inferencev1alpha1.Placement{Start: 0, Size: 1}},
+			"pod-2": {
+				GPUUUID:          "gpu-a30",
+				MigPlacement:     inferencev1alpha1.Placement{Start: 1, Size: 1},
+				AllocationStatus: inferencev1alpha1.AllocationStatus{AllocationStatusDaemonset: inferencev1alpha1.AllocationStatusDeleted},
+			},
+		},
+	}
+
+	fit, err := r.calculateProfileFitOnGPU(instaslice, "1g.6gb", "gpu-a30", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), fit, "deleted allocations are reusable")
+
+	fit, err = r.calculateProfileFitOnGPU(instaslice, "2g.12gb", "gpu-a30", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), fit)
+
+	fit, err = r.calculateProfileFitOnGPU(instaslice, "4g.24gb", "gpu-a30", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), fit)
+
+	fit, err = r.calculateProfileFitOnGPU(instaslice, "4g.24gb", "gpu-other", true, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), fit)
+}
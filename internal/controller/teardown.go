@@ -0,0 +1,133 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The slices of a deleted pod are kept while its containers drain. They are released once the
+// containers terminated or, at the latest, when the teardown delay elapsed since the deletion
+// was requested.
+
+// parseTeardownDelay parses the teardown delay requested for a pod, a non-negative duration
+func parseTeardownDelay(value string) (time.Duration, error) {
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf("invalid teardown delay %q, a non-negative duration such as 45s is expected", value)
+	}
+	return delay, nil
+}
+
+// requestedTeardownDelay returns the teardown delay requested by the pod annotation or, when
+// the pod has none, by the label of its namespace. The namespace may be nil.
+func requestedTeardownDelay(pod *v1.Pod, namespace *v1.Namespace) (string, bool) {
+	values := requestedTeardownDelays(pod, namespace)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// requestedTeardownDelays returns the teardown delays requested for the pod, the pod
+// annotation first and then the namespace label.
+func requestedTeardownDelays(pod *v1.Pod, namespace *v1.Namespace) []string {
+	var values []string
+	if value, ok := pod.Annotations[TeardownDelayAnnotation]; ok {
+		values = append(values, value)
+	}
+	if namespace != nil {
+		if value, ok := namespace.Labels[TeardownDelayLabel]; ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// podGracePeriod returns the grace period of the deletion of the pod, its
+// terminationGracePeriodSeconds when the deletion didn't set one
+func podGracePeriod(pod *v1.Pod) time.Duration {
+	switch {
+	case pod.DeletionGracePeriodSeconds != nil:
+		return time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second
+	case pod.Spec.TerminationGracePeriodSeconds != nil:
+		return time.Duration(*pod.Spec.TerminationGracePeriodSeconds) * time.Second
+	}
+	return v1.DefaultTerminationGracePeriodSeconds * time.Second
+}
+
+// deletionRequestedAt returns when the deletion of the pod was requested. The deletion
+// timestamp is set to the end of the grace period of the deletion.
+func deletionRequestedAt(pod *v1.Pod) time.Time {
+	requestedAt := pod.DeletionTimestamp.Time
+	if pod.DeletionGracePeriodSeconds != nil {
+		requestedAt = requestedAt.Add(-time.Duration(*pod.DeletionGracePeriodSeconds) * time.Second)
+	}
+	return requestedAt
+}
+
+// teardownRemaining returns how long the slices of the deleted pod are still kept at the
+// given time, they are released when it isn't positive.
+func (r *InstasliceReconciler) teardownRemaining(ctx context.Context, pod *v1.Pod, now time.Time) (time.Duration, error) {
+	delay, err := r.teardownDelay(ctx, pod)
+	if err != nil {
+		return 0, err
+	}
+	return delay - now.Sub(deletionRequestedAt(pod)), nil
+}
+
+// teardownDelay returns how long the slices of the deleted pod are kept after its deletion
+// was requested, in order of precedence from the pod annotation, the namespace label and the
+// grace period of the pod. Invalid delays are rejected by the webhook, if one still shows up
+// it is skipped.
+func (r *InstasliceReconciler) teardownDelay(ctx context.Context, pod *v1.Pod) (time.Duration, error) {
+	log := logr.FromContext(ctx)
+
+	namespace, err := getNamespace(ctx, r.Client, pod.Namespace)
+	if err != nil {
+		return 0, err
+	}
+	for _, value := range requestedTeardownDelays(pod, namespace) {
+		delay, err := parseTeardownDelay(value)
+		if err == nil {
+			return delay, nil
+		}
+		log.Error(err, "ignoring the teardown delay requested for the pod", "pod", pod.Name, "namespace", pod.Namespace)
+	}
+	return podGracePeriod(pod), nil
+}
+
+// podContainersTerminated reports whether no container of the pod can use its slices anymore:
+// the pod was never bound to a node, it completed or all its containers terminated
+func podContainersTerminated(pod *v1.Pod) bool {
+	if pod.Spec.NodeName == "" || pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return true
+	}
+	if len(pod.Status.ContainerStatuses) < len(pod.Spec.Containers) {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Terminated == nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTeardownDelay(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+	newPod := func(namespace string, annotations map[string]string, gracePeriod, deletionGracePeriod *int64) *v1.Pod {
+		pod := newPriorityPod("inference", 0, "1g.5gb", false)
+		pod.Namespace, pod.Annotations = namespace, annotations
+		pod.Spec.TerminationGracePeriodSeconds = gracePeriod
+		pod.DeletionGracePeriodSeconds = deletionGracePeriod
+		return pod
+	}
+	r := newTestReconciler(
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "batch", Labels: map[string]string{TeardownDelayLabel: "0s"}}},
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "broken", Labels: map[string]string{TeardownDelayLabel: "soon"}}},
+	)
+
+	tests := []struct {
+		name  string
+		pod   *v1.Pod
+		delay time.Duration
+	}{
+		{"default grace period", newPod("default", nil, nil, nil), 30 * time.Second},
+		{"pod grace period", newPod("default", nil, seconds(120), nil), 2 * time.Minute},
+		{"grace period of the deletion", newPod("default", nil, seconds(120), seconds(5)), 5 * time.Second},
+		{"namespace label", newPod("batch", nil, seconds(120), nil), 0},
+		{"pod annotation overrides namespace label", newPod("batch", map[string]string{TeardownDelayAnnotation: "10m"}, nil, nil), 10 * time.Minute},
+		{"invalid namespace label", newPod("broken", nil, seconds(45), nil), 45 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, err := r.teardownDelay(context.TODO(), tt.pod)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.delay, delay)
+		})
+	}
+
+	_, err := parseTeardownDelay("-5s")
+	assert.Error(t, err)
+}
+
+func TestTeardownRemaining(t *testing.T) {
+	seconds := func(s int64) *int64 { return &s }
+	now := time.Now()
+	// the deletion timestamp is the end of the grace period of the deletion
+	newDeletedPod := func(annotations map[string]string, gracePeriod int64) *v1.Pod {
+		pod := newPriorityPod("inference", 0, "1g.5gb", false)
+		pod.Annotations = annotations
+		pod.DeletionGracePeriodSeconds = seconds(gracePeriod)
+		deletionTimestamp := metav1.NewTime(now.Add(time.Duration(gracePeriod) * time.Second))
+		pod.DeletionTimestamp = &deletionTimestamp
+		return pod
+	}
+	r := newTestReconciler()
+
+	// the grace period is waited once, from the deletion request
+	remaining, err := r.teardownRemaining(context.TODO(), newDeletedPod(nil, 30), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, remaining)
+	remaining, err = r.teardownRemaining(context.TODO(), newDeletedPod(nil, 30), now.Add(30*time.Second))
+	assert.NoError(t, err)
+	assert.Zero(t, remaining)
+
+	// the slices are released right away
+	remaining, err = r.teardownRemaining(context.TODO(), newDeletedPod(map[string]string{TeardownDelayAnnotation: "0s"}, 30), now)
+	assert.NoError(t, err)
+	assert.Zero(t, remaining)
+}
+
+func TestPodContainersTerminated(t *testing.T) {
+	running := v1.ContainerStatus{Name: "main", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}
+	terminated := v1.ContainerStatus{Name: "main", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 0}}}
+	newPod := func(nodeName string, statuses ...v1.ContainerStatus) *v1.Pod {
+		pod := newPriorityPod("inference", 0, "1g.5gb", false)
+		pod.Spec.NodeName = nodeName
+		pod.Status.ContainerStatuses = statuses
+		return pod
+	}
+
+	assert.True(t, podContainersTerminated(newPod("")), "the pod never ran")
+	assert.False(t, podContainersTerminated(newPod("node-1")), "the containers didn't report yet")
+	assert.False(t, podContainersTerminated(newPod("node-1", running)))
+	assert.True(t, podContainersTerminated(newPod("node-1", terminated)))
+	completed := newPod("node-1", running)
+	completed.Status.Phase = v1.PodSucceeded
+	assert.True(t, podContainersTerminated(completed))
+}
@@ -18,14 +18,17 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	logr "sigs.k8s.io/controller-runtime/pkg/log"
@@ -33,7 +36,26 @@ import (
 
 const InstaSliceOperatorNamespace = "instaslice-system"
 
-func UpdateOrDeleteInstasliceAllocations(ctx context.Context, kubeClient client.Client, name string, allocResult *inferencev1alpha1.AllocationResult, allocRequest *inferencev1alpha1.AllocationRequest) error {
+// Allocation is an allocation request and its result, stored under the same key in the
+// spec and the status of an Instaslice object.
+type Allocation struct {
+	Request inferencev1alpha1.AllocationRequest
+	Result  inferencev1alpha1.AllocationResult
+}
+
+// UpdateOrDeleteInstasliceAllocations stores the allocation under the key and removes the
+// allocations deleted by the daemonset. Nil allocations only remove the deleted ones.
+func UpdateOrDeleteInstasliceAllocations(ctx context.Context, kubeClient client.Client, name string, key types.UID, allocResult *inferencev1alpha1.AllocationResult, allocRequest *inferencev1alpha1.AllocationRequest) error {
+	allocations := map[types.UID]Allocation{}
+	if allocRequest != nil && allocResult != nil && key != "" {
+		allocations[key] = Allocation{Request: *allocRequest, Result: *allocResult}
+	}
+	return UpdateInstasliceAllocations(ctx, kubeClient, name, allocations)
+}
+
+// UpdateInstasliceAllocations stores all the allocations under their key with a single patch
+// of the spec and of the status, and removes the allocations deleted by the daemonset.
+func UpdateInstasliceAllocations(ctx context.Context, kubeClient client.Client, name string, allocations map[types.UID]Allocation) error {
 	var newInstaslice inferencev1alpha1.Instaslice
 	typeNamespacedName := types.NamespacedName{
 		Name:      name,
@@ -59,12 +81,12 @@ func UpdateOrDeleteInstasliceAllocations(ctx context.Context, kubeClient client.
 	for _, uuid := range keysToDelete {
 		delete(newInstaslice.Spec.PodAllocationRequests, uuid)
 	}
-	if allocRequest != nil && allocRequest.PodRef.UID != "" {
-		newInstaslice.Spec.PodAllocationRequests[allocRequest.PodRef.UID] = *allocRequest
+	for key, allocation := range allocations {
+		newInstaslice.Spec.PodAllocationRequests[key] = allocation.Request
 	}
 	err = kubeClient.Patch(ctx, &newInstaslice, client.MergeFrom(originalInstaSliceObj))
 	if err != nil {
-		return fmt.Errorf("error updating the instaslie object, %s, err: %v", name, err)
+		return fmt.Errorf("error updating the instaslice object, %s, err: %v", name, err)
 	}
 
 	err = kubeClient.Get(ctx, typeNamespacedName, &newInstaslice)
@@ -77,24 +99,248 @@ func UpdateOrDeleteInstasliceAllocations(ctx context.Context, kubeClient client.
 	if newInstaslice.Status.PodAllocationResults == nil {
 		newInstaslice.Status.PodAllocationResults = make(map[types.UID]inferencev1alpha1.AllocationResult)
 	}
-	if allocRequest != nil && allocRequest.PodRef.UID != "" {
-		newInstaslice.Status.PodAllocationResults[allocRequest.PodRef.UID] = *allocResult
+	for key, allocation := range allocations {
+		newInstaslice.Status.PodAllocationResults[key] = allocation.Result
 	}
 	for _, uuid := range keysToDelete {
 		delete(newInstaslice.Status.PodAllocationResults, uuid)
 	}
-	if allocRequest != nil && allocResult != nil {
-		log.FromContext(ctx).Info("setting status ", "controller", allocResult.AllocationStatus.AllocationStatusController, "podid", allocRequest.PodRef.UID)
-		log.FromContext(ctx).Info("setting status ", "daemonset", allocResult.AllocationStatus.AllocationStatusDaemonset, "podid", allocRequest.PodRef.UID)
+	for key, allocation := range allocations {
+		log.FromContext(ctx).Info("setting status ", "controller", allocation.Result.AllocationStatus.AllocationStatusController, "podid", allocation.Request.PodRef.UID, "allocation", key)
+		log.FromContext(ctx).Info("setting status ", "daemonset", allocation.Result.AllocationStatus.AllocationStatusDaemonset, "podid", allocation.Request.PodRef.UID, "allocation", key)
 	}
 	err = kubeClient.Status().Patch(ctx, &newInstaslice, client.MergeFrom(originalInstaSliceObj)) // TODO - try with update
 	if err != nil {
-		log.FromContext(ctx).Info("error patching allocation result", "error", err, "pod uuid", allocRequest.PodRef.UID)
+		log.FromContext(ctx).Info("error patching allocation results", "error", err, "instaslice", name)
+		return fmt.Errorf("error updating the instaslice object status, %s, err: %v", name, err)
+	}
+	return nil
+}
+
+// ErrPlacementTaken is returned when a placement can't be reserved because another allocation
+// took it in the meantime, the slices must be placed again.
+var ErrPlacementTaken = errors.New("placement already taken")
+
+// ReserveInstasliceAllocations stores new allocations like UpdateInstasliceAllocations, once it
+// checked that their placements don't overlap the allocations stored on the same GPUs. The
+// requests are patched first, the daemonset ignores them until their results are stored. The
+// results are patched next, with an optimistic lock on the resourceVersion the placements were
+// checked against. When the Instaslice was updated in the meantime the placements are checked
+// again and the results patched again, so that two workers reserving slices on the same node
+// concurrently can't carve overlapping placements: only the placements that overlap get
+// ErrPlacementTaken. The requests are withdrawn when the results can't be stored.
+func ReserveInstasliceAllocations(ctx context.Context, kubeClient client.Client, name string, allocations map[types.UID]Allocation) error {
+	var instaslice inferencev1alpha1.Instaslice
+	typeNamespacedName := types.NamespacedName{
+		Name:      name,
+		Namespace: InstaSliceOperatorNamespace,
+	}
+	if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+		return fmt.Errorf("error fetching the instaslice object: %s", name)
+	}
+	if err := checkPlacementsFree(&instaslice, allocations); err != nil {
+		return err
+	}
+
+	original := instaslice.DeepCopy()
+	if instaslice.Spec.PodAllocationRequests == nil {
+		instaslice.Spec.PodAllocationRequests = make(map[types.UID]inferencev1alpha1.AllocationRequest)
+	}
+	for key, allocation := range allocations {
+		instaslice.Spec.PodAllocationRequests[key] = allocation.Request
+	}
+	if err := kubeClient.Patch(ctx, &instaslice, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("error updating the instaslice object, %s, err: %v", name, err)
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+			return fmt.Errorf("error fetching the instaslice object: %s", name)
+		}
+		if err := checkPlacementsFree(&instaslice, allocations); err != nil {
+			return err
+		}
+		original := instaslice.DeepCopy()
+		if instaslice.Status.PodAllocationResults == nil {
+			instaslice.Status.PodAllocationResults = make(map[types.UID]inferencev1alpha1.AllocationResult)
+		}
+		for key, allocation := range allocations {
+			instaslice.Status.PodAllocationResults[key] = allocation.Result
+		}
+		return kubeClient.Status().Patch(ctx, &instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	})
+	if err == nil {
+		return nil
+	}
+	// withdraw the requests, so that the pod is placed again
+	if withdrawErr := withdrawRequests(ctx, kubeClient, typeNamespacedName, allocations); withdrawErr != nil {
+		log.FromContext(ctx).Error(withdrawErr, "error withdrawing allocation requests", "instaslice", name)
+	}
+	if apierrors.IsConflict(err) {
+		return fmt.Errorf("%w: instaslice %s was updated concurrently", ErrPlacementTaken, name)
+	}
+	if errors.Is(err, ErrPlacementTaken) {
+		return err
+	}
+	return fmt.Errorf("error updating the instaslice object status, %s, err: %v", name, err)
+}
+
+// checkPlacementsFree returns ErrPlacementTaken when one of the placements overlaps another
+// allocation stored on the same GPU
+func checkPlacementsFree(instaslice *inferencev1alpha1.Instaslice, allocations map[types.UID]Allocation) error {
+	for key, allocation := range allocations {
+		for otherKey, other := range instaslice.Status.PodAllocationResults {
+			if _, ok := allocations[otherKey]; ok || other.GPUUUID != allocation.Result.GPUUUID ||
+				other.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+				continue
+			}
+			if placementsOverlap(other.MigPlacement, allocation.Result.MigPlacement) {
+				return fmt.Errorf("%w: slice %s overlaps %s on gpu %s", ErrPlacementTaken, key, otherKey, allocation.Result.GPUUUID)
+			}
+		}
+	}
+	return nil
+}
+
+// withdrawRequests removes the requests of allocations whose results weren't stored
+func withdrawRequests(ctx context.Context, kubeClient client.Client, typeNamespacedName types.NamespacedName, allocations map[types.UID]Allocation) error {
+	var instaslice inferencev1alpha1.Instaslice
+	if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+		return err
+	}
+	original := instaslice.DeepCopy()
+	for key := range allocations {
+		delete(instaslice.Spec.PodAllocationRequests, key)
+	}
+	return kubeClient.Patch(ctx, &instaslice, client.MergeFrom(original))
+}
+
+// WithdrawUnreservedRequests removes the requests left without a result by a reservation that
+// didn't complete, e.g. when the controller restarted in the middle of it. The requests are
+// removed with an optimistic lock, a reservation storing its results in the meantime keeps
+// its request.
+func WithdrawUnreservedRequests(ctx context.Context, kubeClient client.Client, name string, keys []types.UID) error {
+	var instaslice inferencev1alpha1.Instaslice
+	typeNamespacedName := types.NamespacedName{
+		Name:      name,
+		Namespace: InstaSliceOperatorNamespace,
+	}
+	if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+		return fmt.Errorf("error fetching the instaslice object: %s", name)
+	}
+	original := instaslice.DeepCopy()
+	for _, key := range keys {
+		if _, ok := instaslice.Status.PodAllocationResults[key]; !ok {
+			delete(instaslice.Spec.PodAllocationRequests, key)
+		}
+	}
+	if err := kubeClient.Patch(ctx, &instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("%w: instaslice %s was updated concurrently", ErrAllocationProgressed, name)
+		}
+		return fmt.Errorf("error updating the instaslice object, %s, err: %v", name, err)
+	}
+	return nil
+}
+
+// ErrAllocationProgressed is returned when an allocation can't be withdrawn because the
+// daemonset started working on it in the meantime.
+var ErrAllocationProgressed = errors.New("allocation progressed")
+
+// WithdrawInstasliceAllocations removes allocations the daemonset hasn't acted on yet. The
+// requests are removed first, with an optimistic lock on the resourceVersion the allocations
+// were checked against, so that the daemonset ignores the results, which are removed next.
+// ErrAllocationProgressed is returned when the daemonset updated one of them in the meantime.
+func WithdrawInstasliceAllocations(ctx context.Context, kubeClient client.Client, name string, keys []types.UID) error {
+	var instaslice inferencev1alpha1.Instaslice
+	typeNamespacedName := types.NamespacedName{
+		Name:      name,
+		Namespace: InstaSliceOperatorNamespace,
+	}
+	if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+		return fmt.Errorf("error fetching the instaslice object: %s", name)
+	}
+	for _, key := range keys {
+		if result, ok := instaslice.Status.PodAllocationResults[key]; ok && result.AllocationStatus.AllocationStatusDaemonset != "" {
+			return fmt.Errorf("%w: allocation %s is %s", ErrAllocationProgressed, key, result.AllocationStatus.AllocationStatusDaemonset)
+		}
+	}
+
+	original := instaslice.DeepCopy()
+	for _, key := range keys {
+		delete(instaslice.Spec.PodAllocationRequests, key)
+	}
+	if err := kubeClient.Patch(ctx, &instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("%w: instaslice %s was updated concurrently", ErrAllocationProgressed, name)
+		}
+		return fmt.Errorf("error updating the instaslice object, %s, err: %v", name, err)
+	}
+
+	original = instaslice.DeepCopy()
+	for _, key := range keys {
+		delete(instaslice.Status.PodAllocationResults, key)
+	}
+	if err := kubeClient.Status().Patch(ctx, &instaslice, client.MergeFrom(original)); err != nil {
+		return fmt.Errorf("error updating the instaslice object status, %s, err: %v", name, err)
+	}
+	return nil
+}
+
+// RecycleInstasliceAllocation hands the slice of a freed allocation over to a new allocation
+// at the same placement. The freed result is replaced by the given one, which sets it to
+// deleting, and the new result is stored with an optimistic lock on the resourceVersion the
+// freed allocation was checked against. The request is patched next. ErrAllocationProgressed
+// is returned when the slice of the freed allocation isn't created anymore or the Instaslice
+// was updated concurrently.
+func RecycleInstasliceAllocation(ctx context.Context, kubeClient client.Client, name string, freedKey types.UID, freed inferencev1alpha1.AllocationResult, key types.UID, allocation Allocation) error {
+	var instaslice inferencev1alpha1.Instaslice
+	typeNamespacedName := types.NamespacedName{
+		Name:      name,
+		Namespace: InstaSliceOperatorNamespace,
+	}
+	if err := kubeClient.Get(ctx, typeNamespacedName, &instaslice); err != nil {
+		return fmt.Errorf("error fetching the instaslice object: %s", name)
+	}
+	current, ok := instaslice.Status.PodAllocationResults[freedKey]
+	if !ok || current.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusCreated ||
+		current.AllocationStatus.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting {
+		return fmt.Errorf("%w: the slice of allocation %s can't be recycled", ErrAllocationProgressed, freedKey)
+	}
+
+	original := instaslice.DeepCopy()
+	instaslice.Status.PodAllocationResults[freedKey] = freed
+	instaslice.Status.PodAllocationResults[key] = allocation.Result
+	if err := kubeClient.Status().Patch(ctx, &instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrors.IsConflict(err) {
+			return fmt.Errorf("%w: instaslice %s was updated concurrently", ErrAllocationProgressed, name)
+		}
 		return fmt.Errorf("error updating the instaslice object status, %s, err: %v", name, err)
 	}
+
+	original = instaslice.DeepCopy()
+	if instaslice.Spec.PodAllocationRequests == nil {
+		instaslice.Spec.PodAllocationRequests = make(map[types.UID]inferencev1alpha1.AllocationRequest)
+	}
+	instaslice.Spec.PodAllocationRequests[key] = allocation.Request
+	if err := kubeClient.Patch(ctx, &instaslice, client.MergeFrom(original)); err != nil {
+		// give the slice back to the freed allocation
+		original = instaslice.DeepCopy()
+		instaslice.Status.PodAllocationResults[freedKey] = current
+		delete(instaslice.Status.PodAllocationResults, key)
+		if restoreErr := kubeClient.Status().Patch(ctx, &instaslice, client.MergeFrom(original)); restoreErr != nil {
+			log.FromContext(ctx).Error(restoreErr, "error restoring the recycled allocation", "instaslice", name)
+		}
+		return fmt.Errorf("error updating the instaslice object, %s, err: %v", name, err)
+	}
 	return nil
 }
 
+// placementsOverlap reports whether the placements share a slot of the GPU
+func placementsOverlap(a, b inferencev1alpha1.Placement) bool {
+	return a.Start < b.Start+b.Size && b.Start < a.Start+a.Size
+}
+
 func RunningOnOpenshift(ctx context.Context, cl client.Client) bool {
 	gvk := schema.GroupVersionKind{Group: "route.openshift.io", Version: "v1", Kind: "route"}
 	return isGvkPresent(ctx, cl, gvk)
@@ -0,0 +1,323 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilcache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Gated pods that no node can hold wait in the wait queue, by the profiles of their slices.
+// They are reconciled again when capacity for one of their profiles may have been freed: an
+// allocation was deleted by the daemonset, the Instaslice of a node gained GPUs, or classical
+// resources were freed on a node. The wait queue resync interval is a safety net for the
+// changes not covered, e.g. a wakeup dropped while the controller is busy.
+//
+// Woken pods are sent to the controller by decreasing priority and get the freed capacity
+// first: until they are reconciled, pods of lower priority aren't allocated.
+
+// waitQueueCapacity is the number of wakeups buffered for the controller
+const waitQueueCapacity = 1024
+
+// wakeupTimeout is how long a woken pod holds back the pods of lower priority, in case its
+// wakeup was dropped or the pod is gone
+const wakeupTimeout = 30 * time.Second
+
+// wokenPod is a pod woken and not reconciled yet
+type wokenPod struct {
+	priority int32
+	wokenAt  time.Time
+}
+
+// waitQueue holds the waiting pods by profile, its zero value is an empty queue
+type waitQueue struct {
+	mu sync.Mutex
+	// pods are the waiting pods by profile
+	pods map[string]map[types.NamespacedName]bool
+	// priorities are the priorities of the waiting pods
+	priorities map[types.NamespacedName]int32
+	// woken are the woken pods not reconciled yet
+	woken map[types.NamespacedName]wokenPod
+	// wakeups are the pods to reconcile again, nil until the controller is set up
+	wakeups chan event.GenericEvent
+}
+
+// channel returns the channel of the wakeups, read by the controller
+func (q *waitQueue) channel() chan event.GenericEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.wakeups == nil {
+		q.wakeups = make(chan event.GenericEvent, waitQueueCapacity)
+	}
+	return q.wakeups
+}
+
+// add queues the pod with its priority under the profiles of its slices
+func (q *waitQueue) add(pod types.NamespacedName, priority int32, profiles ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pods == nil {
+		q.pods = make(map[string]map[types.NamespacedName]bool)
+		q.priorities = make(map[types.NamespacedName]int32)
+	}
+	delete(q.woken, pod)
+	q.priorities[pod] = priority
+	for _, profile := range profiles {
+		if q.pods[profile] == nil {
+			q.pods[profile] = make(map[types.NamespacedName]bool)
+		}
+		q.pods[profile][pod] = true
+	}
+}
+
+// remove takes the pod out of the queue, whether it waits or was woken
+func (q *waitQueue) remove(pod types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.removeLocked(pod)
+	delete(q.woken, pod)
+}
+
+// removeLocked takes the waiting pod out of every profile. The lock is held by the caller.
+func (q *waitQueue) removeLocked(pod types.NamespacedName) {
+	delete(q.priorities, pod)
+	for profile, pods := range q.pods {
+		delete(pods, pod)
+		if len(pods) == 0 {
+			delete(q.pods, profile)
+		}
+	}
+}
+
+// wake takes the pods waiting for the profiles out of the queue and sends them to the
+// controller by decreasing priority. They are woken until they are reconciled. The pods are
+// taken out even when the wakeup is dropped, the resync of the queue reconciles them again.
+func (q *waitQueue) wake(profiles ...string) []types.NamespacedName {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	woken := make(map[types.NamespacedName]int32)
+	for _, profile := range profiles {
+		for pod := range q.pods[profile] {
+			woken[pod] = q.priorities[pod]
+		}
+	}
+	if q.woken == nil {
+		q.woken = make(map[types.NamespacedName]wokenPod)
+	}
+	now := time.Now()
+	pods := make([]types.NamespacedName, 0, len(woken))
+	for pod, priority := range woken {
+		pods = append(pods, pod)
+		q.removeLocked(pod)
+		q.woken[pod] = wokenPod{priority: priority, wokenAt: now}
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if woken[pods[i]] != woken[pods[j]] {
+			return woken[pods[i]] > woken[pods[j]]
+		}
+		return pods[i].String() < pods[j].String()
+	})
+	q.sendLocked(pods)
+	return pods
+}
+
+// higherPriorityWoken reports whether a pod of higher priority than the given one was woken
+// and isn't reconciled yet. Woken pods stop holding back the others after wakeupTimeout.
+func (q *waitQueue) higherPriorityWoken(pod types.NamespacedName, priority int32) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	waiting := false
+	for other, woken := range q.woken {
+		if now.Sub(woken.wokenAt) > wakeupTimeout {
+			delete(q.woken, other)
+			continue
+		}
+		if other != pod && woken.priority > priority {
+			waiting = true
+		}
+	}
+	return waiting
+}
+
+// reconciled marks the woken pod as reconciled
+func (q *waitQueue) reconciled(pod types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.woken, pod)
+}
+
+// send sends the pods to the controller, whether they wait in the queue or not
+func (q *waitQueue) send(pods ...types.NamespacedName) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sendLocked(pods)
+}
+
+// sendLocked sends the pods to the controller, the wakeups are dropped when the channel is
+// full. The lock is held by the caller.
+func (q *waitQueue) sendLocked(pods []types.NamespacedName) {
+	if q.wakeups == nil {
+		return
+	}
+	for _, pod := range pods {
+		select {
+		case q.wakeups <- event.GenericEvent{Object: &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}}:
+		default:
+		}
+	}
+}
+
+func (r *InstasliceReconciler) waitQueueResyncInterval() time.Duration {
+	if r.Config != nil && r.Config.WaitQueueResyncInterval > 0 {
+		return r.Config.WaitQueueResyncInterval
+	}
+	return config.DefaultWaitQueueResyncInterval
+}
+
+// queueWaitingPod queues the pod that no node can hold under the profiles of its slices
+func (r *InstasliceReconciler) queueWaitingPod(pod *v1.Pod, slices []sliceRequest) {
+	profiles := make([]string, 0, len(slices))
+	for _, slice := range slices {
+		profiles = append(profiles, slice.profile)
+	}
+	r.waitQueue.add(client.ObjectKeyFromObject(pod), podPriority(pod), profiles...)
+}
+
+// wakeWaitingPods wakes the pods waiting for the profiles
+func (r *InstasliceReconciler) wakeWaitingPods(ctx context.Context, reason string, profiles ...string) {
+	if pods := r.waitQueue.wake(profiles...); len(pods) > 0 {
+		logr.FromContext(ctx).Info("waking waiting pods", "reason", reason, "profiles", profiles, "pods", pods)
+	}
+}
+
+// wakePodsForNode wakes the pods waiting for the profiles of the node, when it is managed by
+// instaslice
+func (r *InstasliceReconciler) wakePodsForNode(nodeName string) {
+	ctx := context.Background()
+	var instaslice inferencev1alpha1.Instaslice
+	if err := r.Get(ctx, types.NamespacedName{Name: nodeName, Namespace: InstaSliceOperatorNamespace}, &instaslice); err != nil {
+		return
+	}
+	r.wakeWaitingPods(ctx, "node capacity freed", nodeProfiles(&instaslice)...)
+}
+
+// nodeProfiles returns the profiles discovered on the node
+func nodeProfiles(instaslice *inferencev1alpha1.Instaslice) []string {
+	profiles := make([]string, 0, len(instaslice.Status.NodeResources.MigPlacement))
+	for profile := range instaslice.Status.NodeResources.MigPlacement {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// freedProfiles returns the profiles that may fit in the slots freed by the allocations the
+// daemonset deleted between the two versions of the Instaslice: the profiles with a placement
+// overlapping a freed one
+func freedProfiles(oldInstaslice, newInstaslice *inferencev1alpha1.Instaslice) []string {
+	var freed []inferencev1alpha1.Placement
+	for key, allocResult := range newInstaslice.Status.PodAllocationResults {
+		if allocResult.AllocationStatus.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted {
+			continue
+		}
+		// the slots of recycled allocations stay in use
+		if allocationRecycled(allocResult) {
+			continue
+		}
+		oldResult, ok := oldInstaslice.Status.PodAllocationResults[key]
+		if ok && oldResult.AllocationStatus.AllocationStatusDaemonset == inferencev1alpha1.AllocationStatusDeleted {
+			continue
+		}
+		freed = append(freed, allocResult.MigPlacement)
+	}
+	var profiles []string
+	for _, profile := range nodeProfiles(newInstaslice) {
+		placements := newInstaslice.Status.NodeResources.MigPlacement[profile].Placements
+		if placementsOverlapAny(placements, freed) {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
+
+// placementsOverlapAny reports whether a placement of the first list overlaps one of the second
+func placementsOverlapAny(placements, others []inferencev1alpha1.Placement) bool {
+	for _, placement := range placements {
+		for _, other := range others {
+			if placement.Start < other.Start+other.Size && other.Start < placement.Start+placement.Size {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// gainedGPUs reports whether the node discovered GPUs it didn't have
+func gainedGPUs(oldInstaslice, newInstaslice *inferencev1alpha1.Instaslice) bool {
+	known := make(map[string]bool, len(oldInstaslice.Status.NodeResources.NodeGPUs))
+	for _, gpu := range oldInstaslice.Status.NodeResources.NodeGPUs {
+		known[gpu.GPUUUID] = true
+	}
+	for _, gpu := range newInstaslice.Status.NodeResources.NodeGPUs {
+		if gpu.GPUUUID != "" && !known[gpu.GPUUUID] {
+			return true
+		}
+	}
+	return false
+}
+
+// waitQueueEventHandler wakes the waiting pods when an Instaslice frees slots, gains GPUs or
+// GPUs recover
+func (r *InstasliceReconciler) waitQueueEventHandler() utilcache.ResourceEventHandlerFuncs {
+	return utilcache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if instaslice, ok := obj.(*inferencev1alpha1.Instaslice); ok {
+				r.wakeWaitingPods(context.Background(), "node added", nodeProfiles(instaslice)...)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldInstaslice, okOld := oldObj.(*inferencev1alpha1.Instaslice)
+			newInstaslice, okNew := newObj.(*inferencev1alpha1.Instaslice)
+			if !okOld || !okNew {
+				return
+			}
+			if gainedGPUs(oldInstaslice, newInstaslice) {
+				r.wakeWaitingPods(context.Background(), "GPUs discovered", nodeProfiles(newInstaslice)...)
+				return
+			}
+			if recoveredGPUs(oldInstaslice, newInstaslice) {
+				r.wakeWaitingPods(context.Background(), "GPUs recovered", nodeProfiles(newInstaslice)...)
+				return
+			}
+			if profiles := freedProfiles(oldInstaslice, newInstaslice); len(profiles) > 0 {
+				r.wakeWaitingPods(context.Background(), "slices deleted", profiles...)
+			}
+		},
+	}
+}
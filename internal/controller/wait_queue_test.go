@@ -0,0 +1,122 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+func TestWaitQueueWake(t *testing.T) {
+	var q waitQueue
+	small := types.NamespacedName{Namespace: "default", Name: "small"}
+	large := types.NamespacedName{Namespace: "default", Name: "large"}
+	mixed := types.NamespacedName{Namespace: "default", Name: "mixed"}
+	q.add(small, 0, "1g.5gb")
+	q.add(large, 0, "7g.40gb")
+	q.add(mixed, 0, "1g.5gb", "3g.20gb")
+
+	// wakeups aren't sent before the controller is set up
+	assert.Equal(t, []types.NamespacedName{mixed, small}, q.wake("1g.5gb"))
+	assert.NotContains(t, q.pods, "3g.20gb", "woken pods leave every profile")
+
+	wakeups := q.channel()
+	q.add(small, 0, "1g.5gb")
+	assert.Empty(t, q.wake("2g.10gb"))
+	assert.Equal(t, []types.NamespacedName{large}, q.wake("7g.40gb"))
+	if assert.Len(t, wakeups, 1) {
+		woken := <-wakeups
+		assert.Equal(t, "large", woken.Object.GetName())
+	}
+
+	q.remove(small)
+	assert.Empty(t, q.pods)
+}
+
+func TestWaitQueueWakesByPriority(t *testing.T) {
+	var q waitQueue
+	batch := types.NamespacedName{Namespace: "default", Name: "batch"}
+	inference := types.NamespacedName{Namespace: "default", Name: "inference"}
+	training := types.NamespacedName{Namespace: "default", Name: "training"}
+	q.add(batch, 10, "1g.5gb")
+	q.add(inference, 1000, "1g.5gb")
+	q.add(training, 100, "7g.40gb")
+	assert.False(t, q.higherPriorityWoken(batch, 10), "waiting pods don't hold back the others")
+
+	assert.Equal(t, []types.NamespacedName{inference, batch}, q.wake("1g.5gb"))
+	assert.True(t, q.higherPriorityWoken(batch, 10), "inference is allocated first")
+	assert.True(t, q.higherPriorityWoken(training, 100))
+	assert.False(t, q.higherPriorityWoken(inference, 1000))
+
+	// inference is reconciled, it got the freed slices or waits again
+	q.reconciled(inference)
+	assert.False(t, q.higherPriorityWoken(batch, 10))
+
+	q.add(inference, 1000, "1g.5gb")
+	q.wake("1g.5gb")
+	q.woken[inference] = wokenPod{priority: 1000, wokenAt: time.Now().Add(-2 * wakeupTimeout)}
+	assert.False(t, q.higherPriorityWoken(batch, 10), "the wakeup of inference timed out")
+	assert.NotContains(t, q.woken, inference)
+}
+
+func TestWaitQueueEventHandlerWakesFreedProfiles(t *testing.T) {
+	running := newPriorityPod("running", 0, "1g.5gb", false)
+	oldInstaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a"), running, "gpu-a", 6)
+	r := newTestReconciler(oldInstaslice)
+	for _, profile := range []string{"1g.5gb", "2g.10gb", "3g.20gb", "7g.40gb"} {
+		r.waitQueue.add(types.NamespacedName{Namespace: "default", Name: profile}, 0, profile)
+	}
+	handler := r.waitQueueEventHandler()
+
+	deleting := withStatus(oldInstaslice.DeepCopy(), running.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+	}, time.Time{})
+	handler.OnUpdate(oldInstaslice, deleting)
+	assert.Len(t, r.waitQueue.pods, 4, "the slots are still in use")
+
+	deleted := withStatus(deleting.DeepCopy(), running.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusDeleted,
+	}, time.Time{})
+	handler.OnUpdate(deleting, deleted)
+	assert.Contains(t, r.waitQueue.pods, "2g.10gb", "no 2g.10gb placement overlaps the freed slot")
+	assert.NotContains(t, r.waitQueue.pods, "1g.5gb")
+	assert.NotContains(t, r.waitQueue.pods, "3g.20gb")
+	assert.NotContains(t, r.waitQueue.pods, "7g.40gb")
+
+	gained := deleted.DeepCopy()
+	gained.Status.NodeResources.NodeGPUs = append(gained.Status.NodeResources.NodeGPUs, inferencev1alpha1.DiscoveredGPU{GPUUUID: "gpu-b"})
+	handler.OnUpdate(deleted, gained)
+	assert.Empty(t, r.waitQueue.pods)
+}
+
+func TestWakePodsForNode(t *testing.T) {
+	r := newTestReconciler(newTestInstaslice("node-1", "gpu-a"))
+	waiting := types.NamespacedName{Namespace: "default", Name: "waiting"}
+	r.waitQueue.add(waiting, 0, "1g.5gb")
+
+	r.wakePodsForNode("node-without-gpus")
+	assert.Contains(t, r.waitQueue.pods, "1g.5gb")
+
+	r.wakePodsForNode("node-1")
+	assert.Empty(t, r.waitQueue.pods)
+}
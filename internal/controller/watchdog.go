@@ -0,0 +1,309 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+	"github.com/openshift/instaslice-operator/internal/controller/config"
+	"github.com/openshift/instaslice-operator/internal/controller/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logr "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The watchdog looks for allocations the daemonset doesn't move out of creating or deleting,
+// e.g. because it crashed on the node or NVML keeps failing. The time an allocation entered
+// such a state is kept in its Progressing condition. Once it is older than the allocation
+// timeout, the slices of a pod stuck in creating are withdrawn and placed again on another
+// GPU, until the pod ran out of retries: its allocations are then marked failed and set to
+// deleting. Allocations stuck in deleting are marked failed. The slots of failed allocations
+// are released in the cache, the daemonset still deletes them once it recovers.
+
+const (
+	progressingReasonCreating = "Creating"
+	progressingReasonDeleting = "Deleting"
+	failedReasonCreateTimeout = "CreateTimeout"
+	failedReasonDeleteTimeout = "DeleteTimeout"
+)
+
+// stuckPod records the retries of a pod whose slices got stuck in creating
+type stuckPod struct {
+	retries int
+	// gpus are the GPUs the slices got stuck on, they are avoided when placing them again
+	gpus map[string]bool
+}
+
+// progressingReason returns the reason of the Progressing condition of an allocation waiting
+// for the daemonset, empty when the allocation isn't
+func progressingReason(allocResult inferencev1alpha1.AllocationResult) string {
+	status := allocResult.AllocationStatus
+	switch {
+	case status.AllocationStatusController == inferencev1alpha1.AllocationStatusCreating && status.AllocationStatusDaemonset == "":
+		return progressingReasonCreating
+	case status.AllocationStatusController == inferencev1alpha1.AllocationStatusDeleting && status.AllocationStatusDaemonset != inferencev1alpha1.AllocationStatusDeleted:
+		return progressingReasonDeleting
+	}
+	return ""
+}
+
+// allocationFailed reports whether the watchdog gave up on the allocation
+func allocationFailed(allocResult inferencev1alpha1.AllocationResult) bool {
+	return meta.IsStatusConditionTrue(allocResult.Conditions, FailedCondition)
+}
+
+func (r *InstasliceReconciler) allocationTimeout() time.Duration {
+	if r.Config != nil && r.Config.AllocationTimeout > 0 {
+		return r.Config.AllocationTimeout
+	}
+	return config.DefaultAllocationTimeout
+}
+
+func (r *InstasliceReconciler) allocationRetries() int {
+	if r.Config != nil {
+		return r.Config.AllocationRetries
+	}
+	return config.DefaultAllocationRetries
+}
+
+// runAllocationWatchdog checks for stuck allocations until the context is done
+func (r *InstasliceReconciler) runAllocationWatchdog(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.checkStuckAllocations(ctx); err != nil {
+			logr.FromContext(ctx).Error(err, "failed to check for stuck allocations")
+		}
+	}, r.allocationTimeout()/2)
+	return nil
+}
+
+// checkStuckAllocations stamps the allocations that started waiting for the daemonset and
+// handles the ones that waited longer than the allocation timeout.
+func (r *InstasliceReconciler) checkStuckAllocations(ctx context.Context) error {
+	var instasliceList inferencev1alpha1.InstasliceList
+	if err := r.List(ctx, &instasliceList); err != nil {
+		return err
+	}
+	now := time.Now()
+	timeout := r.allocationTimeout()
+	for _, instaslice := range instasliceList.Items {
+		var started, deleting []types.UID
+		creating := make(map[types.UID]bool)
+		for key, allocResult := range instaslice.Status.PodAllocationResults {
+			reason := progressingReason(allocResult)
+			if reason == "" || allocationFailed(allocResult) {
+				continue
+			}
+			condition := meta.FindStatusCondition(allocResult.Conditions, ProgressingCondition)
+			if condition == nil || condition.Reason != reason {
+				started = append(started, key)
+				continue
+			}
+			if now.Sub(condition.LastTransitionTime.Time) < timeout {
+				continue
+			}
+			if reason == progressingReasonDeleting {
+				deleting = append(deleting, key)
+				continue
+			}
+			// allocations without request are withdrawn by the reservation that stored them
+			if allocRequest, ok := instaslice.Spec.PodAllocationRequests[key]; ok {
+				creating[allocRequest.PodRef.UID] = true
+			}
+		}
+		if err := r.stampProgressingAllocations(ctx, instaslice.Name, started); err != nil {
+			return err
+		}
+		if err := r.failStuckAllocations(ctx, instaslice.Name, deleting, progressingReasonDeleting, failedReasonDeleteTimeout); err != nil {
+			return err
+		}
+		podUIDs := make([]types.UID, 0, len(creating))
+		for podUID := range creating {
+			podUIDs = append(podUIDs, podUID)
+		}
+		sort.Slice(podUIDs, func(i, j int) bool { return podUIDs[i] < podUIDs[j] })
+		for _, podUID := range podUIDs {
+			if err := r.retryStuckPod(ctx, &instaslice, podUID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stampProgressingAllocations sets the Progressing condition of the allocations to the state
+// they are waiting in, the transition time is when the watchdog first saw them in it.
+func (r *InstasliceReconciler) stampProgressingAllocations(ctx context.Context, instasliceName string, keys []types.UID) error {
+	_, err := r.updateAllocationResults(ctx, instasliceName, keys, func(_ types.UID, allocResult *inferencev1alpha1.AllocationResult) bool {
+		reason := progressingReason(*allocResult)
+		if reason == "" {
+			return false
+		}
+		if condition := meta.FindStatusCondition(allocResult.Conditions, ProgressingCondition); condition != nil && condition.Reason == reason {
+			return false
+		}
+		meta.RemoveStatusCondition(&allocResult.Conditions, ProgressingCondition)
+		meta.SetStatusCondition(&allocResult.Conditions, metav1.Condition{
+			Type:    ProgressingCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  reason,
+			Message: "waiting for the daemonset",
+		})
+		return true
+	})
+	return err
+}
+
+// retryStuckPod withdraws the allocations of a pod stuck in creating on the instaslice, the
+// pod is placed again avoiding the GPUs it got stuck on. When it ran out of retries, or when
+// the daemonset already created some of its slices, its allocations are marked failed instead.
+func (r *InstasliceReconciler) retryStuckPod(ctx context.Context, instaslice *inferencev1alpha1.Instaslice, podUID types.UID) error {
+	log := logr.FromContext(ctx)
+	allocations := getPodAllocations([]inferencev1alpha1.Instaslice{*instaslice}, podUID)
+	if len(allocations) == 0 {
+		return nil
+	}
+	keys := make([]types.UID, 0, len(allocations))
+	retry := true
+	for _, allocation := range allocations {
+		keys = append(keys, allocation.key)
+		if allocation.Result.AllocationStatus.AllocationStatusDaemonset != "" {
+			retry = false
+		}
+	}
+	r.allocationMu.Lock()
+	if stuck := r.stuckPods[podUID]; stuck != nil && stuck.retries >= r.allocationRetries() {
+		retry = false
+	}
+	r.allocationMu.Unlock()
+
+	if !retry {
+		log.Info("allocations stuck in creating, marking them failed", "pod", allocations[0].Request.PodRef.Name, "instaslice", instaslice.Name)
+		return r.failStuckAllocations(ctx, instaslice.Name, keys, progressingReasonCreating, failedReasonCreateTimeout)
+	}
+	err := utils.WithdrawInstasliceAllocations(ctx, r.Client, instaslice.Name, keys)
+	if errors.Is(err, utils.ErrAllocationProgressed) {
+		// checked again on the next round
+		log.Info("stuck allocations progressed, not withdrawing them", "pod", allocations[0].Request.PodRef.Name, "reason", err.Error())
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.allocationMu.Lock()
+	if r.stuckPods == nil {
+		r.stuckPods = make(map[types.UID]*stuckPod)
+	}
+	stuck := r.stuckPods[podUID]
+	if stuck == nil {
+		stuck = &stuckPod{gpus: make(map[string]bool)}
+		r.stuckPods[podUID] = stuck
+	}
+	stuck.retries++
+	for _, allocation := range allocations {
+		stuck.gpus[allocation.Result.GPUUUID] = true
+		r.forgetCachedAllocation(allocation.key)
+	}
+	r.allocationMu.Unlock()
+	log.Info("allocations stuck in creating withdrawn, placing the slices again", "pod", allocations[0].Request.PodRef.Name, "instaslice", instaslice.Name)
+	return nil
+}
+
+// failStuckAllocations marks the allocations still waiting in the state as failed and sets
+// them to deleting, so that the daemonset deletes what it created once it recovers. Their
+// slots stay in use until it did, the slices may exist on the GPU. The slices of the pod the daemonset already created are
+// set to deleting as well, the pod can't run without the failed ones.
+func (r *InstasliceReconciler) failStuckAllocations(ctx context.Context, instasliceName string, keys []types.UID, reason, failedReason string) error {
+	timeout := r.allocationTimeout()
+	_, err := r.updateAllocationResults(ctx, instasliceName, keys, func(key types.UID, allocResult *inferencev1alpha1.AllocationResult) bool {
+		if progressingReason(*allocResult) != reason {
+			if reason != progressingReasonCreating || allocResult.AllocationStatus.AllocationStatusController != inferencev1alpha1.AllocationStatusCreating {
+				return false
+			}
+			allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+			return true
+		}
+		allocResult.AllocationStatus.AllocationStatusController = inferencev1alpha1.AllocationStatusDeleting
+		meta.SetStatusCondition(&allocResult.Conditions, metav1.Condition{
+			Type:    FailedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  failedReason,
+			Message: fmt.Sprintf("the daemonset didn't complete the allocation within %s", timeout),
+		})
+		return true
+	})
+	return err
+}
+
+// updateAllocationResults applies the update to the results stored under the keys, which
+// reports whether it changed the result. The status is patched with an optimistic lock so
+// that concurrent updates of the daemonset aren't overwritten, a conflict is retried on the
+// next round. The boolean reports whether the status was patched.
+func (r *InstasliceReconciler) updateAllocationResults(ctx context.Context, instasliceName string, keys []types.UID, update func(types.UID, *inferencev1alpha1.AllocationResult) bool) (bool, error) {
+	if len(keys) == 0 {
+		return false, nil
+	}
+	instaslice, err := r.getInstasliceObject(ctx, instasliceName, InstaSliceOperatorNamespace)
+	if err != nil {
+		return false, err
+	}
+	original := instaslice.DeepCopy()
+	changed := false
+	for _, key := range keys {
+		allocResult, ok := instaslice.Status.PodAllocationResults[key]
+		if !ok || !update(key, &allocResult) {
+			continue
+		}
+		instaslice.Status.PodAllocationResults[key] = allocResult
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := r.Status().Patch(ctx, instaslice, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// podSlotMaps returns the slot maps of the GPUs of the node for the slices of the pod, the
+// GPUs the pod got stuck on are full. The placements held for the pods of its controller are
+// free.
+func (r *InstasliceReconciler) podSlotMaps(instaslice *inferencev1alpha1.Instaslice, pod *v1.Pod) map[string]slotMap {
+	gpuSlots := r.nodeSlotMaps(instaslice, map[types.UID]bool{podOwnerUID(pod): true})
+	stuck := r.stuckPods[pod.UID]
+	if stuck == nil {
+		return gpuSlots
+	}
+	for gpuUUID := range stuck.gpus {
+		if slots, ok := gpuSlots[gpuUUID]; ok {
+			slots.occupy(inferencev1alpha1.Placement{Start: 0, Size: int32(len(slots))})
+		}
+	}
+	return gpuSlots
+}
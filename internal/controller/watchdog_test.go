@@ -0,0 +1,186 @@
+/*
+Copyright 2025.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	inferencev1alpha1 "github.com/openshift/instaslice-operator/api/v1alpha1"
+)
+
+// withStatus sets the status of the allocation of the pod, the Progressing condition is set
+// since the given time unless it is zero
+func withStatus(instaslice *inferencev1alpha1.Instaslice, key types.UID, status inferencev1alpha1.AllocationStatus, since time.Time) *inferencev1alpha1.Instaslice {
+	allocResult := instaslice.Status.PodAllocationResults[key]
+	allocResult.AllocationStatus = status
+	allocResult.Conditions = nil
+	if reason := progressingReason(allocResult); reason != "" && !since.IsZero() {
+		allocResult.Conditions = []metav1.Condition{{
+			Type:               ProgressingCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             reason,
+			LastTransitionTime: metav1.NewTime(since),
+		}}
+	}
+	instaslice.Status.PodAllocationResults[key] = allocResult
+	return instaslice
+}
+
+func creatingStatus() inferencev1alpha1.AllocationStatus {
+	return inferencev1alpha1.AllocationStatus{AllocationStatusController: inferencev1alpha1.AllocationStatusCreating}
+}
+
+func getInstaslice(t *testing.T, r *InstasliceReconciler, name string) *inferencev1alpha1.Instaslice {
+	instaslice, err := r.getInstasliceObject(context.TODO(), name, InstaSliceOperatorNamespace)
+	assert.NoError(t, err)
+	return instaslice
+}
+
+func TestCheckStuckAllocationsStampsProgressing(t *testing.T) {
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	instaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a"), pod, "gpu-a", 0)
+	withStatus(instaslice, pod.UID, creatingStatus(), time.Time{})
+	r := newTestReconciler(instaslice, pod)
+	r.Config.AllocationTimeout = 5 * time.Minute
+
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+	allocResult := getInstaslice(t, r, "node-1").Status.PodAllocationResults[pod.UID]
+	condition := meta.FindStatusCondition(allocResult.Conditions, ProgressingCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, progressingReasonCreating, condition.Reason)
+	}
+	assert.Equal(t, inferencev1alpha1.AllocationStatusCreating, allocResult.AllocationStatus.AllocationStatusController)
+
+	// the daemonset created the slice, the pod is ungated, then the allocation is deleted
+	instaslice = getInstaslice(t, r, "node-1")
+	withStatus(instaslice, pod.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+	}, time.Now().Add(-time.Hour))
+	// the condition was stamped while the allocation was creating
+	instaslice.Status.PodAllocationResults[pod.UID].Conditions[0].Reason = progressingReasonCreating
+	assert.NoError(t, r.Status().Update(context.TODO(), instaslice))
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+	allocResult = getInstaslice(t, r, "node-1").Status.PodAllocationResults[pod.UID]
+	condition = meta.FindStatusCondition(allocResult.Conditions, ProgressingCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, progressingReasonDeleting, condition.Reason)
+		assert.WithinDuration(t, time.Now(), condition.LastTransitionTime.Time, time.Minute, "the deadline starts over")
+	}
+	assert.False(t, allocationFailed(allocResult))
+}
+
+func TestCheckStuckAllocationsRetriesOnAnotherGPU(t *testing.T) {
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	instaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a", "gpu-b"), pod, "gpu-a", 0)
+	withStatus(instaslice, pod.UID, creatingStatus(), time.Now().Add(-10*time.Minute))
+	r := newTestReconciler(instaslice, pod)
+	r.Config.AllocationTimeout = 5 * time.Minute
+	r.Config.AllocationRetries = 1
+	r.allocationCache[pod.UID] = instaslice.Status.PodAllocationResults[pod.UID]
+
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+	assert.Empty(t, getPodAllocations(listInstaslices(t, r), pod.UID), "the allocation is withdrawn")
+	assert.NotContains(t, r.allocationCache, pod.UID)
+
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	_, err = r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	allocations := getPodAllocations(listInstaslices(t, r), pod.UID)
+	if !assert.Len(t, allocations, 1) {
+		return
+	}
+	assert.Equal(t, "gpu-b", allocations[0].Result.GPUUUID, "the GPU the pod got stuck on is avoided")
+
+	// stuck again, the pod ran out of retries
+	instaslice = getInstaslice(t, r, "node-1")
+	withStatus(instaslice, pod.UID, creatingStatus(), time.Now().Add(-10*time.Minute))
+	assert.NoError(t, r.Status().Update(context.TODO(), instaslice))
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+
+	allocResult := getInstaslice(t, r, "node-1").Status.PodAllocationResults[pod.UID]
+	condition := meta.FindStatusCondition(allocResult.Conditions, FailedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, failedReasonCreateTimeout, condition.Reason)
+	}
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, allocResult.AllocationStatus.AllocationStatusController)
+	assert.Contains(t, r.allocationCache, pod.UID, "the slice may exist until the daemonset deleted it")
+
+	r.isCacheInitialized = false
+	assert.NoError(t, r.rebuildAllocationCache(context.TODO()))
+	assert.Contains(t, r.allocationCache, pod.UID, "the slots of failed allocations stay in use")
+}
+
+func TestAllocatePodAfterFailedAllocation(t *testing.T) {
+	holder := newPriorityPod("holder", 0, "1g.5gb", false)
+	pod := newPriorityPod("inference", 0, "1g.5gb", true)
+	instaslice := withRunningSlice(newTestInstaslice("node-1", "gpu-a"), holder, "gpu-a", 0)
+	withStatus(instaslice, holder.UID, inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+	}, time.Now().Add(-10*time.Minute))
+	r := newTestReconciler(instaslice, holder, pod)
+	r.Config.AllocationTimeout = 5 * time.Minute
+	r.isCacheInitialized = false
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+	assert.True(t, allocationFailed(getInstaslice(t, r, "node-1").Status.PodAllocationResults[holder.UID]))
+
+	slices, err := r.podSliceRequests(pod)
+	assert.NoError(t, err)
+	result, err := r.allocatePod(context.TODO(), pod, slices, &inferencev1alpha1.InstasliceList{Items: listInstaslices(t, r)})
+	assert.NoError(t, err)
+	assert.Zero(t, result.RequeueAfter, "the placement isn't taken")
+	allocations := getPodAllocations(listInstaslices(t, r), pod.UID)
+	if assert.Len(t, allocations, 1) {
+		assert.Equal(t, int32(1), allocations[0].Result.MigPlacement.Start, "the failed slice may still exist")
+	}
+}
+
+func TestCheckStuckAllocationsFailsDeleting(t *testing.T) {
+	stuck := newPriorityPod("stuck", 0, "1g.5gb", false)
+	recent := newPriorityPod("recent", 0, "1g.5gb", false)
+	deleting := inferencev1alpha1.AllocationStatus{
+		AllocationStatusController: inferencev1alpha1.AllocationStatusDeleting,
+		AllocationStatusDaemonset:  inferencev1alpha1.AllocationStatusCreated,
+	}
+	instaslice := newTestInstaslice("node-1", "gpu-a")
+	withStatus(withRunningSlice(instaslice, stuck, "gpu-a", 0), stuck.UID, deleting, time.Now().Add(-10*time.Minute))
+	withStatus(withRunningSlice(instaslice, recent, "gpu-a", 1), recent.UID, deleting, time.Now())
+	r := newTestReconciler(instaslice, stuck, recent)
+	r.Config.AllocationTimeout = 5 * time.Minute
+	for key, allocResult := range instaslice.Status.PodAllocationResults {
+		r.allocationCache[key] = allocResult
+	}
+
+	assert.NoError(t, r.checkStuckAllocations(context.TODO()))
+	results := getInstaslice(t, r, "node-1").Status.PodAllocationResults
+	condition := meta.FindStatusCondition(results[stuck.UID].Conditions, FailedCondition)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, failedReasonDeleteTimeout, condition.Reason)
+	}
+	assert.Equal(t, inferencev1alpha1.AllocationStatusDeleting, results[stuck.UID].AllocationStatus.AllocationStatusController)
+	assert.Contains(t, r.allocationCache, stuck.UID)
+	assert.False(t, allocationFailed(results[recent.UID]))
+	assert.Contains(t, r.allocationCache, recent.UID)
+}